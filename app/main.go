@@ -6,7 +6,10 @@ import (
 )
 
 func main() {
-	server, cleanup := InitializeServer()
+	server, cleanup, err := InitializeServer()
+	if err != nil {
+		log.Panic(err)
+	}
 	defer cleanup()
 	if err := server.Serve(context.Background()); err != nil {
 		log.Panic(err)
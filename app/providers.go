@@ -34,8 +34,20 @@ func NewHttpServiceConfig(ac *config.AppConfig) zhttp.Config {
 	return zhttp.Config{}
 }
 
-func NewKafkaConfig(ac *config.AppConfig) kafka.Config {
-	return kafka.Config{}
+// KafkaConfig names the kafka section of the app config, AppConfig looks values up by type name.
+// TLS certificates and SASL passwords are referenced by file so secrets stay out of the config itself, e.g.
+//
+//	"KafkaConfig": {
+//	  "BootstrapServers": ["broker-1:9093"],
+//	  "TLS": {"CAFile": "/etc/kafka/ca.pem", "CertFile": "/etc/kafka/client.pem", "KeyFile": "/etc/kafka/client-key.pem"},
+//	  "SASL": {"Mechanism": "SCRAM-SHA-512", "Username": "my-service", "PasswordFile": "/var/run/secrets/kafka/password"}
+//	}
+type KafkaConfig kafka.Config
+
+func NewKafkaConfig(ac *config.AppConfig) (kafka.Config, error) {
+	cfg := &KafkaConfig{}
+	err := ac.Value(cfg)
+	return kafka.Config(*cfg), err
 }
 func NewDbConfig(ac *config.AppConfig) db.Config {
 	return db.Config{}
@@ -16,7 +16,10 @@ func Test_Server_UsingMocks(t *testing.T) {
 	ctrl := gomock.NewController(t)
 	defer ctrl.Finish()
 
-	s, f := InitializeServerTestable(ctrl)
+	s, f, err := InitializeServerTestable(ctrl)
+	if err != nil {
+		t.Fatal(err)
+	}
 	defer f()
 
 	defer gock.Off()
@@ -16,23 +16,23 @@ import (
 	mock_kafka "github.com/zillow/howwegoatzillow/mocks/kafka"
 )
 
-func InitializeServer() (*server.Server, func()) {
+func InitializeServer() (*server.Server, func(), error) {
 	wire.Build(
 		ZCommonSet,
 		wire.Struct(new(MyService), "*"),
 		NewServer,
 	)
-	return &server.Server{}, nil
+	return &server.Server{}, nil, nil
 }
 
-func InitializeServerTestable(ctrl *gomock.Controller) (*ServerTestable, func()) {
+func InitializeServerTestable(ctrl *gomock.Controller) (*ServerTestable, func(), error) {
 	wire.Build(
 		ZCommonMockSet,
 		wire.Struct(new(MyService), "*"),
 		NewServer,
 		wire.Struct(new(ServerTestable), "*"),
 	)
-	return &ServerTestable{}, nil
+	return &ServerTestable{}, nil, nil
 }
 
 // This is in a separate common package
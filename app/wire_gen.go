@@ -20,7 +20,7 @@ import (
 
 // Injectors from wire.go:
 
-func InitializeServer() (*server.Server, func()) {
+func InitializeServer() (*server.Server, func(), error) {
 	appConfig := config.NewAppConfig()
 	serverConfig := NewServerConfig(appConfig)
 	tracer := NewTracer()
@@ -31,8 +31,12 @@ func InitializeServer() (*server.Server, func()) {
 	provider := http.NewClientProvider(tracer, leveledLogger)
 	dbConfig := NewDbConfig(appConfig)
 	dbProvider := db.NewProvider()
-	kafkaConfig := NewKafkaConfig(appConfig)
-	client := kafka.NewClient(kafkaConfig, tracer, loggerLogger)
+	kafkaConfig, err := NewKafkaConfig(appConfig)
+	if err != nil {
+		cleanup()
+		return nil, nil, err
+	}
+	client, cleanup2 := kafka.NewClient(kafkaConfig, tracer, loggerLogger)
 	myService := MyService{
 		ServerFactory:      factory,
 		HTTPConfig:         httpConfig,
@@ -44,11 +48,12 @@ func InitializeServer() (*server.Server, func()) {
 	}
 	serverServer := NewServer(myService)
 	return serverServer, func() {
+		cleanup2()
 		cleanup()
-	}
+	}, nil
 }
 
-func InitializeServerTestable(ctrl *gomock.Controller) (*ServerTestable, func()) {
+func InitializeServerTestable(ctrl *gomock.Controller) (*ServerTestable, func(), error) {
 	appConfig := config.NewAppConfig()
 	serverConfig := NewServerConfig(appConfig)
 	tracer := NewTracer()
@@ -59,7 +64,11 @@ func InitializeServerTestable(ctrl *gomock.Controller) (*ServerTestable, func())
 	provider := http.NewClientProvider(tracer, leveledLogger)
 	dbConfig := NewDbConfig(appConfig)
 	mockProvider := mock_db.NewMockProvider(ctrl)
-	kafkaConfig := NewKafkaConfig(appConfig)
+	kafkaConfig, err := NewKafkaConfig(appConfig)
+	if err != nil {
+		cleanup()
+		return nil, nil, err
+	}
 	mockClient := mock_kafka.NewMockClient(ctrl)
 	myService := MyService{
 		ServerFactory:      factory,
@@ -80,7 +89,7 @@ func InitializeServerTestable(ctrl *gomock.Controller) (*ServerTestable, func())
 	}
 	return serverTestable, func() {
 		cleanup()
-	}
+	}, nil
 }
 
 // wire.go:
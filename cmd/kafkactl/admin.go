@@ -0,0 +1,286 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/zillow/howwegoatzillow/libs/kafka"
+)
+
+func init() {
+	commands["topics list"] = command{usage: "list topics", run: topicsList}
+	commands["topics create"] = command{usage: "create a topic", run: topicsCreate}
+	commands["topics delete"] = command{usage: "delete a topic", run: topicsDelete}
+	commands["topics describe"] = command{usage: "show a topic's partitions and configs", run: topicsDescribe}
+	commands["topics alter"] = command{usage: "set configs on a topic", run: topicsAlter}
+	commands["groups list"] = command{usage: "list consumer groups", run: groupsList}
+	commands["groups describe"] = command{usage: "show a group's members, offsets and lag", run: groupsDescribe}
+	commands["groups delete"] = command{usage: "delete a consumer group", run: groupsDelete}
+	commands["groups reset"] = command{usage: "reset a group's offsets to earliest, latest or a time", run: groupsReset}
+	commands["groups rewind"] = command{usage: "rewind every running member of a group through its rewind endpoint", run: groupsRewind}
+}
+
+// adminCommand parses the flags shared by every admin command and runs fn with an Admin.
+func adminCommand(name string, args []string, register func(fs *flag.FlagSet), fn func(ctx context.Context, adm kafka.Admin) error) error {
+	fs := flag.NewFlagSet(name, flag.ExitOnError)
+	var conn connFlags
+	conn.register(fs)
+	timeout := fs.Duration("timeout", 30*time.Second, "how long to wait for the brokers")
+	if register != nil {
+		register(fs)
+	}
+	_ = fs.Parse(args)
+
+	adm, cleanup, err := kafka.NewAdmin(conn.config(), nil)
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+	return fn(ctx, adm)
+}
+
+func topicsList(args []string) error {
+	return adminCommand("topics list", args, nil, func(ctx context.Context, adm kafka.Admin) error {
+		topics, err := adm.ListTopics(ctx)
+		if err != nil {
+			return err
+		}
+		fmt.Println(strings.Join(topics, "\n"))
+		return nil
+	})
+}
+
+func topicsCreate(args []string) error {
+	var spec kafka.TopicSpec
+	var configs string
+	var partitions, replication int
+	return adminCommand("topics create", args, func(fs *flag.FlagSet) {
+		fs.StringVar(&spec.Topic, "topic", "", "topic to create")
+		fs.IntVar(&partitions, "partitions", 0, "number of partitions, 0 for the broker default")
+		fs.IntVar(&replication, "replication", 0, "replication factor, 0 for the broker default")
+		fs.StringVar(&configs, "config", "", "comma separated key=value topic configs")
+	}, func(ctx context.Context, adm kafka.Admin) error {
+		if spec.Topic == "" {
+			return errors.New("-topic is required")
+		}
+		spec.Partitions, spec.ReplicationFactor = int32(partitions), int16(replication)
+		var err error
+		if spec.Configs, err = parseConfigs(configs); err != nil {
+			return err
+		}
+		return adm.CreateTopic(ctx, spec)
+	})
+}
+
+func topicsDelete(args []string) error {
+	var topic string
+	return adminCommand("topics delete", args, func(fs *flag.FlagSet) {
+		fs.StringVar(&topic, "topic", "", "topic to delete")
+	}, func(ctx context.Context, adm kafka.Admin) error {
+		if topic == "" {
+			return errors.New("-topic is required")
+		}
+		return adm.DeleteTopic(ctx, topic)
+	})
+}
+
+func topicsDescribe(args []string) error {
+	var topic string
+	return adminCommand("topics describe", args, func(fs *flag.FlagSet) {
+		fs.StringVar(&topic, "topic", "", "topic to describe")
+	}, func(ctx context.Context, adm kafka.Admin) error {
+		desc, err := adm.DescribeTopic(ctx, topic)
+		if err != nil {
+			return err
+		}
+		return printJSON(desc)
+	})
+}
+
+func topicsAlter(args []string) error {
+	var topic, configs string
+	return adminCommand("topics alter", args, func(fs *flag.FlagSet) {
+		fs.StringVar(&topic, "topic", "", "topic to alter")
+		fs.StringVar(&configs, "config", "", "comma separated key=value topic configs")
+	}, func(ctx context.Context, adm kafka.Admin) error {
+		c, err := parseConfigs(configs)
+		if err != nil {
+			return err
+		}
+		if topic == "" || len(c) == 0 {
+			return errors.New("-topic and -config are required")
+		}
+		return adm.AlterTopicConfig(ctx, topic, c)
+	})
+}
+
+func groupsList(args []string) error {
+	return adminCommand("groups list", args, nil, func(ctx context.Context, adm kafka.Admin) error {
+		groups, err := adm.ListGroups(ctx)
+		if err != nil {
+			return err
+		}
+		fmt.Println(strings.Join(groups, "\n"))
+		return nil
+	})
+}
+
+func groupsDescribe(args []string) error {
+	var group string
+	return adminCommand("groups describe", args, func(fs *flag.FlagSet) {
+		fs.StringVar(&group, "group", "", "group to describe")
+	}, func(ctx context.Context, adm kafka.Admin) error {
+		desc, err := adm.DescribeGroup(ctx, group)
+		if err != nil {
+			return err
+		}
+		return printJSON(desc)
+	})
+}
+
+func groupsDelete(args []string) error {
+	var group string
+	return adminCommand("groups delete", args, func(fs *flag.FlagSet) {
+		fs.StringVar(&group, "group", "", "group to delete")
+	}, func(ctx context.Context, adm kafka.Admin) error {
+		if group == "" {
+			return errors.New("-group is required")
+		}
+		return adm.DeleteGroup(ctx, group)
+	})
+}
+
+func groupsReset(args []string) error {
+	var group, topic, to string
+	return adminCommand("groups reset", args, func(fs *flag.FlagSet) {
+		fs.StringVar(&group, "group", "", "group to reset, it must have no active members")
+		fs.StringVar(&topic, "topic", "", "topic to reset the group on")
+		fs.StringVar(&to, "to", "latest", "earliest, latest, an offset, an RFC3339 time or a duration ago such as 6h")
+	}, func(ctx context.Context, adm kafka.Admin) error {
+		if group == "" || topic == "" {
+			return errors.New("-group and -topic are required")
+		}
+		pos, err := kafka.ParsePosition(to)
+		if err != nil {
+			return err
+		}
+		return adm.ResetGroupOffsets(ctx, group, topic, pos)
+	})
+}
+
+func parseConfigs(s string) (map[string]string, error) {
+	configs := make(map[string]string)
+	for _, kv := range splitList(s) {
+		k, v, ok := strings.Cut(kv, "=")
+		if !ok {
+			return nil, errors.Errorf("config %q is not key=value", kv)
+		}
+		configs[k] = v
+	}
+	return configs, nil
+}
+
+func printJSON(v interface{}) error {
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+// groupsRewind posts to the rewind endpoint, see worker.RewindHandler, of every member assigned partitions of
+// the topic. Each member only rewinds the partitions it is assigned, so all of them have to be asked.
+func groupsRewind(args []string) error {
+	var group, topic, to, endpoint string
+	return adminCommand("groups rewind", args, func(fs *flag.FlagSet) {
+		fs.StringVar(&group, "group", "", "group to rewind, its members keep running")
+		fs.StringVar(&topic, "topic", "", "topic to rewind the group on")
+		fs.StringVar(&to, "to", "", "earliest, latest, an offset, an RFC3339 time or a duration ago such as 6h")
+		fs.StringVar(&endpoint, "url", "http://{host}:8080/admin/rewind", "rewind endpoint of a member, {host} is replaced by its host")
+	}, func(ctx context.Context, adm kafka.Admin) error {
+		if group == "" || topic == "" || to == "" {
+			return errors.New("-group, -topic and -to are required")
+		}
+		// Members would each resolve a duration ago at a different time, send them the time it resolves to here.
+		pos, err := kafka.ParsePosition(to)
+		if err != nil {
+			return err
+		}
+		desc, err := adm.DescribeGroup(ctx, group)
+		if err != nil {
+			return err
+		}
+
+		hosts := map[string]bool{}
+		for _, m := range desc.Members {
+			if len(m.Assigned[topic]) > 0 {
+				// Brokers report the address a member connected from as /ip.
+				hosts[strings.TrimPrefix(m.Host, "/")] = true
+			}
+		}
+		if len(hosts) == 0 {
+			return errors.Errorf("group %s has no members assigned %s", group, topic)
+		}
+		sorted := make([]string, 0, len(hosts))
+		for host := range hosts {
+			sorted = append(sorted, host)
+		}
+		sort.Strings(sorted)
+
+		failed := 0
+		for _, host := range sorted {
+			if err := rewindMember(ctx, strings.ReplaceAll(endpoint, "{host}", urlHost(host)), pos.String()); err != nil {
+				fmt.Fprintf(os.Stderr, "%s: %v\n", host, err)
+				failed++
+				continue
+			}
+			fmt.Printf("%s: rewound\n", host)
+		}
+		if failed > 0 {
+			return errors.Errorf("%d of %d members failed to rewind, their partitions weren't moved", failed, len(sorted))
+		}
+		return nil
+	})
+}
+
+// urlHost brackets an IPv6 address, so it can be followed by a port in a URL.
+func urlHost(host string) string {
+	if strings.Contains(host, ":") && !strings.HasPrefix(host, "[") {
+		return "[" + host + "]"
+	}
+	return host
+}
+
+func rewindMember(ctx context.Context, endpoint, to string) error {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return errors.Wrapf(err, "invalid rewind url %q", endpoint)
+	}
+	q := u.Query()
+	q.Set("to", to)
+	u.RawQuery = q.Encode()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, u.String(), nil)
+	if err != nil {
+		return err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return errors.Errorf("rewind returned %s", resp.Status)
+	}
+	return nil
+}
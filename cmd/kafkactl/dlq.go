@@ -0,0 +1,142 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/opentracing/opentracing-go"
+	"github.com/pkg/errors"
+	"github.com/zillow/howwegoatzillow/libs/kafka"
+	"github.com/zillow/howwegoatzillow/libs/worker"
+)
+
+type dlqFlags struct {
+	conn  connFlags
+	topic string
+	limit int
+	idle  time.Duration
+}
+
+func (f *dlqFlags) register(fs *flag.FlagSet) {
+	f.conn.register(fs)
+	fs.StringVar(&f.topic, "topic", "", "dead letter topic")
+	fs.IntVar(&f.limit, "n", 0, "stop after this many messages, 0 for no limit")
+	fs.DurationVar(&f.idle, "idle", 5*time.Second, "stop once no message arrived for this long")
+}
+
+func (f *dlqFlags) client() (kafka.Client, func(), error) {
+	if f.topic == "" {
+		return nil, nil, errors.New("-topic is required")
+	}
+	c, cleanup := kafka.NewClient(f.conn.config(), opentracing.NoopTracer{}, nil)
+	return c, cleanup, nil
+}
+
+// each calls fn for every message until the topic goes idle or the limit is reached.
+func (f *dlqFlags) each(ctx context.Context, r kafka.Reader, fn func(*kafka.Message) error) (int, error) {
+	n := 0
+	for f.limit == 0 || n < f.limit {
+		readCtx, cancel := context.WithTimeout(ctx, f.idle)
+		msg, err := r.Read(readCtx)
+		cancel()
+		if errors.Is(err, context.DeadlineExceeded) {
+			return n, nil
+		}
+		if err != nil {
+			return n, err
+		}
+		if err := fn(msg); err != nil {
+			return n, err
+		}
+		n++
+	}
+	return n, nil
+}
+
+type inspected struct {
+	Partition  int32             `json:"partition"`
+	Offset     int64             `json:"offset"`
+	Key        string            `json:"key"`
+	Value      string            `json:"value"`
+	Headers    map[string]string `json:"headers"`
+	DeadLetter worker.DeadLetter `json:"deadLetter"`
+}
+
+func dlqInspect(args []string) error {
+	var f dlqFlags
+	fs := flag.NewFlagSet("dlq inspect", flag.ExitOnError)
+	f.register(fs)
+	_ = fs.Parse(args)
+
+	ctx := context.Background()
+	c, cleanup, err := f.client()
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+
+	r, err := c.Reader(ctx, kafka.Config{Topic: f.topic})
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	enc := json.NewEncoder(os.Stdout)
+	_, err = f.each(ctx, r, func(msg *kafka.Message) error {
+		dl, _ := worker.ParseDeadLetter(msg)
+		headers := make(map[string]string, len(msg.Headers))
+		for _, h := range msg.Headers {
+			headers[h.Key] = string(h.Value)
+		}
+		return enc.Encode(inspected{
+			Partition:  msg.Partition,
+			Offset:     msg.Offset,
+			Key:        msg.Key,
+			Value:      string(msg.Value()),
+			Headers:    headers,
+			DeadLetter: dl,
+		})
+	})
+	return err
+}
+
+func dlqReplay(args []string) error {
+	var f dlqFlags
+	var group string
+	fs := flag.NewFlagSet("dlq replay", flag.ExitOnError)
+	f.register(fs)
+	fs.StringVar(&group, "group", "", "consumer group that remembers what was replayed, defaults to <topic>.replay")
+	_ = fs.Parse(args)
+
+	ctx := context.Background()
+	c, cleanup, err := f.client()
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+
+	if group == "" {
+		group = f.topic + ".replay"
+	}
+	r, err := c.Reader(ctx, kafka.Config{Topic: f.topic, GroupID: group})
+	if err != nil {
+		return err
+	}
+
+	n, err := f.each(ctx, r, func(msg *kafka.Message) error {
+		if _, err := worker.Replay(ctx, c, msg); err != nil {
+			return err
+		}
+		msg.Done()
+		return nil
+	})
+	if closeErr := r.Close(); err == nil {
+		err = closeErr
+	}
+	fmt.Fprintf(os.Stderr, "replayed %d messages\n", n)
+	return err
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/opentracing/opentracing-go"
+	"github.com/pkg/errors"
+	"github.com/zillow/howwegoatzillow/libs/kafka"
+	"github.com/zillow/howwegoatzillow/libs/kafka/dump"
+)
+
+func init() {
+	commands["topics dump"] = command{usage: "write a topic's messages to JSON lines", run: topicsDump}
+	commands["topics replay"] = command{usage: "write JSON lines from a dump into a topic", run: topicsReplay}
+}
+
+func topicsDump(args []string) error {
+	fs := flag.NewFlagSet("topics dump", flag.ExitOnError)
+	var conn connFlags
+	conn.register(fs)
+	topic := fs.String("topic", "", "topic to dump")
+	out := fs.String("out", "-", "file to write, - for stdout")
+	partitions := fs.String("partitions", "", "comma separated partitions, default all")
+	from := fs.Int64("from-offset", 0, "first offset to dump")
+	to := fs.Int64("to-offset", -1, "last offset to dump, -1 for no limit")
+	since := fs.String("since", "", "only messages at or after this RFC3339 time")
+	until := fs.String("until", "", "only messages before this RFC3339 time")
+	limit := fs.Int("n", 0, "stop after this many messages, 0 for no limit")
+	idle := fs.Duration("idle", 5*time.Second, "stop once no message arrived for this long")
+	encoding := fs.String("value", dump.ValueAuto, "value encoding: auto, json or base64")
+	_ = fs.Parse(args)
+
+	if *topic == "" {
+		return errors.New("-topic is required")
+	}
+	options := []dump.DumpOption{
+		dump.WithOffsets(*from, *to),
+		dump.WithLimit(*limit),
+		dump.WithIdle(*idle),
+		dump.WithValueEncoding(*encoding),
+	}
+	if *partitions != "" {
+		var ps []int32
+		for _, p := range splitList(*partitions) {
+			n, err := strconv.ParseInt(p, 10, 32)
+			if err != nil {
+				return errors.Wrapf(err, "invalid partition %q", p)
+			}
+			ps = append(ps, int32(n))
+		}
+		options = append(options, dump.WithPartitions(ps...))
+	}
+	var sinceT, untilT time.Time
+	for _, t := range []struct {
+		s   string
+		dst *time.Time
+	}{{*since, &sinceT}, {*until, &untilT}} {
+		if t.s == "" {
+			continue
+		}
+		v, err := time.Parse(time.RFC3339, t.s)
+		if err != nil {
+			return errors.Wrapf(err, "invalid time %q", t.s)
+		}
+		*t.dst = v
+	}
+	options = append(options, dump.WithTimeRange(sinceT, untilT))
+
+	w := os.Stdout
+	if *out != "-" {
+		f, err := os.Create(*out)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		w = f
+	}
+
+	ctx := context.Background()
+	c, cleanup := kafka.NewClient(conn.config(), opentracing.NoopTracer{}, nil)
+	defer cleanup()
+	adm, closeAdmin, err := kafka.NewAdmin(conn.config(), nil)
+	if err != nil {
+		return err
+	}
+	defer closeAdmin()
+
+	n, err := dump.Dump(ctx, c, adm, *topic, w, options...)
+	fmt.Fprintf(os.Stderr, "dumped %d messages\n", n)
+	return err
+}
+
+func topicsReplay(args []string) error {
+	fs := flag.NewFlagSet("topics replay", flag.ExitOnError)
+	var conn connFlags
+	conn.register(fs)
+	topic := fs.String("topic", "", "topic to write to")
+	in := fs.String("in", "-", "dump file to read, - for stdin")
+	rate := fs.Float64("rate", 0, "messages per second, 0 for no limit")
+	keys := fs.String("rewrite-key", "", "comma separated old=new keys")
+	set := fs.String("set-header", "", "comma separated key=value headers to set on every message")
+	drop := fs.String("drop-header", "", "comma separated headers to remove, e.g. ce_id so idempotent workers don't skip replays")
+	dryRun := fs.Bool("dry-run", false, "print the rewritten records instead of writing them")
+	_ = fs.Parse(args)
+
+	if *topic == "" && !*dryRun {
+		return errors.New("-topic is required")
+	}
+	keyMap, err := parseConfigs(*keys)
+	if err != nil {
+		return err
+	}
+	headers, err := parseConfigs(*set)
+	if err != nil {
+		return err
+	}
+	options := []dump.ReplayOption{
+		dump.WithRate(*rate),
+		dump.WithKeyRewrite(keyMap),
+		dump.WithSetHeaders(headers),
+		dump.WithDropHeaders(splitList(*drop)...),
+	}
+	if *dryRun {
+		options = append(options, dump.WithDryRun(os.Stdout))
+	}
+
+	r := os.Stdin
+	if *in != "-" {
+		f, err := os.Open(*in)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		r = f
+	}
+
+	ctx := context.Background()
+	var w kafka.Writer
+	if !*dryRun {
+		c, cleanup := kafka.NewClient(conn.config(), opentracing.NoopTracer{}, nil)
+		defer cleanup()
+		if w, err = c.Writer(ctx, kafka.Config{Topic: *topic}); err != nil {
+			return err
+		}
+	}
+
+	n, err := dump.Replay(ctx, w, r, options...)
+	fmt.Fprintf(os.Stderr, "replayed %d messages\n", n)
+	return err
+}
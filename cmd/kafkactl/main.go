@@ -0,0 +1,106 @@
+// Command kafkactl is a small operations tool for the topics our workers use.
+//
+//	kafkactl dlq inspect -brokers localhost:9092 -topic orders.dlq
+//	kafkactl dlq replay -brokers localhost:9092 -topic orders.dlq -group orders.dlq.replay
+//	kafkactl topics create -brokers localhost:9092 -topic orders -partitions 12 -config retention.ms=86400000
+//	kafkactl groups reset -brokers localhost:9092 -group orders-worker -topic orders -to 2021-12-01T00:00:00Z
+//	kafkactl groups rewind -brokers localhost:9092 -group orders-worker -topic orders -to 6h
+//	kafkactl topics dump -brokers localhost:9092 -topic orders -partitions 3 -from-offset 1200 -out orders.jsonl
+//	kafkactl topics replay -brokers localhost:9092 -topic orders -in orders.jsonl -rate 50
+//	kafkactl topics list -brokers kafka:9093 -tls-ca ca.pem -sasl-mechanism SCRAM-SHA-512 -sasl-user ops -sasl-password-file /secrets/kafka
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/zillow/howwegoatzillow/libs/kafka"
+)
+
+type command struct {
+	usage string
+	run   func(args []string) error
+}
+
+var commands = map[string]command{
+	"dlq inspect": {usage: "print dead lettered messages and why they failed", run: dlqInspect},
+	"dlq replay":  {usage: "write dead lettered messages back to their source topic", run: dlqReplay},
+}
+
+func main() {
+	if len(os.Args) < 3 {
+		usage()
+		os.Exit(2)
+	}
+
+	cmd, ok := commands[os.Args[1]+" "+os.Args[2]]
+	if !ok {
+		usage()
+		os.Exit(2)
+	}
+	if err := cmd.run(os.Args[3:]); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+func usage() {
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	fmt.Fprintln(os.Stderr, "usage: kafkactl <command> [flags]")
+	for _, name := range names {
+		fmt.Fprintf(os.Stderr, "  %-16s %s\n", name, commands[name].usage)
+	}
+}
+
+func splitList(s string) []string {
+	var out []string
+	for _, v := range strings.Split(s, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			out = append(out, v)
+		}
+	}
+	return out
+}
+
+// connFlags are the flags every command connects to the brokers with.
+type connFlags struct {
+	brokers          string
+	tls              bool
+	tlsCA            string
+	tlsCert          string
+	tlsKey           string
+	saslMechanism    string
+	saslUser         string
+	saslPasswordFile string
+}
+
+func (f *connFlags) register(fs *flag.FlagSet) {
+	fs.StringVar(&f.brokers, "brokers", "localhost:9092", "comma separated bootstrap servers")
+	fs.BoolVar(&f.tls, "tls", false, "connect with TLS, implied by the other -tls flags")
+	fs.StringVar(&f.tlsCA, "tls-ca", "", "PEM bundle to verify the brokers against, default the system pool")
+	fs.StringVar(&f.tlsCert, "tls-cert", "", "PEM client certificate for mutual TLS")
+	fs.StringVar(&f.tlsKey, "tls-key", "", "PEM client key for mutual TLS")
+	fs.StringVar(&f.saslMechanism, "sasl-mechanism", "", "PLAIN, SCRAM-SHA-256 or SCRAM-SHA-512, default no SASL")
+	fs.StringVar(&f.saslUser, "sasl-user", "", "SASL username")
+	fs.StringVar(&f.saslPasswordFile, "sasl-password-file", "", "file holding the SASL password")
+}
+
+// config maps the flags onto the connection fields of a kafka.Config.
+func (f *connFlags) config() kafka.Config {
+	cfg := kafka.Config{BootstrapServers: splitList(f.brokers)}
+	if f.tls || f.tlsCA != "" || f.tlsCert != "" || f.tlsKey != "" {
+		cfg.TLS = &kafka.TLSConfig{CAFile: f.tlsCA, CertFile: f.tlsCert, KeyFile: f.tlsKey}
+	}
+	if f.saslMechanism != "" {
+		cfg.SASL = &kafka.SASLConfig{Mechanism: f.saslMechanism, Username: f.saslUser, PasswordFile: f.saslPasswordFile}
+	}
+	return cfg
+}
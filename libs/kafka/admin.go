@@ -0,0 +1,386 @@
+package kafka
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/twmb/franz-go/pkg/kadm"
+	"github.com/twmb/franz-go/pkg/kerr"
+	"github.com/twmb/franz-go/pkg/kgo"
+	"github.com/twmb/franz-go/pkg/kmsg"
+)
+
+// TopicSpec describes a topic to create. Zero Partitions and ReplicationFactor use the broker defaults.
+type TopicSpec struct {
+	Topic             string
+	Partitions        int32
+	ReplicationFactor int16
+	Configs           map[string]string
+}
+
+// TopicDescription describes an existing topic. Configs only holds values that were set on the topic itself.
+type TopicDescription struct {
+	Topic             string
+	Partitions        int32
+	ReplicationFactor int16
+	Configs           map[string]string
+}
+
+// GroupDescription describes a consumer group, its members and how far behind it is.
+type GroupDescription struct {
+	Group   string
+	State   string
+	Members []GroupMember
+	// Offsets are the committed offsets and Lag how many messages are left to read, by topic and partition.
+	Offsets map[string]map[int32]int64
+	Lag     map[string]map[int32]int64
+}
+
+// GroupMember is a consumer in a group and the partitions it was assigned, by topic.
+type GroupMember struct {
+	MemberID string
+	ClientID string
+	Host     string
+	Assigned map[string][]int32
+}
+
+// Position is where in a partition to reset offsets or start reading from.
+type Position struct {
+	earliest bool
+	at       time.Time
+	offset   int64
+	atOffset bool
+}
+
+var (
+	// Earliest is the oldest message still in the partition.
+	Earliest = Position{earliest: true}
+	// Latest is the end of the partition, only messages written from now on.
+	Latest = Position{}
+)
+
+// AtTime is the first message written at or after t.
+func AtTime(t time.Time) Position { return Position{at: t} }
+
+// AtOffset is the given offset on every partition, or the end of partitions that don't reach it yet,
+// or the oldest message left of partitions that deleted it.
+func AtOffset(offset int64) Position { return Position{offset: offset, atOffset: true} }
+
+// ParsePosition parses "earliest", "latest", an offset, an RFC3339 time or a duration such as "6h",
+// which is that long ago.
+func ParsePosition(s string) (Position, error) {
+	switch s {
+	case "earliest":
+		return Earliest, nil
+	case "latest":
+		return Latest, nil
+	}
+	if o, err := strconv.ParseInt(s, 10, 64); err == nil && o >= 0 {
+		return AtOffset(o), nil
+	}
+	if d, err := time.ParseDuration(s); err == nil && d > 0 {
+		return AtTime(time.Now().Add(-d)), nil
+	}
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return AtTime(t), nil
+	}
+	return Position{}, errors.Errorf("position must be earliest, latest, an offset, an RFC3339 time or a duration, got %q", s)
+}
+
+// String formats the position the way ParsePosition reads it. A duration ago is the time it was parsed at,
+// so the position points at the same messages wherever it is parsed again.
+func (p Position) String() string {
+	switch {
+	case p.earliest:
+		return "earliest"
+	case p.atOffset:
+		return strconv.FormatInt(p.offset, 10)
+	case !p.at.IsZero():
+		return p.at.UTC().Format(time.RFC3339Nano)
+	default:
+		return "latest"
+	}
+}
+
+// kgoOffset is where a kgo consumer starts for the position.
+func (p Position) kgoOffset() kgo.Offset {
+	switch {
+	case p.earliest:
+		return kgo.NewOffset().AtStart()
+	case p.atOffset:
+		return kgo.NewOffset().At(p.offset)
+	case !p.at.IsZero():
+		return kgo.NewOffset().AfterMilli(p.at.UnixMilli())
+	default:
+		return kgo.NewOffset().AtEnd()
+	}
+}
+
+// positionOffsets returns, by partition of topic, the offset the position points at.
+func positionOffsets(ctx context.Context, adm *kadm.Client, topic string, to Position) (map[int32]int64, error) {
+	var listed kadm.ListedOffsets
+	var err error
+	switch {
+	case to.earliest:
+		listed, err = adm.ListStartOffsets(ctx, topic)
+	case !to.at.IsZero():
+		listed, err = adm.ListOffsetsAfterMilli(ctx, to.at.UnixMilli(), topic)
+	default:
+		listed, err = adm.ListEndOffsets(ctx, topic)
+	}
+	if err == nil {
+		err = listed.Error()
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to list offsets of topic %s", topic)
+	}
+
+	offsets := make(map[int32]int64)
+	listed.Each(func(o kadm.ListedOffset) {
+		offsets[o.Partition] = o.Offset
+		if to.atOffset && to.offset < o.Offset {
+			offsets[o.Partition] = to.offset
+		}
+	})
+	if !to.atOffset {
+		return offsets, nil
+	}
+
+	// An offset retention already deleted moves to the oldest message left.
+	starts, err := adm.ListStartOffsets(ctx, topic)
+	if err == nil {
+		err = starts.Error()
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to list start offsets of topic %s", topic)
+	}
+	starts.Each(func(o kadm.ListedOffset) {
+		if offsets[o.Partition] < o.Offset {
+			offsets[o.Partition] = o.Offset
+		}
+	})
+	return offsets, nil
+}
+
+var _ Admin = (*admin)(nil)
+
+type admin struct {
+	adm *kadm.Client
+}
+
+// NewAdmin creates an Admin talking to the config.BootstrapServers.
+func NewAdmin(config Config, logger Logger) (Admin, func(), error) {
+	opts, err := (&client{logger: logger}).clientOpts(config)
+	if err != nil {
+		return nil, nil, err
+	}
+	cl, err := kgo.NewClient(opts...)
+	if err != nil {
+		return nil, nil, err
+	}
+	return &admin{adm: kadm.NewClient(cl)}, cl.Close, nil
+}
+
+func (a *admin) CreateTopic(ctx context.Context, spec TopicSpec) error {
+	resp, err := a.adm.CreateTopic(ctx, partitionsOrDefault(spec), replicationOrDefault(spec), configPtrs(spec.Configs), spec.Topic)
+	if err != nil {
+		return err
+	}
+	return errors.Wrapf(resp.Err, "failed to create topic %s", spec.Topic)
+}
+
+func (a *admin) EnsureTopics(ctx context.Context, specs ...TopicSpec) error {
+	for _, spec := range specs {
+		err := a.CreateTopic(ctx, spec)
+		if err != nil && !errors.Is(err, kerr.TopicAlreadyExists) {
+			return err
+		}
+	}
+	return nil
+}
+
+func (a *admin) DeleteTopic(ctx context.Context, topic string) error {
+	resp, err := a.adm.DeleteTopic(ctx, topic)
+	if err != nil {
+		return err
+	}
+	return errors.Wrapf(resp.Err, "failed to delete topic %s", topic)
+}
+
+func (a *admin) ListTopics(ctx context.Context) ([]string, error) {
+	topics, err := a.adm.ListTopics(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return topics.Names(), nil
+}
+
+func (a *admin) DescribeTopic(ctx context.Context, topic string) (TopicDescription, error) {
+	topics, err := a.adm.ListTopics(ctx, topic)
+	if err != nil {
+		return TopicDescription{}, err
+	}
+	detail, ok := topics[topic]
+	if !ok {
+		return TopicDescription{}, errors.Wrapf(kerr.UnknownTopicOrPartition, "failed to describe topic %s", topic)
+	}
+	if detail.Err != nil {
+		return TopicDescription{}, errors.Wrapf(detail.Err, "failed to describe topic %s", topic)
+	}
+
+	desc := TopicDescription{
+		Topic:      topic,
+		Partitions: int32(len(detail.Partitions)),
+		Configs:    make(map[string]string),
+	}
+	if p, ok := detail.Partitions[0]; ok {
+		desc.ReplicationFactor = int16(len(p.Replicas))
+	}
+
+	configs, err := a.adm.DescribeTopicConfigs(ctx, topic)
+	if err != nil {
+		return desc, err
+	}
+	rc, err := configs.On(topic, nil)
+	if err == nil {
+		err = rc.Err
+	}
+	if err != nil {
+		return desc, errors.Wrapf(err, "failed to describe configs of topic %s", topic)
+	}
+	for _, c := range rc.Configs {
+		if c.Source == kmsg.ConfigSourceDynamicTopicConfig && c.Value != nil {
+			desc.Configs[c.Key] = *c.Value
+		}
+	}
+	return desc, nil
+}
+
+func (a *admin) EndOffsets(ctx context.Context, topic string) (map[int32]int64, error) {
+	listed, err := a.adm.ListEndOffsets(ctx, topic)
+	if err == nil {
+		err = listed.Error()
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to list end offsets of topic %s", topic)
+	}
+	offsets := make(map[int32]int64)
+	listed.Each(func(o kadm.ListedOffset) {
+		offsets[o.Partition] = o.Offset
+	})
+	return offsets, nil
+}
+
+func (a *admin) AlterTopicConfig(ctx context.Context, topic string, configs map[string]string) error {
+	alter := make([]kadm.AlterConfig, 0, len(configs))
+	for k, v := range configs {
+		v := v
+		alter = append(alter, kadm.AlterConfig{Op: kadm.SetConfig, Name: k, Value: &v})
+	}
+	resp, err := a.adm.AlterTopicConfigs(ctx, alter, topic)
+	if err != nil {
+		return err
+	}
+	r, err := resp.On(topic, nil)
+	if err != nil {
+		return err
+	}
+	return errors.Wrapf(r.Err, "failed to alter topic %s", topic)
+}
+
+func (a *admin) ListGroups(ctx context.Context) ([]string, error) {
+	groups, err := a.adm.ListGroups(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return groups.Groups(), nil
+}
+
+func (a *admin) DescribeGroup(ctx context.Context, group string) (GroupDescription, error) {
+	lags, err := a.adm.Lag(ctx, group)
+	if err != nil {
+		return GroupDescription{}, err
+	}
+	lag, ok := lags[group]
+	if !ok {
+		return GroupDescription{}, errors.Errorf("group %s not described", group)
+	}
+	if err := lag.Error(); err != nil {
+		return GroupDescription{}, errors.Wrapf(err, "failed to describe group %s", group)
+	}
+
+	desc := GroupDescription{
+		Group:   group,
+		State:   lag.State,
+		Offsets: make(map[string]map[int32]int64),
+		Lag:     make(map[string]map[int32]int64),
+	}
+	for _, m := range lag.Members {
+		member := GroupMember{MemberID: m.MemberID, ClientID: m.ClientID, Host: m.ClientHost, Assigned: make(map[string][]int32)}
+		if assigned, ok := m.Assigned.AsConsumer(); ok {
+			for _, t := range assigned.Topics {
+				member.Assigned[t.Topic] = t.Partitions
+			}
+		}
+		desc.Members = append(desc.Members, member)
+	}
+	for topic, partitions := range lag.Lag {
+		desc.Offsets[topic] = make(map[int32]int64)
+		desc.Lag[topic] = make(map[int32]int64)
+		for p, l := range partitions {
+			desc.Offsets[topic][p] = l.Commit.At
+			desc.Lag[topic][p] = l.Lag
+		}
+	}
+	return desc, nil
+}
+
+func (a *admin) DeleteGroup(ctx context.Context, group string) error {
+	resp, err := a.adm.DeleteGroup(ctx, group)
+	if err != nil {
+		return err
+	}
+	return errors.Wrapf(resp.Err, "failed to delete group %s", group)
+}
+
+func (a *admin) ResetGroupOffsets(ctx context.Context, group, topic string, to Position) error {
+	listed, err := positionOffsets(ctx, a.adm, topic, to)
+	if err != nil {
+		return err
+	}
+
+	offsets := make(kadm.Offsets)
+	for p, o := range listed {
+		offsets.Add(kadm.Offset{Topic: topic, Partition: p, At: o, LeaderEpoch: -1})
+	}
+	err = a.adm.CommitAllOffsets(ctx, group, offsets)
+	return errors.Wrapf(err, "failed to reset offsets of group %s on topic %s", group, topic)
+}
+
+func partitionsOrDefault(spec TopicSpec) int32 {
+	if spec.Partitions == 0 {
+		return -1
+	}
+	return spec.Partitions
+}
+
+func replicationOrDefault(spec TopicSpec) int16 {
+	if spec.ReplicationFactor == 0 {
+		return -1
+	}
+	return spec.ReplicationFactor
+}
+
+func configPtrs(configs map[string]string) map[string]*string {
+	if len(configs) == 0 {
+		return nil
+	}
+	ptrs := make(map[string]*string, len(configs))
+	for k, v := range configs {
+		v := v
+		ptrs[k] = &v
+	}
+	return ptrs
+}
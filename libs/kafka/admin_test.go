@@ -0,0 +1,206 @@
+package kafka
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/opentracing/opentracing-go"
+	"github.com/twmb/franz-go/pkg/kadm"
+)
+
+func Test_Admin_TopicLifecycle(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	adm, cleanup, err := NewAdmin(newFakeCluster(t), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cleanup()
+
+	spec := TopicSpec{Topic: "listings", Partitions: 4, ReplicationFactor: 1, Configs: map[string]string{"retention.ms": "60000"}}
+	if err := adm.EnsureTopics(ctx, spec); err != nil {
+		t.Fatal(err)
+	}
+	// Ensuring again is a no-op.
+	if err := adm.EnsureTopics(ctx, spec); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := adm.AlterTopicConfig(ctx, "listings", map[string]string{"cleanup.policy": "compact"}); err != nil {
+		t.Fatal(err)
+	}
+	desc, err := adm.DescribeTopic(ctx, "listings")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if desc.Partitions != 4 || desc.Configs["cleanup.policy"] != "compact" {
+		t.Errorf("unexpected description %+v", desc)
+	}
+
+	if err := adm.DeleteTopic(ctx, "listings"); err != nil {
+		t.Fatal(err)
+	}
+	topics, err := adm.ListTopics(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(topics) != 0 {
+		t.Errorf("expected no topics left, got %v", topics)
+	}
+}
+
+func Test_Admin_ResetGroupOffsets(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	cfg := newFakeCluster(t, "orders")
+	c, cleanup := NewClient(cfg, opentracing.NoopTracer{}, nil)
+	defer cleanup()
+	adm, admCleanup, err := NewAdmin(cfg, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer admCleanup()
+
+	w, _ := c.Writer(ctx, Config{Topic: "orders"})
+	for _, key := range []string{"a", "b", "c"} {
+		if _, err := w.Write(ctx, key, []byte(key)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := adm.ResetGroupOffsets(ctx, "g1", "orders", Latest); err != nil {
+		t.Fatal(err)
+	}
+	desc, err := adm.DescribeGroup(ctx, "g1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var committed, lag int64
+	for _, o := range desc.Offsets["orders"] {
+		committed += o
+	}
+	for _, l := range desc.Lag["orders"] {
+		lag += l
+	}
+	if committed != 3 || lag != 0 {
+		t.Errorf("expected 3 committed and no lag, got %d and %d", committed, lag)
+	}
+
+	if err := adm.ResetGroupOffsets(ctx, "g1", "orders", Earliest); err != nil {
+		t.Fatal(err)
+	}
+	r, _ := c.Reader(ctx, Config{Topic: "orders", GroupID: "g1"})
+	defer r.Close()
+	if _, err := r.Read(ctx); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func Test_MemoryClient_ResetGroupOffsetsToTime(t *testing.T) {
+	ctx := context.Background()
+	c := NewMemoryClient()
+	if err := c.EnsureTopics(ctx, TopicSpec{Topic: "orders", Partitions: 2}); err != nil {
+		t.Fatal(err)
+	}
+	w, _ := c.Writer(ctx, Config{Topic: "orders"})
+	_, _ = w.Write(ctx, "a", []byte("a"))
+	time.Sleep(5 * time.Millisecond)
+	cutoff := time.Now()
+	_, _ = w.Write(ctx, "a", []byte("b"))
+
+	if err := c.ResetGroupOffsets(ctx, "g1", "orders", AtTime(cutoff)); err != nil {
+		t.Fatal(err)
+	}
+	r, _ := c.Reader(ctx, Config{Topic: "orders", GroupID: "g1"})
+	msg, err := r.Read(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(msg.Value()) != "b" {
+		t.Errorf("expected to start from b, got %q", msg.Value())
+	}
+}
+
+func Test_ParsePosition(t *testing.T) {
+	at := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		in   string
+		want Position
+	}{
+		{"earliest", Earliest},
+		{"latest", Latest},
+		{"42", AtOffset(42)},
+		{"2024-05-01T12:00:00Z", AtTime(at)},
+	}
+	for _, tt := range tests {
+		got, err := ParsePosition(tt.in)
+		if err != nil || got != tt.want {
+			t.Errorf("ParsePosition(%q) = %+v, %v, want %+v", tt.in, got, err, tt.want)
+		}
+		if got.String() != tt.in {
+			t.Errorf("expected %+v to format as %q, got %q", got, tt.in, got.String())
+		}
+	}
+
+	got, err := ParsePosition("6h")
+	if err != nil || time.Since(got.at) < 6*time.Hour || time.Since(got.at) > 6*time.Hour+time.Minute {
+		t.Errorf("expected 6h to be six hours ago, got %+v, %v", got, err)
+	}
+	// A relative position is sent on as the time it resolved to.
+	again, err := ParsePosition(got.String())
+	if err != nil || !again.at.Equal(got.at) {
+		t.Errorf("expected %s to parse back to %v, got %+v, %v", got, got.at, again, err)
+	}
+	if _, err := ParsePosition("yesterday"); err == nil {
+		t.Error("expected an error for an unknown position")
+	}
+}
+
+func Test_Admin_ResetGroupOffsetsClampsToStart(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	cfg := newFakeCluster(t, "orders")
+	c, cleanup := NewClient(cfg, opentracing.NoopTracer{}, nil)
+	defer cleanup()
+	adm, admCleanup, err := NewAdmin(cfg, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer admCleanup()
+
+	w, _ := c.Writer(ctx, Config{Topic: "orders"})
+	for _, key := range []string{"a", "b", "c"} {
+		if _, err := w.Write(ctx, key, []byte(key)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	ends, err := adm.EndOffsets(ctx, "orders")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Retention deleted everything written so far.
+	deleted := make(kadm.Offsets)
+	for p, o := range ends {
+		deleted.Add(kadm.Offset{Topic: "orders", Partition: p, At: o})
+	}
+	if _, err := adm.(*admin).adm.DeleteRecords(ctx, deleted); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := adm.ResetGroupOffsets(ctx, "g1", "orders", AtOffset(0)); err != nil {
+		t.Fatal(err)
+	}
+	desc, err := adm.DescribeGroup(ctx, "g1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for p, o := range ends {
+		if got := desc.Offsets["orders"][p]; got != o {
+			t.Errorf("expected partition %d at its start offset %d, got %d", p, o, got)
+		}
+	}
+}
@@ -0,0 +1,286 @@
+package kafka
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Headers a claim check writer sets in place of a payload it stored.
+const (
+	// ClaimCheckHeader holds the BlobStore key of the payload.
+	ClaimCheckHeader = "claim-check"
+	// ClaimCheckSizeHeader holds the size of the payload in bytes.
+	ClaimCheckSizeHeader = "claim-check-size"
+)
+
+// ErrBlobNotFound is returned by a BlobStore for a key it doesn't have, e.g. because it expired.
+var ErrBlobNotFound = errors.New("blob not found")
+
+// BlobStore holds payloads too large to go through the brokers.
+type BlobStore interface {
+	Put(ctx context.Context, key string, data []byte) error
+	// Get returns ErrBlobNotFound if there is nothing under key.
+	Get(ctx context.Context, key string) ([]byte, error)
+	// Expire deletes what was put before the given time and returns how many blobs it deleted.
+	Expire(ctx context.Context, before time.Time) (int, error)
+}
+
+// NewClaimCheckClient wraps c so its writers put payloads larger than threshold bytes in store and write
+// only a reference in the claim-check header, and its readers fetch them back before returning the message.
+// Payloads written in CloudEvents structured mode are stored before they are put in the envelope, so
+// claim checked messages should be written in binary mode.
+//
+// A message whose payload can't be fetched is returned together with the error. For a payload that
+// is gone the error is a *DecodeError, so workers send it to the dead letter topic rather than retry.
+// Otherwise Message.Fetch tries to fetch it again.
+func NewClaimCheckClient(c Client, store BlobStore, threshold int) Client {
+	return &claimCheckClient{c: c, store: store, threshold: threshold}
+}
+
+type claimCheckClient struct {
+	c         Client
+	store     BlobStore
+	threshold int
+}
+
+func (c *claimCheckClient) Reader(ctx context.Context, topicConfig Config) (Reader, error) {
+	r, err := c.c.Reader(ctx, topicConfig)
+	if err != nil {
+		return nil, err
+	}
+	return &claimCheckReader{Reader: r, store: c.store}, nil
+}
+
+func (c *claimCheckClient) Writer(ctx context.Context, topicConfig Config) (Writer, error) {
+	w, err := c.c.Writer(ctx, topicConfig)
+	if err != nil {
+		return nil, err
+	}
+	return &claimCheckWriter{w: w, topic: topicConfig.Topic, store: c.store, threshold: c.threshold}, nil
+}
+
+type claimCheckWriter struct {
+	w         Writer
+	topic     string
+	store     BlobStore
+	threshold int
+}
+
+func (w *claimCheckWriter) Write(ctx context.Context, key string, value []byte, options ...WriteOption) (Response, error) {
+	value, claim, err := w.check(ctx, value)
+	if err != nil {
+		return Response{}, err
+	}
+	// options belongs to the caller, appending to it could write into their spare capacity.
+	return w.w.Write(ctx, key, value, append(append([]WriteOption(nil), options...), claim...)...)
+}
+
+func (w *claimCheckWriter) WriteBatch(ctx context.Context, records []Record) ([]Response, error) {
+	checked := make([]Record, len(records))
+	for i, r := range records {
+		var err error
+		if checked[i], err = w.checkRecord(ctx, r); err != nil {
+			return make([]Response, len(records)), err
+		}
+	}
+	return w.w.WriteBatch(ctx, checked)
+}
+
+func (w *claimCheckWriter) WriteAsync(ctx context.Context, record Record, onDelivery func(Delivery)) {
+	checked, err := w.checkRecord(ctx, record)
+	if err != nil {
+		if onDelivery != nil {
+			onDelivery(Delivery{Record: record, Err: err})
+		}
+		return
+	}
+	w.w.WriteAsync(ctx, checked, func(d Delivery) {
+		if onDelivery != nil {
+			d.Record = record
+			onDelivery(d)
+		}
+	})
+}
+
+func (w *claimCheckWriter) Flush(ctx context.Context) error { return w.w.Flush(ctx) }
+
+// check stores value if it is over the threshold and returns what to write instead.
+func (w *claimCheckWriter) check(ctx context.Context, value []byte) ([]byte, []WriteOption, error) {
+	if len(value) <= w.threshold {
+		return value, nil, nil
+	}
+	key := w.topic + "/" + newID()
+	if err := w.store.Put(ctx, key, value); err != nil {
+		return nil, nil, errors.Wrapf(err, "failed to store %d byte payload for %s", len(value), w.topic)
+	}
+	return nil, []WriteOption{
+		WithHeader(ClaimCheckHeader, key),
+		WithHeader(ClaimCheckSizeHeader, strconv.Itoa(len(value))),
+	}, nil
+}
+
+func (w *claimCheckWriter) checkRecord(ctx context.Context, r Record) (Record, error) {
+	value, claim, err := w.check(ctx, r.Value)
+	if err != nil || claim == nil {
+		return r, err
+	}
+	msg := &Message{Headers: r.Headers.clone()}
+	for _, option := range claim {
+		option.apply(msg)
+	}
+	return Record{Key: r.Key, Value: value, Headers: msg.Headers}, nil
+}
+
+type claimCheckReader struct {
+	Reader
+	store BlobStore
+}
+
+func (r *claimCheckReader) Read(ctx context.Context) (*Message, error) {
+	msg, err := r.Reader.Read(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if err := r.fetch(ctx, msg); err != nil {
+		// The store may be back by the time the message is retried.
+		var decodeErr *DecodeError
+		if !errors.As(err, &decodeErr) {
+			msg.fetch = func(ctx context.Context) error { return r.fetch(ctx, msg) }
+		}
+		return msg, err
+	}
+	return msg, nil
+}
+
+// fetch puts the claim checked payload in msg.
+func (r *claimCheckReader) fetch(ctx context.Context, msg *Message) error {
+	key, ok := msg.Headers.Lookup(ClaimCheckHeader)
+	if !ok {
+		return nil
+	}
+
+	value, err := r.store.Get(ctx, string(key))
+	if errors.Is(err, ErrBlobNotFound) {
+		return &DecodeError{
+			Topic:       msg.Topic,
+			Partition:   msg.Partition,
+			Offset:      msg.Offset,
+			ContentType: msg.Headers.Get(ContentTypeHeader),
+			Err:         errors.Wrapf(err, "claim check %s", key),
+		}
+	}
+	if err != nil {
+		return errors.Wrapf(err, "failed to fetch claim check %s", key)
+	}
+	msg.value = value
+	msg.fetch = nil
+	return nil
+}
+
+// ExpireBlobs deletes blobs from store once they are older than retention, checking every interval until ctx is done.
+// Retention should be at least the topic's retention.ms, so no message outlives its payload.
+func ExpireBlobs(ctx context.Context, store BlobStore, retention, interval time.Duration, logger Logger) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := store.Expire(ctx, time.Now().Add(-retention)); err != nil && logger != nil {
+				logger.Error(ctx, "failed to expire claim check blobs", "error", err)
+			}
+		}
+	}
+}
+
+var _ BlobStore = (*FileBlobStore)(nil)
+
+// FileBlobStore keeps blobs as files under a directory. It is meant for local development and tests,
+// or a volume every producer and consumer mounts.
+type FileBlobStore struct {
+	dir string
+}
+
+// NewFileBlobStore stores blobs under dir, creating it if needed.
+func NewFileBlobStore(dir string) (*FileBlobStore, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, errors.Wrapf(err, "failed to create blob dir %s", dir)
+	}
+	return &FileBlobStore{dir: dir}, nil
+}
+
+func (s *FileBlobStore) Put(_ context.Context, key string, data []byte) error {
+	path, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return errors.Wrap(err, "failed to create blob dir")
+	}
+	// Write then rename, so readers never see a partial blob.
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".tmp-")
+	if err != nil {
+		return errors.Wrap(err, "failed to create blob")
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return errors.Wrap(err, "failed to write blob")
+	}
+	if err := tmp.Close(); err != nil {
+		return errors.Wrap(err, "failed to write blob")
+	}
+	return errors.Wrap(os.Rename(tmp.Name(), path), "failed to write blob")
+}
+
+func (s *FileBlobStore) Get(_ context.Context, key string) ([]byte, error) {
+	path, err := s.path(key)
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, ErrBlobNotFound
+	}
+	return data, errors.Wrap(err, "failed to read blob")
+}
+
+func (s *FileBlobStore) Expire(ctx context.Context, before time.Time) (int, error) {
+	n := 0
+	err := filepath.WalkDir(s.dir, func(path string, d os.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		if info.ModTime().Before(before) {
+			if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+				return err
+			}
+			n++
+		}
+		return nil
+	})
+	return n, errors.Wrap(err, "failed to expire blobs")
+}
+
+// path maps key to a file under dir, refusing keys that would escape it.
+func (s *FileBlobStore) path(key string) (string, error) {
+	clean := filepath.Clean(filepath.FromSlash(key))
+	if key == "" || filepath.IsAbs(clean) || clean == ".." || strings.HasPrefix(clean, ".."+string(filepath.Separator)) {
+		return "", errors.Errorf("invalid blob key %q", key)
+	}
+	return filepath.Join(s.dir, clean), nil
+}
@@ -0,0 +1,80 @@
+package kafka
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func Test_ClaimCheckClient_StoresLargePayloads(t *testing.T) {
+	ctx := context.Background()
+	store, err := NewFileBlobStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	mem := NewMemoryClient()
+	c := NewClaimCheckClient(mem, store, 16)
+
+	w, _ := c.Writer(ctx, Config{Topic: "listings"})
+	large := bytes.Repeat([]byte("x"), 100)
+	_, _ = w.Write(ctx, "1", []byte("small"))
+	_, _ = w.Write(ctx, "2", large)
+
+	written := mem.Messages("listings")
+	if written[0].Headers.Get(ClaimCheckHeader) != "" || string(written[0].Value()) != "small" {
+		t.Errorf("small payload should be written as is")
+	}
+	if written[1].Headers.Get(ClaimCheckHeader) == "" || len(written[1].Value()) != 0 || written[1].Headers.Get(ClaimCheckSizeHeader) != "100" {
+		t.Errorf("large payload should be replaced by a claim check, got headers %v", written[1].Headers)
+	}
+
+	r, _ := c.Reader(ctx, Config{Topic: "listings"})
+	_, _ = r.Read(ctx)
+	msg, err := r.Read(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(msg.Value(), large) {
+		t.Errorf("expected the stored payload back, got %d bytes", len(msg.Value()))
+	}
+
+	if n, err := store.Expire(ctx, time.Now().Add(time.Minute)); err != nil || n != 1 {
+		t.Fatalf("expected one expired blob, got %d, %v", n, err)
+	}
+	r, _ = c.Reader(ctx, Config{Topic: "listings"})
+	_, _ = r.Read(ctx)
+	msg, err = r.Read(ctx)
+	var decodeErr *DecodeError
+	if msg == nil || !errors.As(err, &decodeErr) || !errors.Is(err, ErrBlobNotFound) {
+		t.Errorf("expected the message with a DecodeError for an expired blob, got %v, %v", msg, err)
+	}
+}
+
+func Test_ClaimCheckWriter_LeavesCallersOptionsAlone(t *testing.T) {
+	ctx := context.Background()
+	store, err := NewFileBlobStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	w, _ := NewClaimCheckClient(NewMemoryClient(), store, 16).Writer(ctx, Config{Topic: "listings"})
+
+	options := make([]WriteOption, 1, 4)
+	options[0] = WithHeader("tenant", "zillow")
+	if _, err := w.Write(ctx, "1", bytes.Repeat([]byte("x"), 100), options...); err != nil {
+		t.Fatal(err)
+	}
+	if spare := options[:2][1]; spare != nil {
+		t.Errorf("expected the claim check not to be appended into the caller's slice, got %v", spare)
+	}
+}
+
+func Test_FileBlobStore_RejectsKeysOutsideDir(t *testing.T) {
+	store, _ := NewFileBlobStore(t.TempDir())
+	for _, key := range []string{"", "../x", "/etc/passwd", "a/../../x"} {
+		if err := store.Put(context.Background(), key, []byte("x")); err == nil {
+			t.Errorf("expected key %q to be rejected", key)
+		}
+	}
+}
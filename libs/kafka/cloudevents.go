@@ -0,0 +1,301 @@
+package kafka
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// CloudEvents attributes as headers, per the Kafka protocol binding of the CloudEvents 1.0 spec.
+// Writers stamp ce_specversion, ce_id and ce_time on every message, WithEvent adds ce_source and ce_type.
+const (
+	CloudEventsSpecVersion = "1.0"
+	// CloudEventsContentType is the content-type of a message written in structured mode.
+	CloudEventsContentType = "application/cloudevents+json"
+
+	CloudEventsHeaderPrefix = "ce_"
+	SpecVersionHeader       = CloudEventsHeaderPrefix + "specversion"
+	// IDHeader uniquely identifies a write. Retries of the same write keep it, so consumers can drop duplicates.
+	IDHeader         = CloudEventsHeaderPrefix + "id"
+	SourceHeader     = CloudEventsHeaderPrefix + "source"
+	TypeHeader       = CloudEventsHeaderPrefix + "type"
+	TimeHeader       = CloudEventsHeaderPrefix + "time"
+	SubjectHeader    = CloudEventsHeaderPrefix + "subject"
+	DataSchemaHeader = CloudEventsHeaderPrefix + "dataschema"
+)
+
+// Headers stamped by writers before they moved to CloudEvents attributes.
+// Message.Event still reads them, so messages written by older writers keep their id and time.
+const (
+	// Deprecated: use TimeHeader.
+	TimestampHeader = "timestamp"
+	// Deprecated: use IDHeader.
+	GUIDHeader = "guid"
+)
+
+// Event is the CloudEvents view of a message, whichever content mode it was written in.
+type Event struct {
+	SpecVersion     string
+	ID              string
+	Source          string
+	Type            string
+	Time            time.Time
+	Subject         string
+	DataSchema      string
+	DataContentType string
+	// Extensions holds any other attributes, e.g. ce_partitionkey, without the ce_ prefix.
+	Extensions map[string]string
+	Data       []byte
+}
+
+// Validate checks the event has the attributes the spec requires.
+func (e Event) Validate() error {
+	var missing []string
+	for _, a := range []struct{ name, value string }{
+		{"specversion", e.SpecVersion},
+		{"id", e.ID},
+		{"source", e.Source},
+		{"type", e.Type},
+	} {
+		if a.value == "" {
+			missing = append(missing, a.name)
+		}
+	}
+	if len(missing) > 0 {
+		return errors.Errorf("cloudevent is missing required attributes %s", strings.Join(missing, ", "))
+	}
+	return nil
+}
+
+// Event returns the message as a CloudEvent. Structured mode messages are decoded from the value,
+// binary mode ones from the ce_ headers. Messages written before CloudEvents get their id and time
+// from the guid and timestamp headers. Use Event.Validate to check the producer set source and type.
+func (m *Message) Event() (Event, error) {
+	if isStructured(m.Headers.Get(ContentTypeHeader)) {
+		return decodeStructured(m.value)
+	}
+
+	e := Event{
+		SpecVersion:     m.Headers.Get(SpecVersionHeader),
+		ID:              m.Headers.Get(IDHeader),
+		Source:          m.Headers.Get(SourceHeader),
+		Type:            m.Headers.Get(TypeHeader),
+		Subject:         m.Headers.Get(SubjectHeader),
+		DataSchema:      m.Headers.Get(DataSchemaHeader),
+		DataContentType: m.Headers.Get(ContentTypeHeader),
+		Data:            m.value,
+	}
+	if t := m.Headers.Get(TimeHeader); t != "" {
+		var err error
+		if e.Time, err = time.Parse(time.RFC3339Nano, t); err != nil {
+			return Event{}, errors.Wrapf(err, "invalid %s header", TimeHeader)
+		}
+	}
+	for _, h := range m.Headers {
+		if name, ok := strings.CutPrefix(h.Key, CloudEventsHeaderPrefix); ok && !bindingAttributes[name] {
+			if e.Extensions == nil {
+				e.Extensions = make(map[string]string)
+			}
+			e.Extensions[name] = string(h.Value)
+		}
+	}
+
+	if e.ID == "" {
+		e.ID = m.Headers.Get(GUIDHeader)
+	}
+	if e.Time.IsZero() {
+		e.Time = parseLegacyTimestamp(m.Headers.Get(TimestampHeader))
+	}
+	if e.SpecVersion == "" && e.ID == "" {
+		return Event{}, errors.Errorf("message at %s/%d/%d is not a cloudevent", m.Topic, m.Partition, m.Offset)
+	}
+	return e, nil
+}
+
+// EventID returns the CloudEvents id of the message, or "" if it has none.
+func (m *Message) EventID() string {
+	e, err := m.Event()
+	if err != nil {
+		return ""
+	}
+	return e.ID
+}
+
+// WithEvent provides option to set the CloudEvents source and type of the written message.
+func WithEvent(source, eventType string) WriteOption { return eventOption{source, eventType} }
+
+type eventOption struct{ source, eventType string }
+
+func (e eventOption) apply(m *Message) {
+	m.Headers.Set(SourceHeader, e.source)
+	m.Headers.Set(TypeHeader, e.eventType)
+}
+
+// WithEventSubject provides option to set the CloudEvents subject of the written message.
+func WithEventSubject(subject string) WriteOption { return headerOption{SubjectHeader, subject} }
+
+// Structured provides option to write the message in CloudEvents structured mode: the attributes and the value
+// go together in a JSON envelope with content-type application/cloudevents+json. Default is binary mode,
+// where the value is written as is and the attributes go in ce_ headers.
+func Structured() WriteOption { return structuredOption{} }
+
+type structuredOption struct{}
+
+func (structuredOption) apply(m *Message) { m.structured = true }
+
+// bindingAttributes are the attributes with their own Event field, everything else under ce_ is an extension.
+var bindingAttributes = map[string]bool{
+	"specversion": true, "id": true, "source": true, "type": true,
+	"time": true, "subject": true, "dataschema": true,
+}
+
+// stampEvent sets the attributes every writer adds unless the caller set them already,
+// so forwarded messages, e.g. to a retry or dead letter topic, keep their id.
+// Messages already in structured mode carry their attributes in the envelope.
+func stampEvent(m *Message) {
+	if isStructured(m.Headers.Get(ContentTypeHeader)) {
+		return
+	}
+	if _, ok := m.Headers.Lookup(IDHeader); !ok {
+		m.Headers.Set(IDHeader, newID())
+	}
+	if _, ok := m.Headers.Lookup(TimeHeader); !ok {
+		m.Headers.Set(TimeHeader, time.Now().UTC().Format(time.RFC3339Nano))
+	}
+	m.Headers.Set(SpecVersionHeader, CloudEventsSpecVersion)
+}
+
+// envelope is the JSON format of a structured mode event.
+type envelope struct {
+	SpecVersion     string          `json:"specversion"`
+	ID              string          `json:"id"`
+	Source          string          `json:"source,omitempty"`
+	Type            string          `json:"type,omitempty"`
+	Time            string          `json:"time,omitempty"`
+	Subject         string          `json:"subject,omitempty"`
+	DataSchema      string          `json:"dataschema,omitempty"`
+	DataContentType string          `json:"datacontenttype,omitempty"`
+	Data            json.RawMessage `json:"data,omitempty"`
+	DataBase64      string          `json:"data_base64,omitempty"`
+}
+
+// toStructured moves the ce_ headers and the value of m into a structured mode envelope.
+func toStructured(m *Message) error {
+	e, err := m.Event()
+	if err != nil {
+		return err
+	}
+
+	raw, err := json.Marshal(envelopeOf(e))
+	if err == nil && len(e.Extensions) > 0 {
+		// Extensions are top level attributes next to the standard ones.
+		attrs := map[string]interface{}{}
+		for k, v := range e.Extensions {
+			attrs[k] = v
+		}
+		if err = json.Unmarshal(raw, &attrs); err == nil {
+			raw, err = json.Marshal(attrs)
+		}
+	}
+	if err != nil {
+		return errors.Wrap(err, "failed to encode cloudevent")
+	}
+
+	for _, h := range m.Headers.clone() {
+		if strings.HasPrefix(h.Key, CloudEventsHeaderPrefix) {
+			m.Headers.Del(h.Key)
+		}
+	}
+	m.Headers.Set(ContentTypeHeader, CloudEventsContentType)
+	m.value = raw
+	return nil
+}
+
+func envelopeOf(e Event) envelope {
+	env := envelope{
+		SpecVersion:     e.SpecVersion,
+		ID:              e.ID,
+		Source:          e.Source,
+		Type:            e.Type,
+		Subject:         e.Subject,
+		DataSchema:      e.DataSchema,
+		DataContentType: e.DataContentType,
+	}
+	if !e.Time.IsZero() {
+		env.Time = e.Time.UTC().Format(time.RFC3339Nano)
+	}
+	if isJSON(e.DataContentType) && json.Valid(e.Data) {
+		env.Data = e.Data
+	} else if len(e.Data) > 0 {
+		env.DataBase64 = base64.StdEncoding.EncodeToString(e.Data)
+	}
+	return env
+}
+
+func decodeStructured(value []byte) (Event, error) {
+	var env envelope
+	if err := json.Unmarshal(value, &env); err != nil {
+		return Event{}, errors.Wrap(err, "failed to decode structured cloudevent")
+	}
+	e := Event{
+		SpecVersion:     env.SpecVersion,
+		ID:              env.ID,
+		Source:          env.Source,
+		Type:            env.Type,
+		Subject:         env.Subject,
+		DataSchema:      env.DataSchema,
+		DataContentType: env.DataContentType,
+		Data:            []byte(env.Data),
+	}
+	if env.Time != "" {
+		var err error
+		if e.Time, err = time.Parse(time.RFC3339Nano, env.Time); err != nil {
+			return Event{}, errors.Wrap(err, "invalid cloudevent time")
+		}
+	}
+	if env.DataBase64 != "" {
+		var err error
+		if e.Data, err = base64.StdEncoding.DecodeString(env.DataBase64); err != nil {
+			return Event{}, errors.Wrap(err, "invalid cloudevent data_base64")
+		}
+	}
+
+	var attrs map[string]json.RawMessage
+	_ = json.Unmarshal(value, &attrs)
+	for name, v := range attrs {
+		var s string
+		if _, known := envelopeAttributes[name]; known || json.Unmarshal(v, &s) != nil {
+			continue
+		}
+		if e.Extensions == nil {
+			e.Extensions = make(map[string]string)
+		}
+		e.Extensions[name] = s
+	}
+	return e, nil
+}
+
+var envelopeAttributes = map[string]struct{}{
+	"specversion": {}, "id": {}, "source": {}, "type": {}, "time": {}, "subject": {},
+	"dataschema": {}, "datacontenttype": {}, "data": {}, "data_base64": {},
+}
+
+func isStructured(contentType string) bool {
+	return strings.HasPrefix(contentType, CloudEventsContentType)
+}
+
+// isJSON reports whether data of contentType can be embedded in the envelope as JSON. No content type means JSON.
+func isJSON(contentType string) bool {
+	ct, _, _ := strings.Cut(contentType, ";")
+	return ct == "" || ct == "application/json" || strings.HasSuffix(ct, "+json") || ct == "text/json"
+}
+
+// parseLegacyTimestamp parses the timestamp header older writers set with time.Now().String().
+func parseLegacyTimestamp(s string) time.Time {
+	s, _, _ = strings.Cut(s, " m=")
+	t, _ := time.Parse("2006-01-02 15:04:05.999999999 -0700 MST", s)
+	return t
+}
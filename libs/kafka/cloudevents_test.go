@@ -0,0 +1,90 @@
+package kafka
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func Test_Writer_BinaryModeEvent(t *testing.T) {
+	ctx := context.Background()
+	c := NewMemoryClient()
+	w, _ := c.Writer(ctx, Config{Topic: "listings"})
+
+	_, err := NewTypedWriter[listing](w, JSON).Write(ctx, "1", listing{Zpid: 1, Price: "100"},
+		WithEvent("/listings-service", "com.zillow.listing.created"),
+		WithHeader("ce_partitionkey", "1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	msg := c.Messages("listings")[0]
+	e, err := msg.Event()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := e.Validate(); err != nil {
+		t.Error(err)
+	}
+	if e.Type != "com.zillow.listing.created" || e.DataContentType != "application/json" || e.ID != msg.Headers.Get(IDHeader) {
+		t.Errorf("unexpected event %+v", e)
+	}
+	if time.Since(e.Time) > time.Minute || e.Extensions["partitionkey"] != "1" {
+		t.Errorf("unexpected time %v or extensions %v", e.Time, e.Extensions)
+	}
+}
+
+func Test_Writer_StructuredModeEvent(t *testing.T) {
+	ctx := context.Background()
+	c := NewMemoryClient()
+	w, _ := c.Writer(ctx, Config{Topic: "listings"})
+
+	_, err := NewTypedWriter[listing](w, JSON).Write(ctx, "1", listing{Zpid: 1, Price: "100"},
+		WithEvent("/listings-service", "com.zillow.listing.created"), Structured())
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _ = w.Write(ctx, "2", []byte{0xff}, WithEvent("/listings-service", "com.zillow.listing.raw"), Structured())
+
+	msgs := c.Messages("listings")
+	if ct := msgs[0].Headers.Get(ContentTypeHeader); ct != CloudEventsContentType {
+		t.Fatalf("unexpected content type %q", ct)
+	}
+	if _, ok := msgs[0].Headers.Lookup(IDHeader); ok {
+		t.Error("expected no ce_ headers in structured mode")
+	}
+
+	got, err := Decode[listing](msgs[0], JSON)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != (listing{Zpid: 1, Price: "100"}) {
+		t.Errorf("unexpected value %+v", got)
+	}
+	e, err := msgs[1].Event()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e.ID == "" || e.Type != "com.zillow.listing.raw" || string(e.Data) != "\xff" {
+		t.Errorf("unexpected event %+v", e)
+	}
+}
+
+func Test_Message_EventFromLegacyHeaders(t *testing.T) {
+	now := time.Now()
+	msg := &Message{Headers: Headers{
+		{Key: TimestampHeader, Value: []byte(now.String())},
+		{Key: GUIDHeader, Value: []byte("b8a3")},
+	}}
+
+	e, err := msg.Event()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e.ID != "b8a3" || !e.Time.Equal(now.Round(0)) {
+		t.Errorf("unexpected event %+v", e)
+	}
+	if _, err := (&Message{}).Event(); err == nil {
+		t.Error("expected an error for a message without event attributes")
+	}
+}
@@ -0,0 +1,213 @@
+package kafka
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+
+	"github.com/pkg/errors"
+	"google.golang.org/protobuf/proto"
+)
+
+// ContentTypeHeader is the header writers use to describe how the payload is encoded.
+const ContentTypeHeader = "content-type"
+
+// Codec encodes and decodes message payloads.
+type Codec interface {
+	ContentType() string
+	Marshal(v interface{}) ([]byte, error)
+	Unmarshal(data []byte, v interface{}) error
+}
+
+var (
+	// JSON encodes payloads with encoding/json.
+	JSON Codec = jsonCodec{}
+	// Protobuf encodes payloads that implement proto.Message.
+	Protobuf Codec = protobufCodec{}
+	// Raw passes []byte payloads through untouched.
+	Raw Codec = rawCodec{}
+)
+
+// DecodeError is returned when a message payload can't be decoded.
+// Retrying won't help, so workers should send these messages to the dead letter topic straight away.
+type DecodeError struct {
+	Topic       string
+	Partition   int32
+	Offset      int64
+	ContentType string
+	Err         error
+}
+
+func (e *DecodeError) Error() string {
+	return fmt.Sprintf("failed to decode %s message at %s/%d/%d: %v", e.ContentType, e.Topic, e.Partition, e.Offset, e.Err)
+}
+
+func (e *DecodeError) Unwrap() error { return e.Err }
+
+// TransientError is returned by a codec that failed for a reason other than the payload, e.g. a schema registry
+// that couldn't be reached. Decode returns it as it is rather than as a *DecodeError, so the message is retried.
+type TransientError struct {
+	Err error
+}
+
+func (e *TransientError) Error() string { return e.Err.Error() }
+
+func (e *TransientError) Unwrap() error { return e.Err }
+
+// Decode decodes the message payload with codec. For a CloudEvents structured mode message that is the event data.
+// A *DecodeError is returned if the payload is malformed or was written with a different content type,
+// other errors, e.g. a codec's *TransientError, are worth retrying.
+func Decode[T any](msg *Message, codec Codec) (T, error) {
+	var v T
+
+	decodeErr := func(err error) error {
+		return &DecodeError{
+			Topic:       msg.Topic,
+			Partition:   msg.Partition,
+			Offset:      msg.Offset,
+			ContentType: codec.ContentType(),
+			Err:         err,
+		}
+	}
+
+	ct, data := msg.Headers.Get(ContentTypeHeader), msg.value
+	if isStructured(ct) {
+		e, err := msg.Event()
+		if err != nil {
+			return v, decodeErr(err)
+		}
+		ct, data = e.DataContentType, e.Data
+	}
+	if ct != "" && ct != codec.ContentType() {
+		return v, decodeErr(errors.Errorf("unexpected content type %s", ct))
+	}
+	if err := codec.Unmarshal(data, &v); err != nil {
+		var transient *TransientError
+		if errors.As(err, &transient) {
+			return v, errors.Wrapf(err, "failed to decode message at %s/%d/%d", msg.Topic, msg.Partition, msg.Offset)
+		}
+		return v, decodeErr(err)
+	}
+	return v, nil
+}
+
+// TypedWriter writes values of type T encoded with its codec.
+type TypedWriter[T any] struct {
+	w     Writer
+	codec Codec
+}
+
+// NewTypedWriter wraps w so it writes values of type T encoded with codec.
+func NewTypedWriter[T any](w Writer, codec Codec) TypedWriter[T] {
+	return TypedWriter[T]{w: w, codec: codec}
+}
+
+// Write encodes v and writes it with a content-type header.
+func (t TypedWriter[T]) Write(ctx context.Context, key string, v T, options ...WriteOption) (Response, error) {
+	value, err := t.codec.Marshal(v)
+	if err != nil {
+		return Response{}, errors.Wrap(err, "failed to encode kafka message")
+	}
+	options = append(options, WithHeader(ContentTypeHeader, t.codec.ContentType()))
+	return t.w.Write(ctx, key, value, options...)
+}
+
+// TypedReader reads values of type T encoded with its codec.
+type TypedReader[T any] struct {
+	r     Reader
+	codec Codec
+}
+
+// NewTypedReader wraps r so it reads values of type T encoded with codec.
+func NewTypedReader[T any](r Reader, codec Codec) TypedReader[T] {
+	return TypedReader[T]{r: r, codec: codec}
+}
+
+// Read reads the next message and decodes it. If decoding fails the message is still returned
+// alongside a *DecodeError, so it can be marked done or sent to a dead letter topic.
+func (t TypedReader[T]) Read(ctx context.Context) (*Message, T, error) {
+	var v T
+	msg, err := t.r.Read(ctx)
+	if err != nil {
+		return nil, v, err
+	}
+	v, err = Decode[T](msg, t.codec)
+	return msg, v, err
+}
+
+// Commit commits the underlying reader.
+func (t TypedReader[T]) Commit(ctx context.Context) error { return t.r.Commit(ctx) }
+
+// Seek moves the underlying reader.
+func (t TypedReader[T]) Seek(ctx context.Context, to Position) error { return t.r.Seek(ctx, to) }
+
+// Pause pauses partitions of the underlying reader.
+func (t TypedReader[T]) Pause(partitions ...int32) { t.r.Pause(partitions...) }
+
+// Resume resumes partitions of the underlying reader.
+func (t TypedReader[T]) Resume(partitions ...int32) { t.r.Resume(partitions...) }
+
+// Assignment returns the underlying reader's partitions.
+func (t TypedReader[T]) Assignment() []int32 { return t.r.Assignment() }
+
+// Close closes the underlying reader.
+func (t TypedReader[T]) Close() error { return t.r.Close() }
+
+type jsonCodec struct{}
+
+func (jsonCodec) ContentType() string { return "application/json" }
+
+func (jsonCodec) Marshal(v interface{}) ([]byte, error) { return json.Marshal(v) }
+
+func (jsonCodec) Unmarshal(data []byte, v interface{}) error { return json.Unmarshal(data, v) }
+
+type protobufCodec struct{}
+
+func (protobufCodec) ContentType() string { return "application/x-protobuf" }
+
+func (protobufCodec) Marshal(v interface{}) ([]byte, error) {
+	m, ok := v.(proto.Message)
+	if !ok {
+		return nil, errors.Errorf("%T is not a proto.Message", v)
+	}
+	return proto.Marshal(m)
+}
+
+func (protobufCodec) Unmarshal(data []byte, v interface{}) error {
+	// Decode passes a pointer to the typed value, which for protobuf is itself a pointer. Allocate it if needed.
+	rv := reflect.ValueOf(v)
+	if rv.Kind() == reflect.Ptr && rv.Elem().Kind() == reflect.Ptr {
+		if rv.Elem().IsNil() {
+			rv.Elem().Set(reflect.New(rv.Elem().Type().Elem()))
+		}
+		v = rv.Elem().Interface()
+	}
+
+	m, ok := v.(proto.Message)
+	if !ok {
+		return errors.Errorf("%T is not a proto.Message", v)
+	}
+	return proto.Unmarshal(data, m)
+}
+
+type rawCodec struct{}
+
+func (rawCodec) ContentType() string { return "application/octet-stream" }
+
+func (rawCodec) Marshal(v interface{}) ([]byte, error) {
+	b, ok := v.([]byte)
+	if !ok {
+		return nil, errors.Errorf("%T is not a []byte", v)
+	}
+	return b, nil
+}
+
+func (rawCodec) Unmarshal(data []byte, v interface{}) error {
+	b, ok := v.(*[]byte)
+	if !ok {
+		return errors.Errorf("%T is not a *[]byte", v)
+	}
+	*b = data
+	return nil
+}
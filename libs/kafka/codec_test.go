@@ -0,0 +1,76 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+type listing struct {
+	Zpid  int    `json:"zpid"`
+	Price string `json:"price"`
+}
+
+func Test_TypedWriterAndReader_JSON(t *testing.T) {
+	ctx := context.Background()
+	c := NewMemoryClient()
+	w, _ := c.Writer(ctx, Config{Topic: "listings"})
+	r, _ := c.Reader(ctx, Config{Topic: "listings"})
+
+	_, err := NewTypedWriter[listing](w, JSON).Write(ctx, "1", listing{Zpid: 1, Price: "100"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	msg, got, err := NewTypedReader[listing](r, JSON).Read(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg.Headers.Get(ContentTypeHeader) != "application/json" {
+		t.Errorf("unexpected content type %q", msg.Headers.Get(ContentTypeHeader))
+	}
+	if got != (listing{Zpid: 1, Price: "100"}) {
+		t.Errorf("unexpected value %+v", got)
+	}
+}
+
+func Test_Decode_Protobuf(t *testing.T) {
+	ctx := context.Background()
+	c := NewMemoryClient()
+	w, _ := c.Writer(ctx, Config{Topic: "listings"})
+
+	_, err := NewTypedWriter[*wrapperspb.StringValue](w, Protobuf).Write(ctx, "1", wrapperspb.String("hello"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := Decode[*wrapperspb.StringValue](c.Messages("listings")[0], Protobuf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.GetValue() != "hello" {
+		t.Errorf("unexpected value %q", got.GetValue())
+	}
+}
+
+func Test_Decode_ReturnsDecodeError(t *testing.T) {
+	ctx := context.Background()
+	c := NewMemoryClient()
+	w, _ := c.Writer(ctx, Config{Topic: "listings"})
+
+	_, _ = w.Write(ctx, "1", []byte("not json"))
+	_, _ = NewTypedWriter[[]byte](w, Raw).Write(ctx, "2", []byte("raw"))
+
+	for _, msg := range c.Messages("listings") {
+		_, err := Decode[listing](msg, JSON)
+		var decodeErr *DecodeError
+		if !errors.As(err, &decodeErr) {
+			t.Fatalf("expected a DecodeError, got %v", err)
+		}
+		if decodeErr.Offset != msg.Offset {
+			t.Errorf("expected offset %d on error, got %d", msg.Offset, decodeErr.Offset)
+		}
+	}
+}
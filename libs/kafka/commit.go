@@ -0,0 +1,128 @@
+package kafka
+
+import (
+	"sync"
+)
+
+// Commit modes accepted in Config.CommitMode.
+const (
+	// CommitAuto commits done messages every Config.CommitInterval. This is the default.
+	CommitAuto = "auto"
+	// CommitManual commits done messages only when Reader.Commit is called.
+	CommitManual = "manual"
+)
+
+// commitTracker works out how far each partition can safely be committed while messages are processed concurrently.
+// Messages can finish in any order, so a partition is only committed up to the first message that isn't done yet.
+// Anything after it will be redelivered if the consumer goes away, but nothing before it is ever skipped.
+type commitTracker struct {
+	mtx        sync.Mutex
+	partitions map[int32]*partitionOffsets
+}
+
+type partitionOffsets struct {
+	// pending holds delivered offsets in delivery order. Offsets need not be consecutive, compaction and
+	// transaction markers leave gaps, so the commit point follows delivery order rather than arithmetic.
+	pending    []commitOffset
+	done       map[int64]struct{}
+	commitable commitOffset
+	committed  int64
+}
+
+// commitOffset is an offset together with the leader epoch of the record it follows.
+// Brokers use the epoch to detect truncation when a consumer resumes from the commit.
+type commitOffset struct {
+	offset int64
+	epoch  int32
+}
+
+func newCommitTracker() *commitTracker {
+	return &commitTracker{partitions: make(map[int32]*partitionOffsets)}
+}
+
+// track records that the message at offset was handed out. It returns the partition's offsets to mark it done in.
+func (t *commitTracker) track(partition int32, offset int64, epoch int32) *partitionOffsets {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+
+	p, ok := t.partitions[partition]
+	// Going backwards means the partition was reassigned or rewound, what was pending will come again.
+	if !ok || (len(p.pending) > 0 && offset <= p.pending[len(p.pending)-1].offset) {
+		p = &partitionOffsets{
+			done:       make(map[int64]struct{}),
+			commitable: commitOffset{offset: -1, epoch: -1},
+			committed:  -1,
+		}
+		t.partitions[partition] = p
+	}
+	p.pending = append(p.pending, commitOffset{offset: offset, epoch: epoch})
+	return p
+}
+
+// done records that the message at offset was processed.
+func (t *commitTracker) done(partition int32, offset int64) {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+
+	if p, ok := t.partitions[partition]; ok {
+		p.markDone(offset)
+	}
+}
+
+// doneIn records that the message at offset, tracked in p, was processed. Once the partition was revoked or
+// rewound p is detached, so a message read before can't mark the offset done when it is delivered again.
+func (t *commitTracker) doneIn(p *partitionOffsets, offset int64) {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+	p.markDone(offset)
+}
+
+// markDone records that the message at offset was processed. Callers must hold the tracker's mtx.
+func (p *partitionOffsets) markDone(offset int64) {
+	p.done[offset] = struct{}{}
+	for len(p.pending) > 0 {
+		head := p.pending[0]
+		if _, ok := p.done[head.offset]; !ok {
+			break
+		}
+		delete(p.done, head.offset)
+		p.pending = p.pending[1:]
+		p.commitable = commitOffset{offset: head.offset + 1, epoch: head.epoch}
+	}
+}
+
+// commitable returns, per partition, the offset to commit where it moved since the last commit.
+func (t *commitTracker) commitable() map[int32]commitOffset {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+
+	offsets := make(map[int32]commitOffset)
+	for partition, p := range t.partitions {
+		if p.commitable.offset > p.committed {
+			offsets[partition] = p.commitable
+		}
+	}
+	return offsets
+}
+
+// committed records that offsets were committed.
+func (t *commitTracker) committed(offsets map[int32]commitOffset) {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+
+	for partition, o := range offsets {
+		if p, ok := t.partitions[partition]; ok && o.offset > p.committed {
+			p.committed = o.offset
+		}
+	}
+}
+
+// revoke forgets partitions that are no longer assigned to this consumer.
+func (t *commitTracker) revoke(partitions ...int32) {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+
+	for _, partition := range partitions {
+		delete(t.partitions, partition)
+	}
+}
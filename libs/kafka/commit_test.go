@@ -0,0 +1,80 @@
+package kafka
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func Test_CommitTracker_CommitsOnlyContiguousDoneOffsets(t *testing.T) {
+	tr := newCommitTracker()
+	for _, off := range []int64{10, 11, 13, 14} {
+		tr.track(0, off, 0)
+	}
+
+	tr.done(0, 11)
+	tr.done(0, 13)
+	if got := tr.commitable(); len(got) != 0 {
+		t.Fatalf("expected nothing to commit while 10 is pending, got %v", got)
+	}
+
+	tr.done(0, 10)
+	if got := tr.commitable()[0].offset; got != 14 {
+		t.Fatalf("expected to commit up to 14, got %d", got)
+	}
+	tr.committed(map[int32]commitOffset{0: {offset: 14}})
+	if got := tr.commitable(); len(got) != 0 {
+		t.Errorf("expected nothing new to commit, got %v", got)
+	}
+
+	tr.done(0, 14)
+	if got := tr.commitable()[0].offset; got != 15 {
+		t.Errorf("expected to commit up to 15, got %d", got)
+	}
+}
+
+func Test_CommitTracker_ResetsOnRedelivery(t *testing.T) {
+	tr := newCommitTracker()
+	tr.track(0, 5, 0)
+	tr.track(0, 6, 0)
+
+	// The partition was reassigned back to us from 5, the earlier deliveries are stale.
+	tr.track(0, 5, 0)
+	tr.done(0, 6)
+	tr.done(0, 5)
+	if got := tr.commitable()[0].offset; got != 6 {
+		t.Errorf("expected to commit up to 6, got %d", got)
+	}
+}
+
+func Test_MemoryClient_ManualCommit(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	c := NewMemoryClient()
+	w, _ := c.Writer(ctx, Config{Topic: "listings"})
+	for _, key := range []string{"a", "b", "c"} {
+		_, _ = w.Write(ctx, key, []byte(key))
+	}
+
+	r, _ := c.Reader(ctx, Config{Topic: "listings", GroupID: "g", CommitMode: CommitManual})
+	var msgs []*Message
+	for i := 0; i < 3; i++ {
+		msg, err := r.Read(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		msgs = append(msgs, msg)
+	}
+
+	msgs[0].Done()
+	msgs[2].Done()
+	if got := c.Committed("g", "listings")[0]; got != 0 {
+		t.Errorf("expected nothing committed before Commit, got %d", got)
+	}
+
+	_ = r.Commit(ctx)
+	if got := c.Committed("g", "listings")[0]; got != 1 {
+		t.Errorf("expected the failed message to hold the commit at 1, got %d", got)
+	}
+}
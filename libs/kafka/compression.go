@@ -0,0 +1,73 @@
+package kafka
+
+import (
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/pierrec/lz4/v4"
+	"github.com/pkg/errors"
+	"github.com/twmb/franz-go/pkg/kgo"
+)
+
+// Compression codecs accepted in Config.Compression. Readers decompress whatever codec a batch was written with.
+const (
+	CompressionNone   = "none"
+	CompressionGzip   = "gzip"
+	CompressionSnappy = "snappy"
+	CompressionLZ4    = "lz4"
+	CompressionZstd   = "zstd"
+)
+
+// compressionNames are the codec names by the compression type of a record batch.
+var compressionNames = []string{CompressionNone, CompressionGzip, CompressionSnappy, CompressionLZ4, CompressionZstd}
+
+// lz4Levels are the lz4 library's levels 1 to 9.
+var lz4Levels = []lz4.CompressionLevel{
+	lz4.Level1, lz4.Level2, lz4.Level3, lz4.Level4, lz4.Level5, lz4.Level6, lz4.Level7, lz4.Level8, lz4.Level9,
+}
+
+// compressionCodec returns the codec writers compress batches with.
+func compressionCodec(cfg Config) (kgo.CompressionCodec, error) {
+	level := cfg.CompressionLevel
+	switch strings.ToLower(cfg.Compression) {
+	case CompressionNone:
+		return kgo.NoCompression(), nil
+	case CompressionGzip:
+		// The kafka library doesn't apply gzip levels, rather than dropping one gzip only takes the default.
+		if level != 0 {
+			return kgo.CompressionCodec{}, errors.Errorf("unsupported kafka gzip compression level %d, gzip only has its default level", level)
+		}
+		return kgo.GzipCompression(), nil
+	case "", CompressionSnappy:
+		if level != 0 {
+			return kgo.CompressionCodec{}, errors.New("kafka snappy compression has no levels")
+		}
+		return kgo.SnappyCompression(), nil
+	case CompressionLZ4:
+		if level < 0 || level > len(lz4Levels) {
+			return kgo.CompressionCodec{}, errors.Errorf("invalid kafka lz4 compression level %d, must be 1 to 9", level)
+		}
+		if level == 0 {
+			return kgo.Lz4Compression(), nil
+		}
+		return kgo.Lz4Compression().WithLevel(int(lz4Levels[level-1])), nil
+	case CompressionZstd:
+		if level < 0 || level > 22 {
+			return kgo.CompressionCodec{}, errors.Errorf("invalid kafka zstd compression level %d, must be 1 to 22", level)
+		}
+		if level == 0 {
+			return kgo.ZstdCompression(), nil
+		}
+		return kgo.ZstdCompression().WithLevel(int(zstd.EncoderLevelFromZstd(level))), nil
+	default:
+		return kgo.CompressionCodec{}, errors.Errorf("unsupported kafka compression %q", cfg.Compression)
+	}
+}
+
+// compressionName returns the codec name of a record batch's compression type.
+func compressionName(compressionType uint8) string {
+	if int(compressionType) < len(compressionNames) {
+		return compressionNames[compressionType]
+	}
+	return "unknown"
+}
@@ -0,0 +1,83 @@
+package kafka
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/opentracing/opentracing-go"
+)
+
+func Test_Writer_CompressesAndReaderDecompresses(t *testing.T) {
+	tests := []struct {
+		compression string
+		level       int
+	}{
+		{compression: CompressionNone},
+		{compression: CompressionGzip},
+		{compression: CompressionSnappy},
+		{compression: CompressionLZ4, level: 9},
+		{compression: CompressionZstd, level: 19},
+	}
+	for _, tt := range tests {
+		t.Run(tt.compression, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+			defer cancel()
+
+			m := newRecordedMetrics()
+			cfg := newFakeCluster(t, "listings")
+			cfg.Metrics = m
+			cfg.Compression = tt.compression
+			cfg.CompressionLevel = tt.level
+			c, cleanup := NewClient(cfg, opentracing.NoopTracer{}, nil)
+			defer cleanup()
+
+			value := []byte(`{"city":"Seattle","city":"Seattle","city":"Seattle","city":"Seattle","city":"Seattle"}`)
+			w, err := c.Writer(ctx, Config{Topic: "listings"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := w.Write(ctx, "a", value); err != nil {
+				t.Fatal(err)
+			}
+
+			r, err := c.Reader(ctx, Config{Topic: "listings"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer r.Close()
+			msg, err := r.Read(ctx)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(msg.Value()) != string(value) {
+				t.Errorf("expected the value back decompressed, got %s", msg.Value())
+			}
+
+			m.mtx.Lock()
+			defer m.mtx.Unlock()
+			ratio := m.gauges[MetricProduceCompressionRatio]
+			if tt.compression == CompressionNone && ratio != 1 {
+				t.Errorf("expected a ratio of 1 without compression, got %f", ratio)
+			}
+			if tt.compression != CompressionNone && ratio <= 1 {
+				t.Errorf("expected the repetitive value to compress, got a ratio of %f", ratio)
+			}
+		})
+	}
+}
+
+func Test_Writer_RejectsInvalidCompression(t *testing.T) {
+	for _, cfg := range []Config{
+		{Topic: "listings", Compression: "brotli"},
+		{Topic: "listings", Compression: CompressionSnappy, CompressionLevel: 3},
+		{Topic: "listings", Compression: CompressionGzip, CompressionLevel: 9},
+		{Topic: "listings", Compression: CompressionZstd, CompressionLevel: 23},
+	} {
+		c, cleanup := NewClient(Config{BootstrapServers: []string{"localhost:9092"}}, opentracing.NoopTracer{}, nil)
+		if _, err := c.Writer(context.Background(), cfg); err == nil {
+			t.Errorf("expected an error for compression %s level %d", cfg.Compression, cfg.CompressionLevel)
+		}
+		cleanup()
+	}
+}
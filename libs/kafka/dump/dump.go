@@ -0,0 +1,265 @@
+// Package dump writes topic messages to JSON lines and replays them into a topic, e.g. to reproduce
+// a production incident against a local broker or a kafka.MemoryClient.
+package dump
+
+import (
+	"bufio"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"time"
+	"unicode/utf8"
+
+	"github.com/pkg/errors"
+	"github.com/zillow/howwegoatzillow/libs/kafka"
+)
+
+// Value encodings accepted by WithValueEncoding.
+const (
+	// ValueAuto writes values that are valid JSON as JSON and anything else as base64. This is the default.
+	ValueAuto = "auto"
+	// ValueJSON writes every value as JSON and fails on one that isn't.
+	ValueJSON = "json"
+	// ValueBase64 writes every value as base64.
+	ValueBase64 = "base64"
+)
+
+// Record is one line of a dump.
+type Record struct {
+	Topic     string    `json:"topic"`
+	Partition int32     `json:"partition"`
+	Offset    int64     `json:"offset"`
+	Timestamp time.Time `json:"timestamp"`
+	Key       string    `json:"key"`
+	Headers   []Header  `json:"headers,omitempty"`
+	// Exactly one of Value and ValueBase64 is set for a message with a value.
+	Value       json.RawMessage `json:"value,omitempty"`
+	ValueBase64 string          `json:"valueBase64,omitempty"`
+}
+
+// Header is a message header with its value as a string, so dumps stay readable.
+// Values that aren't valid UTF-8 are in ValueBase64 instead.
+type Header struct {
+	Key         string `json:"key"`
+	Value       string `json:"value,omitempty"`
+	ValueBase64 string `json:"valueBase64,omitempty"`
+}
+
+// Bytes returns the header value.
+func (h Header) Bytes() ([]byte, error) {
+	if h.ValueBase64 != "" {
+		v, err := base64.StdEncoding.DecodeString(h.ValueBase64)
+		return v, errors.Wrapf(err, "invalid valueBase64 of header %s", h.Key)
+	}
+	return []byte(h.Value), nil
+}
+
+// Bytes returns the message value the record holds.
+func (r Record) Bytes() ([]byte, error) {
+	if r.ValueBase64 != "" {
+		v, err := base64.StdEncoding.DecodeString(r.ValueBase64)
+		return v, errors.Wrapf(err, "invalid valueBase64 at %s/%d/%d", r.Topic, r.Partition, r.Offset)
+	}
+	return []byte(r.Value), nil
+}
+
+// Dump writes messages of topic to out, one JSON Record per line. It reads without a group from the start
+// of the options' range, and stops each partition at the end of the range or at the end offset it had when
+// the dump started, whichever comes first, or once no message arrived for the idle time. A partition stops
+// at its first message at or after the time range's until, so a message written later with an earlier
+// timestamp isn't dumped. It returns how many messages were written.
+func Dump(ctx context.Context, c kafka.Client, admin kafka.Admin, topic string, out io.Writer, options ...DumpOption) (int, error) {
+	s := dumpSettings{idle: 5 * time.Second, encoding: ValueAuto, toOffset: -1}
+	for _, option := range options {
+		if option != nil {
+			option.apply(&s)
+		}
+	}
+
+	ends, err := admin.EndOffsets(ctx, topic)
+	if err != nil {
+		return 0, errors.Wrapf(err, "failed to get end offsets of %s", topic)
+	}
+	cfg := kafka.Config{Topic: topic, NoGroup: true, StartOffsets: make(map[int32]int64, len(ends))}
+	if !s.since.IsZero() {
+		start := kafka.AtTime(s.since)
+		cfg.StartFrom = &start
+	}
+	// pending are the partitions still to dump, up to the offset they end at.
+	pending := make(map[int32]int64, len(ends))
+	for p, end := range ends {
+		if s.toOffset >= 0 && s.toOffset+1 < end {
+			end = s.toOffset + 1
+		}
+		switch {
+		case len(s.partitions) > 0 && !s.partitions[p], s.fromOffset >= end:
+			// Partitions with nothing to dump start at their end, for new messages to be skipped.
+			cfg.StartOffsets[p] = ends[p]
+		case s.fromOffset > 0:
+			cfg.StartOffsets[p] = s.fromOffset
+			pending[p] = end
+		default:
+			pending[p] = end
+		}
+	}
+	if len(pending) == 0 {
+		return 0, nil
+	}
+
+	r, err := c.Reader(ctx, cfg)
+	if err != nil {
+		return 0, errors.Wrapf(err, "failed to read %s", topic)
+	}
+	defer r.Close()
+
+	enc := json.NewEncoder(out)
+	n := 0
+	for len(pending) > 0 && (s.limit == 0 || n < s.limit) {
+		readCtx, cancel := context.WithTimeout(ctx, s.idle)
+		msg, err := r.Read(readCtx)
+		cancel()
+		if errors.Is(err, context.DeadlineExceeded) && ctx.Err() == nil {
+			return n, nil
+		}
+		if err != nil {
+			return n, err
+		}
+		end, ok := pending[msg.Partition]
+		if !ok {
+			continue
+		}
+		// A partition is done at the end of its range.
+		if msg.Offset >= end-1 || (!s.until.IsZero() && !msg.Timestamp.Before(s.until)) {
+			delete(pending, msg.Partition)
+			r.Pause(msg.Partition)
+		}
+		if msg.Offset >= end || !s.includes(msg) {
+			continue
+		}
+
+		rec, err := toRecord(msg, s.encoding)
+		if err != nil {
+			return n, err
+		}
+		if err := enc.Encode(rec); err != nil {
+			return n, errors.Wrap(err, "failed to write dump")
+		}
+		n++
+	}
+	return n, nil
+}
+
+// Replay writes every record in in, one JSON Record per line, to w. Records keep their key,
+// headers and value, but are partitioned by w. It returns how many records were written.
+func Replay(ctx context.Context, w kafka.Writer, in io.Reader, options ...ReplayOption) (int, error) {
+	var s replaySettings
+	for _, option := range options {
+		if option != nil {
+			option.apply(&s)
+		}
+	}
+
+	var interval time.Duration
+	if s.rate > 0 {
+		interval = time.Duration(float64(time.Second) / s.rate)
+	}
+	var enc *json.Encoder
+	if s.dryRun != nil {
+		enc = json.NewEncoder(s.dryRun)
+	}
+
+	scanner := bufio.NewScanner(in)
+	// Values can be large, allow lines up to the default max.message.bytes and then some.
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+
+	n, line := 0, 0
+	next := time.Now()
+	for scanner.Scan() {
+		line++
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var rec Record
+		if err := json.Unmarshal(scanner.Bytes(), &rec); err != nil {
+			return n, errors.Wrapf(err, "invalid record on line %d", line)
+		}
+		rec = s.rewrite(rec)
+
+		if enc != nil {
+			if err := enc.Encode(rec); err != nil {
+				return n, err
+			}
+			n++
+			continue
+		}
+
+		if interval > 0 {
+			if err := sleepUntil(ctx, next); err != nil {
+				return n, err
+			}
+			next = next.Add(interval)
+		}
+		value, err := rec.Bytes()
+		if err != nil {
+			return n, err
+		}
+		headers := make(kafka.Headers, 0, len(rec.Headers))
+		for _, h := range rec.Headers {
+			v, err := h.Bytes()
+			if err != nil {
+				return n, errors.Wrapf(err, "invalid record on line %d", line)
+			}
+			headers.Add(h.Key, v)
+		}
+		if _, err := w.Write(ctx, rec.Key, value, kafka.WithHeaders(headers...)); err != nil {
+			return n, errors.Wrapf(err, "failed to replay record on line %d", line)
+		}
+		n++
+	}
+	return n, errors.Wrap(scanner.Err(), "failed to read dump")
+}
+
+func toRecord(msg *kafka.Message, encoding string) (Record, error) {
+	rec := Record{
+		Topic:     msg.Topic,
+		Partition: msg.Partition,
+		Offset:    msg.Offset,
+		Timestamp: msg.Timestamp,
+		Key:       msg.Key,
+	}
+	for _, h := range msg.Headers {
+		if utf8.Valid(h.Value) {
+			rec.Headers = append(rec.Headers, Header{Key: h.Key, Value: string(h.Value)})
+		} else {
+			rec.Headers = append(rec.Headers, Header{Key: h.Key, ValueBase64: base64.StdEncoding.EncodeToString(h.Value)})
+		}
+	}
+
+	value := msg.Value()
+	switch {
+	case len(value) == 0:
+	case encoding == ValueBase64, encoding == ValueAuto && !json.Valid(value):
+		rec.ValueBase64 = base64.StdEncoding.EncodeToString(value)
+	case json.Valid(value):
+		rec.Value = value
+	default:
+		return Record{}, errors.Errorf("value at %s/%d/%d is not JSON", msg.Topic, msg.Partition, msg.Offset)
+	}
+	return rec, nil
+}
+
+func sleepUntil(ctx context.Context, t time.Time) error {
+	wait := time.Until(t)
+	if wait <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,97 @@
+package dump
+
+import (
+	"bytes"
+	"context"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/zillow/howwegoatzillow/libs/kafka"
+)
+
+func Test_DumpThenReplay(t *testing.T) {
+	ctx := context.Background()
+	c := kafka.NewMemoryClient()
+	w, _ := c.Writer(ctx, kafka.Config{Topic: "orders"})
+	_, _ = w.Write(ctx, "a", []byte(`{"id":1}`), kafka.WithHeader("tenant", "zillow"))
+	_, _ = w.Write(ctx, "b", []byte{0xff, 0x00}, kafka.WithHeaders(kafka.Header{Key: "sig", Value: []byte{0xfe, 0x01}}))
+	_, _ = w.Write(ctx, "c", []byte(`{"id":3}`))
+
+	var out bytes.Buffer
+	// The range ends before the topic does, the dump mustn't wait for the idle time.
+	n, err := Dump(ctx, c, c, "orders", &out, WithOffsets(0, 1), WithIdle(time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 2 || !strings.Contains(out.String(), `"value":{"id":1}`) || !strings.Contains(out.String(), `"valueBase64":"/wA="`) ||
+		!strings.Contains(out.String(), `{"key":"sig","valueBase64":"/gE="}`) {
+		t.Fatalf("unexpected dump of %d messages:\n%s", n, out.String())
+	}
+
+	replayW, _ := c.Writer(ctx, kafka.Config{Topic: "orders.local"})
+	n, err = Replay(ctx, replayW, &out,
+		WithKeyRewrite(map[string]string{"a": "test-a"}),
+		WithSetHeaders(map[string]string{"tenant": "test"}),
+		WithRate(1000))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	msgs := c.Messages("orders.local")
+	if n != 2 || len(msgs) != 2 {
+		t.Fatalf("expected 2 replayed messages, got %d", len(msgs))
+	}
+	if msgs[0].Key != "test-a" || msgs[0].Headers.Get("tenant") != "test" || string(msgs[0].Value()) != `{"id":1}` {
+		t.Errorf("unexpected first message %+v", msgs[0])
+	}
+	if !bytes.Equal(msgs[1].Value(), []byte{0xff, 0x00}) {
+		t.Errorf("unexpected second value %v", msgs[1].Value())
+	}
+	if sig, _ := msgs[1].Headers.Lookup("sig"); !bytes.Equal(sig, []byte{0xfe, 0x01}) {
+		t.Errorf("unexpected second sig header %v", sig)
+	}
+}
+
+func Test_Dump_StartsAtRangeAndStopsAtEnd(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	c := kafka.NewMemoryClient(kafka.WithPartitions(2))
+	w, _ := c.Writer(ctx, kafka.Config{Topic: "orders", CustomPartitioner: keyPartitioner{}})
+	for _, key := range []string{"0", "1"} {
+		for i := 0; i < 5; i++ {
+			_, _ = w.Write(ctx, key, []byte(`{}`))
+		}
+	}
+
+	var out bytes.Buffer
+	n, err := Dump(ctx, c, c, "orders", &out, WithOffsets(3, -1), WithPartitions(1), WithIdle(time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 2 || strings.Contains(out.String(), `"partition":0`) {
+		t.Fatalf("expected offsets 3 and 4 of partition 1, got %d messages:\n%s", n, out.String())
+	}
+}
+
+func Test_Replay_DryRun(t *testing.T) {
+	in := strings.NewReader(`{"topic":"orders","partition":0,"offset":7,"key":"a","headers":[{"key":"traceparent","value":"00-x"}]}` + "\n")
+	var out bytes.Buffer
+
+	n, err := Replay(context.Background(), nil, in, WithDryRun(&out), WithDropHeaders("traceparent"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 1 || strings.Contains(out.String(), "traceparent") {
+		t.Errorf("unexpected dry run output %s", out.String())
+	}
+}
+
+// keyPartitioner writes to the partition the key is the number of.
+type keyPartitioner struct{}
+
+func (keyPartitioner) Partition(key []byte, _ int) int {
+	p, _ := strconv.Atoi(string(key))
+	return p
+}
@@ -0,0 +1,182 @@
+package dump
+
+import (
+	"io"
+	"sort"
+	"time"
+
+	"github.com/zillow/howwegoatzillow/libs/kafka"
+)
+
+// DumpOption interface to identify functional options that control what `Dump` writes
+type DumpOption interface {
+	apply(s *dumpSettings)
+}
+
+type dumpSettings struct {
+	partitions map[int32]bool
+	fromOffset int64
+	toOffset   int64
+	since      time.Time
+	until      time.Time
+	limit      int
+	idle       time.Duration
+	encoding   string
+}
+
+// includes reports whether msg falls in the partitions, offsets and times asked for.
+func (s dumpSettings) includes(msg *kafka.Message) bool {
+	if len(s.partitions) > 0 && !s.partitions[msg.Partition] {
+		return false
+	}
+	if msg.Offset < s.fromOffset || (s.toOffset >= 0 && msg.Offset > s.toOffset) {
+		return false
+	}
+	if !s.since.IsZero() && msg.Timestamp.Before(s.since) {
+		return false
+	}
+	if !s.until.IsZero() && !msg.Timestamp.Before(s.until) {
+		return false
+	}
+	return true
+}
+
+// WithPartitions provides option to only dump the given partitions. Default is all of them.
+func WithPartitions(partitions ...int32) DumpOption { return partitionsOption{partitions} }
+
+type partitionsOption struct{ partitions []int32 }
+
+func (p partitionsOption) apply(s *dumpSettings) {
+	s.partitions = make(map[int32]bool, len(p.partitions))
+	for _, partition := range p.partitions {
+		s.partitions[partition] = true
+	}
+}
+
+// WithOffsets provides option to only dump offsets from through to, inclusive. A negative to means no upper bound.
+func WithOffsets(from, to int64) DumpOption { return offsetsOption{from, to} }
+
+type offsetsOption struct{ from, to int64 }
+
+func (o offsetsOption) apply(s *dumpSettings) {
+	s.fromOffset = o.from
+	s.toOffset = o.to
+}
+
+// WithTimeRange provides option to only dump messages with timestamps from since up to until. A zero time means no bound.
+func WithTimeRange(since, until time.Time) DumpOption { return timeRangeOption{since, until} }
+
+type timeRangeOption struct{ since, until time.Time }
+
+func (t timeRangeOption) apply(s *dumpSettings) {
+	s.since = t.since
+	s.until = t.until
+}
+
+// WithLimit provides option to stop after n messages. default is no limit
+func WithLimit(n int) DumpOption { return limitOption{n} }
+
+type limitOption struct{ n int }
+
+func (l limitOption) apply(s *dumpSettings) { s.limit = l.n }
+
+// WithIdle provides option to override how long to wait for a message before the dump is considered done. Default is 5s.
+func WithIdle(d time.Duration) DumpOption { return idleOption{d} }
+
+type idleOption struct{ d time.Duration }
+
+func (i idleOption) apply(s *dumpSettings) {
+	if i.d > 0 {
+		s.idle = i.d
+	}
+}
+
+// WithValueEncoding provides option to choose ValueAuto, ValueJSON or ValueBase64. default is ValueAuto
+func WithValueEncoding(encoding string) DumpOption { return encodingOption{encoding} }
+
+type encodingOption struct{ encoding string }
+
+func (e encodingOption) apply(s *dumpSettings) {
+	if e.encoding != "" {
+		s.encoding = e.encoding
+	}
+}
+
+// ReplayOption interface to identify functional options that control how `Replay` writes records
+type ReplayOption interface {
+	apply(s *replaySettings)
+}
+
+type replaySettings struct {
+	rate        float64
+	keys        map[string]string
+	setHeaders  map[string]string
+	dropHeaders map[string]bool
+	dryRun      io.Writer
+}
+
+// rewrite applies the key and header rewrites to rec.
+func (s replaySettings) rewrite(rec Record) Record {
+	if key, ok := s.keys[rec.Key]; ok {
+		rec.Key = key
+	}
+	if len(s.setHeaders) == 0 && len(s.dropHeaders) == 0 {
+		return rec
+	}
+	headers := make([]Header, 0, len(rec.Headers)+len(s.setHeaders))
+	for _, h := range rec.Headers {
+		if _, set := s.setHeaders[h.Key]; !set && !s.dropHeaders[h.Key] {
+			headers = append(headers, h)
+		}
+	}
+	keys := make([]string, 0, len(s.setHeaders))
+	for k := range s.setHeaders {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		headers = append(headers, Header{Key: k, Value: s.setHeaders[k]})
+	}
+	rec.Headers = headers
+	return rec
+}
+
+// WithRate provides option to write at most perSecond records a second. default is as fast as possible
+func WithRate(perSecond float64) ReplayOption { return rateOption{perSecond} }
+
+type rateOption struct{ perSecond float64 }
+
+func (r rateOption) apply(s *replaySettings) { s.rate = r.perSecond }
+
+// WithKeyRewrite provides option to replace keys, e.g. to point a replay at test entities. Keys not in the map are kept.
+func WithKeyRewrite(keys map[string]string) ReplayOption { return keyRewriteOption{keys} }
+
+type keyRewriteOption struct{ keys map[string]string }
+
+func (k keyRewriteOption) apply(s *replaySettings) { s.keys = k.keys }
+
+// WithSetHeaders provides option to set headers on every record, replacing any values they had.
+func WithSetHeaders(headers map[string]string) ReplayOption { return setHeadersOption{headers} }
+
+type setHeadersOption struct{ headers map[string]string }
+
+func (h setHeadersOption) apply(s *replaySettings) { s.setHeaders = h.headers }
+
+// WithDropHeaders provides option to remove headers from every record, e.g. traceparent so replays start new traces.
+func WithDropHeaders(keys ...string) ReplayOption { return dropHeadersOption{keys} }
+
+type dropHeadersOption struct{ keys []string }
+
+func (h dropHeadersOption) apply(s *replaySettings) {
+	s.dropHeaders = make(map[string]bool, len(h.keys))
+	for _, k := range h.keys {
+		s.dropHeaders[k] = true
+	}
+}
+
+// WithDryRun provides option to write the rewritten records to out instead of the topic.
+func WithDryRun(out io.Writer) ReplayOption { return dryRunOption{out} }
+
+type dryRunOption struct{ out io.Writer }
+
+func (d dryRunOption) apply(s *replaySettings) { s.dryRun = d.out }
@@ -0,0 +1,60 @@
+package kafka
+
+// Header is a single message header. Kafka header values are bytes and keys may repeat.
+type Header struct {
+	Key   string
+	Value []byte
+}
+
+// Headers is the ordered list of headers on a message.
+type Headers []Header
+
+// Get returns the last value for key as a string, or "" if there is none.
+func (h Headers) Get(key string) string {
+	v, _ := h.Lookup(key)
+	return string(v)
+}
+
+// Lookup returns the last value for key. Like the Java client's lastHeader, later values win.
+func (h Headers) Lookup(key string) ([]byte, bool) {
+	for i := len(h) - 1; i >= 0; i-- {
+		if h[i].Key == key {
+			return h[i].Value, true
+		}
+	}
+	return nil, false
+}
+
+// Set replaces every value for key with value.
+func (h *Headers) Set(key, value string) {
+	h.SetBytes(key, []byte(value))
+}
+
+// SetBytes replaces every value for key with value.
+func (h *Headers) SetBytes(key string, value []byte) {
+	h.Del(key)
+	h.Add(key, value)
+}
+
+// Add appends a value for key, keeping any existing ones.
+func (h *Headers) Add(key string, value []byte) {
+	*h = append(*h, Header{Key: key, Value: value})
+}
+
+// Del removes every value for key.
+func (h *Headers) Del(key string) {
+	kept := (*h)[:0]
+	for _, hdr := range *h {
+		if hdr.Key != key {
+			kept = append(kept, hdr)
+		}
+	}
+	*h = kept
+}
+
+func (h Headers) clone() Headers {
+	if h == nil {
+		return nil
+	}
+	return append(make(Headers, 0, len(h)), h...)
+}
@@ -2,11 +2,16 @@ package kafka
 
 import (
 	"context"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 
-	"github.com/google/uuid"
 	"github.com/opentracing/opentracing-go"
-	"github.com/opentracing/opentracing-go/ext"
+	"github.com/twmb/franz-go/pkg/kgo"
+	"github.com/zillow/howwegoatzillow/libs/metrics"
 )
 
 // Client ...
@@ -17,27 +22,169 @@ type Client interface {
 
 // Reader ...
 type Reader interface {
+	// Read returns the next message. Readers that prepare messages, like the claim check reader,
+	// return a message they couldn't prepare together with the error, so it can still be dead lettered.
 	Read(ctx context.Context) (*Message, error)
+	// Commit commits, per partition, everything up to the first message that isn't done yet.
+	Commit(ctx context.Context) error
+	// Pause stops reading the partitions until they are resumed, messages already fetched from them are held back too.
+	Pause(partitions ...int32)
+	// Resume reads the partitions again.
+	Resume(partitions ...int32)
+	// Assignment returns the partitions the reader is assigned, in order. Readers without a group read
+	// every partition, for them it returns the partitions they fetched from so far.
+	Assignment() []int32
+	// Seek moves the reader to the position on the partitions it is reading. Group readers also commit
+	// the position, so the group carries on from there after a rebalance or restart. Messages read
+	// before the seek no longer move the committed offsets once they are done.
+	Seek(ctx context.Context, to Position) error
+	// Close commits whatever has been marked done and leaves the consumer group.
+	Close() error
 }
 
 // Writer ...
 type Writer interface {
-	Write(ctx context.Context, key string, value []byte) (Response, error)
+	Write(ctx context.Context, key string, value []byte, options ...WriteOption) (Response, error)
+	// WriteBatch writes all records and waits for them. Responses line up with records,
+	// the error is the first failure if any record could not be written.
+	WriteBatch(ctx context.Context, records []Record) ([]Response, error)
+	// WriteAsync buffers the record and returns straight away. onDelivery, if not nil,
+	// is called once the record has been written or has failed.
+	WriteAsync(ctx context.Context, record Record, onDelivery func(Delivery))
+	// Flush waits until every buffered record has been delivered.
+	Flush(ctx context.Context) error
+}
+
+// TransactionalClient is a Client that can also consume and produce in Kafka transactions.
+type TransactionalClient interface {
+	Client
+	// Transactor reads topicConfig.Topic in the consumer group topicConfig.GroupID and writes in transactions
+	// under transactionalID. The id must be unique to the instance and stay the same across its restarts,
+	// so the brokers can fence off a zombie instance still using it.
+	Transactor(ctx context.Context, topicConfig Config, transactionalID string) (Transactor, error)
+}
+
+// Transactor consumes a topic and writes in transactions that also commit the consumed offsets, so to
+// read committed consumers every consumed message has its output written exactly once.
+// A Transactor is not safe for concurrent use, except for the writers it returns.
+type Transactor interface {
+	// Poll returns the next messages, waiting for at least one, and starts a transaction if none is running.
+	// Only messages of committed transactions are returned.
+	Poll(ctx context.Context) ([]*Message, error)
+	// Writer returns a writer for topic that writes in the running transaction. Read committed
+	// consumers only see the records once the transaction commits.
+	Writer(topic string) Writer
+	// Commit commits what was written together with the offsets of every message polled in the transaction.
+	// It returns false if the transaction was aborted instead, because a polled message wasn't marked done
+	// or partitions were revoked. The messages are then polled again.
+	Commit(ctx context.Context) (bool, error)
+	// Abort drops what was written in the transaction. The messages it polled are polled again.
+	Abort(ctx context.Context) error
+	Close() error
+}
+
+// Admin manages topics and consumer groups.
+type Admin interface {
+	CreateTopic(ctx context.Context, spec TopicSpec) error
+	// EnsureTopics creates the topics that don't exist yet. Existing topics are left as they are.
+	EnsureTopics(ctx context.Context, specs ...TopicSpec) error
+	DeleteTopic(ctx context.Context, topic string) error
+	ListTopics(ctx context.Context) ([]string, error)
+	DescribeTopic(ctx context.Context, topic string) (TopicDescription, error)
+	// EndOffsets returns, by partition, the offset the next message written to the topic will get.
+	EndOffsets(ctx context.Context, topic string) (map[int32]int64, error)
+	// AlterTopicConfig sets the given configs on the topic, leaving the others untouched.
+	AlterTopicConfig(ctx context.Context, topic string, configs map[string]string) error
+
+	ListGroups(ctx context.Context) ([]string, error)
+	DescribeGroup(ctx context.Context, group string) (GroupDescription, error)
+	DeleteGroup(ctx context.Context, group string) error
+	// ResetGroupOffsets moves the group's committed offsets on every partition of the topic.
+	// The group must have no active members, as in Kafka's own tooling.
+	ResetGroupOffsets(ctx context.Context, group, topic string, to Position) error
 }
 
 // Config ...
 type Config struct {
 	Topic            string
 	BootstrapServers []string
+	// GroupID is the consumer group readers join. Readers without a group consume
+	// every partition of the topic from the beginning and never commit offsets.
+	GroupID string
+	// NoGroup makes a reader read without a group even when the client's Config has a GroupID, e.g. to
+	// read a whole topic next to the service's own group. It is not inherited from the client's Config.
+	NoGroup bool `json:"-"`
+	// StartOffsets is where readers without a group start, by partition. Partitions not listed start from
+	// the beginning, partitions added after the reader was created aren't read. It is not inherited from
+	// the client's Config.
+	StartOffsets map[int32]int64 `json:"-"`
+	// StartFrom is where readers start on partitions they have no offset for: partitions the group never
+	// committed, or for readers without a group, partitions not in StartOffsets. Default is Earliest.
+	// It is not inherited from the client's Config.
+	StartFrom *Position `json:"-"`
+	// Isolation is IsolationReadUncommitted or IsolationReadCommitted, whether readers also see messages of
+	// transactions that are still open or were aborted. Default is IsolationReadUncommitted.
+	Isolation string
+	// OnPartitionsAssigned is called when a group reader is assigned partitions, before it reads them.
+	OnPartitionsAssigned func(ctx context.Context, partitions []int32) `json:"-"`
+	// OnPartitionsRevoked is called before a group reader gives up partitions, e.g. to finish work on them.
+	// It is called before the reader commits what is done on them, and must return within the group's
+	// rebalance timeout. It is also called for partitions that were lost, when committing is too late.
+	// Neither callback is inherited from the client's Config.
+	OnPartitionsRevoked func(ctx context.Context, partitions []int32) `json:"-"`
+	// ClientID is sent to the brokers to identify this client in their logs and quotas.
+	ClientID string
+
+	// TLS and SASL secure the connection to the brokers. Default is plaintext without authentication.
+	TLS  *TLSConfig
+	SASL *SASLConfig
+
+	// Metrics receives produce, consume, lag and commit metrics. Default is none.
+	Metrics metrics.Metrics `json:"-"`
+
+	// CommitMode is CommitAuto or CommitManual. Either way readers also commit when partitions
+	// are revoked and when they are closed. Default is CommitAuto.
+	CommitMode string
+	// CommitInterval is how often CommitAuto commits. Default is 5 seconds.
+	CommitInterval time.Duration
+
+	// Compression is the codec writers compress record batches with, one of the Compression* names.
+	// Readers decompress any codec. Default is CompressionSnappy.
+	Compression string
+	// CompressionLevel trades speed for size: 1 to 9 for lz4, 1 to 22 for zstd, higher is smaller.
+	// Snappy has no levels, and gzip only its default one: the kafka library doesn't apply gzip levels.
+	// It is inherited together with Compression. Default is 0, the codec's default level.
+	CompressionLevel int
+	// Linger is how long writers wait for more records to fill a batch. Default is 0, send right away.
+	Linger time.Duration
+	// BatchMaxBytes caps the size of a record batch. Default is ~1MB, the broker default.
+	BatchMaxBytes int32
+	// MaxBufferedRecords caps how many records writers buffer before WriteAsync blocks. Default is 10,000.
+	MaxBufferedRecords int
+	// MaxInFlight caps produce requests in flight per broker. Setting it turns off idempotent writes,
+	// so retries may reorder or duplicate records. Leave it at 0 unless throughput demands it.
+	MaxInFlight int
+	// Partitioner picks how writers spread records over partitions, one of the Partitioner* names.
+	// Default is PartitionerMurmur2.
+	Partitioner string
+	// CustomPartitioner, when set, is used instead of Partitioner.
+	CustomPartitioner Partitioner `json:"-"`
 }
 
 // Message ...
 type Message struct {
 	Key       string
-	Headers   map[string]string
-	Offset    int32
+	Headers   Headers
+	Topic     string
+	Offset    int64
 	Partition int32
+	Timestamp time.Time
 	value     []byte
+	done      func()
+	// fetch is set by readers that returned the message with an error preparing it, see Fetch.
+	fetch func(ctx context.Context) error
+	// structured is set by the Structured write option.
+	structured bool
 }
 
 // Response ...
@@ -46,9 +193,41 @@ type Response struct {
 	Offset    int64
 }
 
-// Done ...
+// Record is a single message for `Writer.WriteBatch` and `Writer.WriteAsync`.
+type Record struct {
+	Key     string
+	Value   []byte
+	Headers Headers
+}
+
+// Delivery reports the outcome of a `Writer.WriteAsync`.
+type Delivery struct {
+	Record   Record
+	Response Response
+	Err      error
+}
+
+// Value returns the message payload.
+func (m *Message) Value() []byte {
+	return m.value
+}
+
+// Done marks the message as processed. Its offset is committed for the consumer group once every
+// earlier message on the partition is done too.
 func (m *Message) Done() {
-	// Commit offset
+	if m.done != nil {
+		m.done()
+	}
+}
+
+// Fetch prepares a message that Read returned together with an error again, e.g. fetches a claim checked
+// payload once more after the blob store failed. It returns nil for a message that was read whole, and the
+// error otherwise, nil once it succeeded.
+func (m *Message) Fetch(ctx context.Context) error {
+	if m.fetch == nil {
+		return nil
+	}
+	return m.fetch(ctx)
 }
 
 // Logger ...
@@ -61,43 +240,264 @@ type client struct {
 	config Config
 	tracer opentracing.Tracer
 	logger Logger
+
+	wrtMtx   sync.RWMutex
+	wrtCache map[string]*writer
 }
 
-func (c *client) Reader(ctx context.Context, topicConfig Config) (Reader, error) { return nil, nil }
+func (c *client) Reader(ctx context.Context, topicConfig Config) (Reader, error) {
+	cfg := topicConfig.withDefaults(c.config)
+
+	r := &reader{
+		config:   cfg,
+		logger:   c.logger,
+		tracker:  newCommitTracker(),
+		assigned: make(map[int32]bool),
+		paused:   make(map[int32]bool),
+		sought:   make(map[int32]int),
+	}
+	start := Earliest
+	if cfg.StartFrom != nil {
+		start = *cfg.StartFrom
+	}
+
+	opts, err := c.clientOpts(cfg)
+	if err != nil {
+		return nil, err
+	}
+	opts = append(opts, kgo.ConsumeResetOffset(start.kgoOffset()))
+	if cfg.Isolation == IsolationReadCommitted {
+		opts = append(opts, kgo.FetchIsolationLevel(kgo.ReadCommitted()))
+	}
+	// Readers starting at given offsets consume the topic's partitions directly, added once they are known.
+	startAt := cfg.GroupID == "" && len(cfg.StartOffsets) > 0
+	if !startAt {
+		opts = append(opts, kgo.ConsumeTopics(cfg.Topic))
+	}
+	if cfg.GroupID != "" {
+		opts = append(opts,
+			kgo.ConsumerGroup(cfg.GroupID),
+			kgo.DisableAutoCommit(),
+			kgo.OnPartitionsAssigned(r.onAssigned),
+			kgo.OnPartitionsRevoked(r.onRevoked),
+			kgo.OnPartitionsLost(r.onLost),
+		)
+	}
+
+	cl, err := kgo.NewClient(opts...)
+	if err != nil {
+		return nil, err
+	}
+	r.cl = cl
 
+	if startAt {
+		if err := r.consumeFrom(ctx, cfg.StartOffsets, start.kgoOffset()); err != nil {
+			cl.Close()
+			return nil, err
+		}
+	}
+
+	if cfg.GroupID != "" && cfg.CommitMode != CommitManual {
+		r.startAutoCommit()
+	}
+	return r, nil
+}
+
+// Writer returns a writer for topicConfig.Topic. Calls with the same topic and producer settings share a writer.
 func (c *client) Writer(ctx context.Context, topicConfig Config) (Writer, error) {
-	return &writer{c.tracer}, nil
+	cfg := topicConfig.withDefaults(c.config)
+	key := cfg.cacheKey()
+
+	c.wrtMtx.RLock()
+	w := c.wrtCache[key]
+	c.wrtMtx.RUnlock()
+
+	if w != nil {
+		return w, nil
+	}
+
+	c.wrtMtx.Lock()
+	defer c.wrtMtx.Unlock()
+
+	w = c.wrtCache[key]
+	if w != nil {
+		return w, nil
+	}
+
+	opts, err := c.clientOpts(cfg)
+	if err != nil {
+		return nil, err
+	}
+	opts = append(opts,
+		kgo.DefaultProduceTopic(cfg.Topic),
+		kgo.RecordPartitioner(kgoPartitioner(cfg)),
+	)
+	cl, err := kgo.NewClient(opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	w = &writer{cl: cl, topic: cfg.Topic, tracer: c.tracer}
+	c.wrtCache[key] = w
+	return w, nil
 }
 
-// NewClient ...
-func NewClient(config Config, tracer opentracing.Tracer, logger Logger) Client {
-	return &client{config: config, tracer: tracer, logger: logger}
+// NewClient creates a Client backed by the brokers in config.BootstrapServers.
+// Any field left empty in the Config passed to Reader or Writer falls back to the value in config.
+// The returned func closes every writer handed out by the client.
+func NewClient(config Config, tracer opentracing.Tracer, logger Logger) (Client, func()) {
+	c := &client{
+		config:   config,
+		tracer:   tracer,
+		logger:   logger,
+		wrtCache: make(map[string]*writer),
+	}
+	return c, c.close
 }
 
-type writer struct {
-	tracer opentracing.Tracer
+func (c *client) close() {
+	c.wrtMtx.Lock()
+	defer c.wrtMtx.Unlock()
+
+	for key, w := range c.wrtCache {
+		w.cl.Close()
+		delete(c.wrtCache, key)
+	}
 }
 
-func (w *writer) Write(ctx context.Context, key string, value []byte) (Response, error) {
-	msg := &Message{
-		Key:   key,
-		value: value,
-		Headers: map[string]string{
-			"timestamp": time.Now().String(),
-			"guid":      uuid.New().String(),
-		}}
+func (c *client) clientOpts(cfg Config) ([]kgo.Opt, error) {
+	opts, err := cfg.securityOpts()
+	if err != nil {
+		return nil, err
+	}
+	opts = append(opts,
+		kgo.SeedBrokers(cfg.BootstrapServers...),
+		kgo.WithLogger(&kgoLogger{c.logger}),
+	)
+	if cfg.Metrics != nil {
+		opts = append(opts, kgo.WithHooks(&kgoHooks{m: cfg.Metrics}))
+	}
+	if cfg.ClientID != "" {
+		opts = append(opts, kgo.ClientID(cfg.ClientID))
+	}
+	codec, err := compressionCodec(cfg)
+	if err != nil {
+		return nil, err
+	}
+	// Brokers too old for the codec get batches uncompressed.
+	opts = append(opts, kgo.ProducerBatchCompression(codec, kgo.NoCompression()))
+	if cfg.Linger > 0 {
+		opts = append(opts, kgo.ProducerLinger(cfg.Linger))
+	}
+	if cfg.BatchMaxBytes > 0 {
+		opts = append(opts, kgo.ProducerBatchMaxBytes(cfg.BatchMaxBytes))
+	}
+	if cfg.MaxBufferedRecords > 0 {
+		opts = append(opts, kgo.MaxBufferedRecords(cfg.MaxBufferedRecords))
+	}
+	if cfg.MaxInFlight > 0 {
+		opts = append(opts,
+			kgo.DisableIdempotentWrite(),
+			kgo.MaxProduceRequestsInflightPerBroker(cfg.MaxInFlight),
+		)
+	}
+	return opts, nil
+}
 
-	span, ctx := opentracing.StartSpanFromContextWithTracer(ctx, w.tracer, "kafka_write", ext.SpanKindProducer)
-	defer span.Finish()
-	_ = w.tracer.Inject(span.Context(), opentracing.TextMap, &writeAttributeCarrier{msg})
-	var resp Response
-	//resp = //Make your actual kafka call here
-	return resp, nil
+func (c Config) withDefaults(d Config) Config {
+	if c.Topic == "" {
+		c.Topic = d.Topic
+	}
+	if len(c.BootstrapServers) == 0 {
+		c.BootstrapServers = d.BootstrapServers
+	}
+	if c.GroupID == "" && !c.NoGroup {
+		c.GroupID = d.GroupID
+	}
+	if c.ClientID == "" {
+		c.ClientID = d.ClientID
+	}
+	if c.TLS == nil {
+		c.TLS = d.TLS
+	}
+	if c.Metrics == nil {
+		c.Metrics = d.Metrics
+	}
+	if c.SASL == nil {
+		c.SASL = d.SASL
+	}
+	if c.Isolation == "" {
+		c.Isolation = d.Isolation
+	}
+	if c.CommitMode == "" {
+		c.CommitMode = d.CommitMode
+	}
+	if c.CommitInterval == 0 {
+		c.CommitInterval = d.CommitInterval
+	}
+	if c.Compression == "" {
+		c.Compression = d.Compression
+		c.CompressionLevel = d.CompressionLevel
+	}
+	if c.Linger == 0 {
+		c.Linger = d.Linger
+	}
+	if c.BatchMaxBytes == 0 {
+		c.BatchMaxBytes = d.BatchMaxBytes
+	}
+	if c.MaxBufferedRecords == 0 {
+		c.MaxBufferedRecords = d.MaxBufferedRecords
+	}
+	if c.MaxInFlight == 0 {
+		c.MaxInFlight = d.MaxInFlight
+	}
+	if c.Partitioner == "" {
+		c.Partitioner = d.Partitioner
+	}
+	if c.CustomPartitioner == nil {
+		c.CustomPartitioner = d.CustomPartitioner
+	}
+	return c
 }
 
-type writeAttributeCarrier struct{ msg *Message }
+// cacheKey identifies the writers that can be shared: those for the same topic with every setting that
+// affects producing the same.
+func (c Config) cacheKey() string {
+	var tls TLSConfig
+	if c.TLS != nil {
+		tls = *c.TLS
+	}
+	var sasl SASLConfig
+	if c.SASL != nil {
+		sasl = *c.SASL
+	}
+	return strings.Join([]string{
+		c.Topic,
+		strings.Join(c.BootstrapServers, ","),
+		c.ClientID,
+		fmt.Sprintf("%+v", tls),
+		fmt.Sprintf("%+v", sasl),
+		identity(c.Metrics),
+		strings.ToLower(c.Compression),
+		strconv.Itoa(c.CompressionLevel),
+		c.Linger.String(),
+		strconv.Itoa(int(c.BatchMaxBytes)),
+		strconv.Itoa(c.MaxBufferedRecords),
+		strconv.Itoa(c.MaxInFlight),
+		c.Partitioner,
+		identity(c.CustomPartitioner),
+	}, "|")
+}
 
-// Set conforms to the TextMapWriter interface.
-func (c *writeAttributeCarrier) Set(key, val string) {
-	c.msg.Headers[key] = val
+// identity tells implementations apart: pointers, funcs and maps by address, anything else by value.
+func identity(v interface{}) string {
+	if v == nil {
+		return ""
+	}
+	switch rv := reflect.ValueOf(v); rv.Kind() {
+	case reflect.Ptr, reflect.Func, reflect.Map, reflect.Slice, reflect.Chan, reflect.UnsafePointer:
+		return fmt.Sprintf("%T@%x", v, rv.Pointer())
+	default:
+		return fmt.Sprintf("%T:%+v", v, v)
+	}
 }
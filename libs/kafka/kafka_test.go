@@ -0,0 +1,139 @@
+package kafka
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/opentracing/opentracing-go"
+	"github.com/twmb/franz-go/pkg/kfake"
+)
+
+func newFakeCluster(t *testing.T, topics ...string) Config {
+	t.Helper()
+	c, err := kfake.NewCluster(kfake.NumBrokers(1), kfake.SeedTopics(3, topics...))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(c.Close)
+	return Config{BootstrapServers: c.ListenAddrs()}
+}
+
+func Test_Client_WriteThenReadWithGroup(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	cfg := newFakeCluster(t, "orders")
+	c, cleanup := NewClient(cfg, opentracing.NoopTracer{}, nil)
+	defer cleanup()
+
+	w, err := c.Writer(ctx, Config{Topic: "orders"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range []string{"a", "b"} {
+		if _, err := w.Write(ctx, key, []byte("value-"+key)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	r, err := c.Reader(ctx, Config{Topic: "orders", GroupID: "g1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	first, err := r.Read(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first.Headers.Get(IDHeader) == "" {
+		t.Error("expected ce_id header on message")
+	}
+	if string(first.value) != "value-"+first.Key {
+		t.Errorf("unexpected value %q for key %q", first.value, first.Key)
+	}
+	first.Done()
+	if err := r.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// The committed message must not be handed out again to the same group.
+	r, err = c.Reader(ctx, Config{Topic: "orders", GroupID: "g1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	second, err := r.Read(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if second.Key == first.Key {
+		t.Errorf("message %q was redelivered after commit", first.Key)
+	}
+}
+
+func Test_Client_WriterIsCachedPerTopic(t *testing.T) {
+	ctx := context.Background()
+	cfg := newFakeCluster(t, "orders")
+	c, cleanup := NewClient(cfg, opentracing.NoopTracer{}, nil)
+	defer cleanup()
+
+	w1, _ := c.Writer(ctx, Config{Topic: "orders"})
+	w2, _ := c.Writer(ctx, Config{Topic: "orders"})
+	if w1 != w2 {
+		t.Error("expected the same writer for the same topic")
+	}
+}
+
+func Test_Writer_WriteBatchKeepsRecordOrder(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	cfg := newFakeCluster(t, "orders")
+	cfg.Linger = 10 * time.Millisecond
+	c, cleanup := NewClient(cfg, opentracing.NoopTracer{}, nil)
+	defer cleanup()
+
+	w, _ := c.Writer(ctx, Config{Topic: "orders"})
+	records := []Record{
+		{Key: "a", Value: []byte("1")},
+		{Key: "a", Value: []byte("2")},
+		{Key: "a", Value: []byte("3"), Headers: Headers{{Key: "source", Value: []byte("test")}}},
+	}
+	responses, err := w.WriteBatch(ctx, records)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 1; i < len(responses); i++ {
+		if responses[i].Partition != responses[0].Partition || responses[i].Offset != responses[i-1].Offset+1 {
+			t.Errorf("responses out of order: %+v", responses)
+		}
+	}
+}
+
+func Test_Writer_WriteAsyncReportsDeliveries(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	cfg := newFakeCluster(t, "orders")
+	c, cleanup := NewClient(cfg, opentracing.NoopTracer{}, nil)
+	defer cleanup()
+
+	w, _ := c.Writer(ctx, Config{Topic: "orders"})
+	deliveries := make(chan Delivery, 10)
+	for i := 0; i < 10; i++ {
+		w.WriteAsync(ctx, Record{Key: "k", Value: []byte("v")}, func(d Delivery) { deliveries <- d })
+	}
+	if err := w.Flush(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(deliveries) != 10 {
+		t.Fatalf("expected 10 deliveries after flush, got %d", len(deliveries))
+	}
+	close(deliveries)
+	for d := range deliveries {
+		if d.Err != nil {
+			t.Error(d.Err)
+		}
+	}
+}
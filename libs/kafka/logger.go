@@ -0,0 +1,26 @@
+package kafka
+
+import (
+	"context"
+
+	"github.com/twmb/franz-go/pkg/kgo"
+)
+
+// kgoLogger routes the kafka library's own logs to our Logger. Debug logs are dropped.
+type kgoLogger struct{ l Logger }
+
+func (k *kgoLogger) Level() kgo.LogLevel {
+	if k.l == nil {
+		return kgo.LogLevelNone
+	}
+	return kgo.LogLevelInfo
+}
+
+func (k *kgoLogger) Log(level kgo.LogLevel, msg string, keyvals ...interface{}) {
+	switch level {
+	case kgo.LogLevelError, kgo.LogLevelWarn:
+		k.l.Error(context.Background(), msg, keyvals...)
+	case kgo.LogLevelInfo:
+		k.l.Info(context.Background(), msg, keyvals...)
+	}
+}
@@ -0,0 +1,447 @@
+package kafka
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/opentracing/opentracing-go"
+)
+
+var (
+	_ Client = (*MemoryClient)(nil)
+	_ Admin  = (*MemoryClient)(nil)
+)
+
+// MemoryClient is a Client that keeps its topics in memory instead of talking to a broker.
+// It is meant for unit tests and for running services on a laptop. Topics are created on first use,
+// messages are spread over partitions by key and consumer groups commit offsets as messages are marked done.
+type MemoryClient struct {
+	partitions int
+	tracer     opentracing.Tracer
+
+	mtx     sync.Mutex
+	changed chan struct{}
+	topics  map[string]*memTopic
+	groups  map[string]*memGroup
+}
+
+type memTopic struct {
+	partitions [][]*Message
+	configs    map[string]string
+}
+
+type memGroup struct {
+	committed []int64
+	next      []int64
+}
+
+// NewMemoryClient creates an empty in-memory Client.
+func NewMemoryClient(options ...MemoryOption) *MemoryClient {
+	c := &MemoryClient{
+		partitions: 1,
+		tracer:     opentracing.NoopTracer{},
+		changed:    make(chan struct{}),
+		topics:     make(map[string]*memTopic),
+		groups:     make(map[string]*memGroup),
+	}
+
+	for _, option := range options {
+		if option != nil {
+			option.apply(c)
+		}
+	}
+
+	return c
+}
+
+// Reader returns a reader for topicConfig.Topic. Readers sharing a GroupID split the messages between them,
+// readers without a GroupID each see every message from the beginning. With CommitAuto, done messages are
+// committed straight away rather than on an interval, so tests don't have to wait for them.
+// A group reader is assigned every partition, and its rebalance callbacks run when it is created and closed.
+func (c *MemoryClient) Reader(ctx context.Context, topicConfig Config) (Reader, error) {
+	r := c.reader(topicConfig)
+	if fn := topicConfig.OnPartitionsAssigned; fn != nil && r.grouped {
+		fn(ctx, r.Assignment())
+	}
+	return r, nil
+}
+
+func (c *MemoryClient) reader(topicConfig Config) *memReader {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	t := c.topic(topicConfig.Topic)
+	r := &memReader{
+		c:         c,
+		topic:     topicConfig.Topic,
+		grouped:   topicConfig.GroupID != "",
+		manual:    topicConfig.CommitMode == CommitManual,
+		onRevoked: topicConfig.OnPartitionsRevoked,
+		tracker:   newCommitTracker(),
+		paused:    make(map[int32]bool),
+	}
+	start := Earliest
+	if topicConfig.StartFrom != nil {
+		start = *topicConfig.StartFrom
+	}
+	if r.grouped {
+		_, committed := c.groups[topicConfig.GroupID+"/"+topicConfig.Topic]
+		r.group = c.group(topicConfig.GroupID, topicConfig.Topic)
+		if !committed {
+			copy(r.group.next, t.offsetsAt(start))
+			copy(r.group.committed, r.group.next)
+		}
+	} else {
+		r.group = newMemGroup(len(t.partitions))
+		copy(r.group.next, t.offsetsAt(start))
+		for p, o := range topicConfig.StartOffsets {
+			if int(p) < len(r.group.next) {
+				r.group.next[p] = o
+			}
+		}
+	}
+	return r
+}
+
+// Writer returns a writer for topicConfig.Topic, partitioning with topicConfig's partitioner.
+func (c *MemoryClient) Writer(ctx context.Context, topicConfig Config) (Writer, error) {
+	return &memWriter{c: c, topic: topicConfig.Topic, partitioner: newPartitioner(topicConfig)}, nil
+}
+
+// Messages returns a copy of every message written to the topic, ordered by partition and offset.
+func (c *MemoryClient) Messages(topic string) []*Message {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	var msgs []*Message
+	if t, ok := c.topics[topic]; ok {
+		for _, p := range t.partitions {
+			for _, m := range p {
+				msgs = append(msgs, m.clone())
+			}
+		}
+	}
+	return msgs
+}
+
+// WaitFor blocks until at least n messages have been written to the topic or ctx is done.
+func (c *MemoryClient) WaitFor(ctx context.Context, topic string, n int) error {
+	for {
+		c.mtx.Lock()
+		count := 0
+		if t, ok := c.topics[topic]; ok {
+			for _, p := range t.partitions {
+				count += len(p)
+			}
+		}
+		changed := c.changed
+		c.mtx.Unlock()
+
+		if count >= n {
+			return nil
+		}
+
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// Committed returns the offsets the consumer group has committed for the topic, keyed by partition.
+// As in Kafka, a committed offset is the offset of the next message the group will read.
+func (c *MemoryClient) Committed(groupID, topic string) map[int32]int64 {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	offsets := make(map[int32]int64)
+	if g, ok := c.groups[groupID+"/"+topic]; ok {
+		for p, o := range g.committed {
+			offsets[int32(p)] = o
+		}
+	}
+	return offsets
+}
+
+// topic returns the named topic, creating it if needed. Callers must hold mtx.
+func (c *MemoryClient) topic(name string) *memTopic {
+	t, ok := c.topics[name]
+	if !ok {
+		t = &memTopic{partitions: make([][]*Message, c.partitions), configs: make(map[string]string)}
+		c.topics[name] = t
+	}
+	return t
+}
+
+// offsetsAt returns, by partition, the offset the position points at.
+func (t *memTopic) offsetsAt(to Position) []int64 {
+	offsets := make([]int64, len(t.partitions))
+	for p, msgs := range t.partitions {
+		switch {
+		case to.earliest:
+			offsets[p] = 0
+		case to.atOffset:
+			offsets[p] = min(to.offset, int64(len(msgs)))
+		case !to.at.IsZero():
+			offsets[p] = int64(sort.Search(len(msgs), func(i int) bool { return !msgs[i].Timestamp.Before(to.at) }))
+		default:
+			offsets[p] = int64(len(msgs))
+		}
+	}
+	return offsets
+}
+
+// group returns the consumer group state for the topic, creating it if needed. Callers must hold mtx.
+func (c *MemoryClient) group(groupID, topic string) *memGroup {
+	key := groupID + "/" + topic
+	g, ok := c.groups[key]
+	if !ok {
+		g = newMemGroup(len(c.topic(topic).partitions))
+		c.groups[key] = g
+	}
+	return g
+}
+
+func newMemGroup(partitions int) *memGroup {
+	return &memGroup{
+		committed: make([]int64, partitions),
+		next:      make([]int64, partitions),
+	}
+}
+
+// notify wakes up everyone waiting on a change. Callers must hold mtx.
+func (c *MemoryClient) notify() {
+	close(c.changed)
+	c.changed = make(chan struct{})
+}
+
+func (c *MemoryClient) append(msg *Message, partitioner Partitioner) Response {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	t := c.topic(msg.Topic)
+	p := partitioner.Partition([]byte(msg.Key), len(t.partitions))
+
+	stored := msg.clone()
+	stored.value = append([]byte(nil), msg.value...)
+	stored.Partition = int32(p)
+	stored.Offset = int64(len(t.partitions[p]))
+	stored.Timestamp = time.Now()
+	t.partitions[p] = append(t.partitions[p], stored)
+
+	c.notify()
+	return Response{Partition: stored.Partition, Offset: stored.Offset}
+}
+
+// commit moves the group's committed offsets forward. Callers must hold mtx.
+func (c *MemoryClient) commit(g *memGroup, offsets map[int32]commitOffset) {
+	for p, o := range offsets {
+		if o.offset > g.committed[p] {
+			g.committed[p] = o.offset
+		}
+	}
+	c.notify()
+}
+
+type memReader struct {
+	c         *MemoryClient
+	topic     string
+	grouped   bool
+	manual    bool
+	onRevoked func(ctx context.Context, partitions []int32)
+	group     *memGroup
+	tracker   *commitTracker
+	paused    map[int32]bool
+	rr        int
+	closed    bool
+}
+
+func (r *memReader) Read(ctx context.Context) (*Message, error) {
+	for {
+		r.c.mtx.Lock()
+		if r.closed {
+			r.c.mtx.Unlock()
+			return nil, ErrReaderClosed
+		}
+		if msg := r.next(); msg != nil {
+			r.c.mtx.Unlock()
+			return msg, nil
+		}
+		changed := r.c.changed
+		r.c.mtx.Unlock()
+
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// Seek moves the reader, and for group readers the whole group, to the position on every partition.
+func (r *memReader) Seek(ctx context.Context, to Position) error {
+	r.c.mtx.Lock()
+	defer r.c.mtx.Unlock()
+
+	offsets := r.c.topics[r.topic].offsetsAt(to)
+	copy(r.group.next, offsets)
+	if r.grouped {
+		copy(r.group.committed, offsets)
+	}
+	for p := range offsets {
+		r.tracker.revoke(int32(p))
+	}
+	r.c.notify()
+	return nil
+}
+
+func (r *memReader) Commit(ctx context.Context) error {
+	r.c.mtx.Lock()
+	defer r.c.mtx.Unlock()
+
+	r.commit()
+	return nil
+}
+
+func (r *memReader) Pause(partitions ...int32) {
+	r.c.mtx.Lock()
+	defer r.c.mtx.Unlock()
+	for _, p := range partitions {
+		r.paused[p] = true
+	}
+}
+
+func (r *memReader) Resume(partitions ...int32) {
+	r.c.mtx.Lock()
+	defer r.c.mtx.Unlock()
+	for _, p := range partitions {
+		delete(r.paused, p)
+	}
+	r.c.notify()
+}
+
+// Assignment returns every partition of the topic.
+func (r *memReader) Assignment() []int32 {
+	r.c.mtx.Lock()
+	defer r.c.mtx.Unlock()
+	partitions := make([]int32, len(r.c.topic(r.topic).partitions))
+	for p := range partitions {
+		partitions[p] = int32(p)
+	}
+	return partitions
+}
+
+// Close commits what is done and hands the rest back to the group, as a rebalance would.
+func (r *memReader) Close() error {
+	r.c.mtx.Lock()
+	closed := r.closed
+	r.c.mtx.Unlock()
+	if r.onRevoked != nil && r.grouped && !closed {
+		r.onRevoked(context.Background(), r.Assignment())
+	}
+
+	r.c.mtx.Lock()
+	defer r.c.mtx.Unlock()
+
+	r.closed = true
+	if r.grouped {
+		r.commit()
+		copy(r.group.next, r.group.committed)
+	}
+	r.c.notify()
+	return nil
+}
+
+// commit commits the contiguous done offsets. Callers must hold mtx.
+func (r *memReader) commit() {
+	if !r.grouped {
+		return
+	}
+	offsets := r.tracker.commitable()
+	if len(offsets) == 0 {
+		return
+	}
+	r.c.commit(r.group, offsets)
+	r.tracker.committed(offsets)
+}
+
+func (r *memReader) done(p *partitionOffsets, offset int64) {
+	r.tracker.doneIn(p, offset)
+	if r.manual {
+		return
+	}
+
+	r.c.mtx.Lock()
+	defer r.c.mtx.Unlock()
+	r.commit()
+}
+
+// next returns the next unread message, visiting partitions round robin. Callers must hold mtx.
+func (r *memReader) next() *Message {
+	t := r.c.topics[r.topic]
+	n := len(t.partitions)
+	for i := 0; i < n; i++ {
+		p := (r.rr + i) % n
+		if r.paused[int32(p)] || r.group.next[p] >= int64(len(t.partitions[p])) {
+			continue
+		}
+		msg := t.partitions[p][r.group.next[p]].clone()
+		r.group.next[p]++
+		r.rr = p + 1
+		if r.grouped {
+			offset := msg.Offset
+			p := r.tracker.track(msg.Partition, offset, -1)
+			msg.done = func() { r.done(p, offset) }
+		}
+		return msg
+	}
+	return nil
+}
+
+type memWriter struct {
+	c           *MemoryClient
+	topic       string
+	partitioner Partitioner
+}
+
+func (w *memWriter) Write(ctx context.Context, key string, value []byte, options ...WriteOption) (Response, error) {
+	msg, err := newMessage(w.topic, key, value, options...)
+	if err != nil {
+		return Response{}, err
+	}
+
+	span, _ := startWriteSpan(ctx, w.c.tracer, msg)
+	defer span.Finish()
+
+	resp := w.c.append(msg, w.partitioner)
+	setSpanResponse(span, resp)
+	return resp, nil
+}
+
+func (w *memWriter) WriteBatch(ctx context.Context, records []Record) ([]Response, error) {
+	responses := make([]Response, len(records))
+	for i, r := range records {
+		responses[i], _ = w.Write(ctx, r.Key, r.Value, r.options()...)
+	}
+	return responses, nil
+}
+
+// WriteAsync writes the record straight away; there is nothing to buffer for in memory.
+func (w *memWriter) WriteAsync(ctx context.Context, record Record, onDelivery func(Delivery)) {
+	resp, err := w.Write(ctx, record.Key, record.Value, record.options()...)
+	if onDelivery != nil {
+		onDelivery(Delivery{Record: record, Response: resp, Err: err})
+	}
+}
+
+func (w *memWriter) Flush(ctx context.Context) error { return nil }
+
+func (m *Message) clone() *Message {
+	c := *m
+	c.done = nil
+	c.Headers = m.Headers.clone()
+	return &c
+}
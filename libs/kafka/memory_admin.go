@@ -0,0 +1,193 @@
+package kafka
+
+import (
+	"context"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/twmb/franz-go/pkg/kerr"
+)
+
+// CreateTopic creates the topic with spec.Partitions partitions, or the client's default if zero.
+func (c *MemoryClient) CreateTopic(ctx context.Context, spec TopicSpec) error {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	if _, ok := c.topics[spec.Topic]; ok {
+		return errors.Wrapf(kerr.TopicAlreadyExists, "failed to create topic %s", spec.Topic)
+	}
+	t := c.topic(spec.Topic)
+	if spec.Partitions > 0 {
+		t.partitions = make([][]*Message, spec.Partitions)
+	}
+	for k, v := range spec.Configs {
+		t.configs[k] = v
+	}
+	return nil
+}
+
+func (c *MemoryClient) EnsureTopics(ctx context.Context, specs ...TopicSpec) error {
+	for _, spec := range specs {
+		if err := c.CreateTopic(ctx, spec); err != nil && !errors.Is(err, kerr.TopicAlreadyExists) {
+			return err
+		}
+	}
+	return nil
+}
+
+// DeleteTopic drops the topic's messages and every group's offsets on it.
+func (c *MemoryClient) DeleteTopic(ctx context.Context, topic string) error {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	if _, ok := c.topics[topic]; !ok {
+		return errors.Wrapf(kerr.UnknownTopicOrPartition, "failed to delete topic %s", topic)
+	}
+	delete(c.topics, topic)
+	for key := range c.groups {
+		if strings.HasSuffix(key, "/"+topic) {
+			delete(c.groups, key)
+		}
+	}
+	return nil
+}
+
+func (c *MemoryClient) ListTopics(ctx context.Context) ([]string, error) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	topics := make([]string, 0, len(c.topics))
+	for name := range c.topics {
+		topics = append(topics, name)
+	}
+	sort.Strings(topics)
+	return topics, nil
+}
+
+func (c *MemoryClient) DescribeTopic(ctx context.Context, topic string) (TopicDescription, error) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	t, ok := c.topics[topic]
+	if !ok {
+		return TopicDescription{}, errors.Wrapf(kerr.UnknownTopicOrPartition, "failed to describe topic %s", topic)
+	}
+	desc := TopicDescription{
+		Topic:             topic,
+		Partitions:        int32(len(t.partitions)),
+		ReplicationFactor: 1,
+		Configs:           make(map[string]string, len(t.configs)),
+	}
+	for k, v := range t.configs {
+		desc.Configs[k] = v
+	}
+	return desc, nil
+}
+
+func (c *MemoryClient) EndOffsets(ctx context.Context, topic string) (map[int32]int64, error) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	t, ok := c.topics[topic]
+	if !ok {
+		return nil, errors.Wrapf(kerr.UnknownTopicOrPartition, "failed to list end offsets of topic %s", topic)
+	}
+	offsets := make(map[int32]int64, len(t.partitions))
+	for p, msgs := range t.partitions {
+		offsets[int32(p)] = int64(len(msgs))
+	}
+	return offsets, nil
+}
+
+// AlterTopicConfig stores the configs, they have no effect on the in-memory topic.
+func (c *MemoryClient) AlterTopicConfig(ctx context.Context, topic string, configs map[string]string) error {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	t, ok := c.topics[topic]
+	if !ok {
+		return errors.Wrapf(kerr.UnknownTopicOrPartition, "failed to alter topic %s", topic)
+	}
+	for k, v := range configs {
+		t.configs[k] = v
+	}
+	return nil
+}
+
+func (c *MemoryClient) ListGroups(ctx context.Context) ([]string, error) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	seen := make(map[string]bool)
+	var groups []string
+	for key := range c.groups {
+		group, _ := splitGroupKey(key)
+		if !seen[group] {
+			seen[group] = true
+			groups = append(groups, group)
+		}
+	}
+	sort.Strings(groups)
+	return groups, nil
+}
+
+// DescribeGroup reports the group's offsets and lag. Readers aren't tracked as members.
+func (c *MemoryClient) DescribeGroup(ctx context.Context, group string) (GroupDescription, error) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	desc := GroupDescription{
+		Group:   group,
+		State:   "Empty",
+		Offsets: make(map[string]map[int32]int64),
+		Lag:     make(map[string]map[int32]int64),
+	}
+	for key, g := range c.groups {
+		name, topic := splitGroupKey(key)
+		if name != group {
+			continue
+		}
+		t := c.topic(topic)
+		desc.Offsets[topic] = make(map[int32]int64)
+		desc.Lag[topic] = make(map[int32]int64)
+		for p, committed := range g.committed {
+			desc.Offsets[topic][int32(p)] = committed
+			desc.Lag[topic][int32(p)] = int64(len(t.partitions[p])) - committed
+		}
+	}
+	if len(desc.Offsets) == 0 {
+		return GroupDescription{}, errors.Wrapf(kerr.GroupIDNotFound, "failed to describe group %s", group)
+	}
+	return desc, nil
+}
+
+func (c *MemoryClient) DeleteGroup(ctx context.Context, group string) error {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	for key := range c.groups {
+		if name, _ := splitGroupKey(key); name == group {
+			delete(c.groups, key)
+		}
+	}
+	return nil
+}
+
+// ResetGroupOffsets moves the group's offsets. Readers of the group pick them up once they are closed and recreated.
+func (c *MemoryClient) ResetGroupOffsets(ctx context.Context, group, topic string, to Position) error {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	g := c.group(group, topic)
+	offsets := c.topic(topic).offsetsAt(to)
+	copy(g.committed, offsets)
+	copy(g.next, offsets)
+	c.notify()
+	return nil
+}
+
+func splitGroupKey(key string) (group, topic string) {
+	i := strings.LastIndex(key, "/")
+	return key[:i], key[i+1:]
+}
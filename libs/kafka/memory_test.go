@@ -0,0 +1,77 @@
+package kafka
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func Test_MemoryClient_KeysStickToPartitions(t *testing.T) {
+	ctx := context.Background()
+	c := NewMemoryClient(WithPartitions(4))
+	w, _ := c.Writer(ctx, Config{Topic: "listings"})
+
+	first, _ := w.Write(ctx, "zpid-1", []byte("a"))
+	second, _ := w.Write(ctx, "zpid-1", []byte("b"))
+	if first.Partition != second.Partition {
+		t.Errorf("same key landed on partitions %d and %d", first.Partition, second.Partition)
+	}
+	if second.Offset != first.Offset+1 {
+		t.Errorf("expected consecutive offsets, got %d and %d", first.Offset, second.Offset)
+	}
+	if got := len(c.Messages("listings")); got != 2 {
+		t.Errorf("expected 2 messages, got %d", got)
+	}
+}
+
+func Test_MemoryClient_GroupCommitsOnDone(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	c := NewMemoryClient()
+	w, _ := c.Writer(ctx, Config{Topic: "listings"})
+	_, _ = w.Write(ctx, "a", []byte("1"))
+	_, _ = w.Write(ctx, "b", []byte("2"))
+
+	r, _ := c.Reader(ctx, Config{Topic: "listings", GroupID: "g"})
+	msg, err := r.Read(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg.Done()
+	if _, err := r.Read(ctx); err != nil {
+		t.Fatal(err)
+	}
+	_ = r.Close()
+
+	if got := c.Committed("g", "listings")[0]; got != 1 {
+		t.Errorf("expected committed offset 1, got %d", got)
+	}
+
+	// The message that was read but not done is handed out again.
+	r, _ = c.Reader(ctx, Config{Topic: "listings", GroupID: "g"})
+	msg, err = r.Read(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg.Key != "b" {
+		t.Errorf("expected redelivery of b, got %q", msg.Key)
+	}
+}
+
+func Test_MemoryClient_WaitFor(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	c := NewMemoryClient()
+	w, _ := c.Writer(ctx, Config{Topic: "listings"})
+	go func() {
+		for i := 0; i < 3; i++ {
+			_, _ = w.Write(ctx, "", []byte("x"))
+		}
+	}()
+
+	if err := c.WaitFor(ctx, "listings", 3); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,105 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/twmb/franz-go/pkg/kerr"
+	"github.com/twmb/franz-go/pkg/kgo"
+	"github.com/zillow/howwegoatzillow/libs/metrics"
+)
+
+// Metrics reported when Config.Metrics is set.
+const (
+	MetricProduceMessages = "kafka.produce.messages"
+	MetricProduceBytes    = "kafka.produce.bytes"
+	MetricProduceLatency  = "kafka.produce.latency"
+	MetricProduceErrors   = "kafka.produce.errors"
+	MetricConsumeMessages = "kafka.consume.messages"
+	MetricConsumeBytes    = "kafka.consume.bytes"
+	MetricConsumeErrors   = "kafka.consume.errors"
+	MetricConsumerLag     = "kafka.consumer.lag"
+	MetricCommitLatency   = "kafka.commit.latency"
+	// MetricProduceCompressedBytes is the size of written batches after compression, next to the record
+	// sizes in MetricProduceBytes. MetricProduceCompressionRatio is a batch's uncompressed over compressed size.
+	MetricProduceCompressedBytes  = "kafka.produce.compressed_bytes"
+	MetricProduceCompressionRatio = "kafka.produce.compression_ratio"
+)
+
+// kgoHooks reports the kafka library's per record events as metrics.
+type kgoHooks struct {
+	m metrics.Metrics
+}
+
+var (
+	_ kgo.HookProduceRecordUnbuffered = (*kgoHooks)(nil)
+	_ kgo.HookFetchRecordUnbuffered   = (*kgoHooks)(nil)
+	_ kgo.HookProduceBatchWritten     = (*kgoHooks)(nil)
+)
+
+// OnProduceRecordUnbuffered is called once a record was written or failed. The record's timestamp
+// is set when it is handed to the library, so the latency includes time spent buffered and lingering.
+func (h *kgoHooks) OnProduceRecordUnbuffered(r *kgo.Record, err error) {
+	topic := metrics.T("topic", r.Topic)
+	if err != nil {
+		h.m.Count(MetricProduceMessages, 1, topic, metrics.T("status", "error"))
+		h.m.Count(MetricProduceErrors, 1, topic, metrics.T("error", errorType(err)))
+		return
+	}
+	h.m.Count(MetricProduceMessages, 1, topic, metrics.T("status", "ok"))
+	h.m.Count(MetricProduceBytes, int64(len(r.Key)+len(r.Value)), topic)
+	h.m.Timing(MetricProduceLatency, time.Since(r.Timestamp), topic)
+}
+
+// OnProduceBatchWritten is called once per batch written to a partition.
+func (h *kgoHooks) OnProduceBatchWritten(_ kgo.BrokerMetadata, topic string, _ int32, m kgo.ProduceBatchMetrics) {
+	tags := []metrics.Tag{metrics.T("topic", topic), metrics.T("compression", compressionName(m.CompressionType))}
+	h.m.Count(MetricProduceCompressedBytes, int64(m.CompressedBytes), tags...)
+	if m.CompressedBytes > 0 {
+		h.m.Gauge(MetricProduceCompressionRatio, float64(m.UncompressedBytes)/float64(m.CompressedBytes), tags...)
+	}
+}
+
+// OnFetchRecordUnbuffered is called once a fetched record was handed to a reader or dropped.
+func (h *kgoHooks) OnFetchRecordUnbuffered(r *kgo.Record, polled bool) {
+	if !polled {
+		return
+	}
+	topic := metrics.T("topic", r.Topic)
+	h.m.Count(MetricConsumeMessages, 1, topic)
+	h.m.Count(MetricConsumeBytes, int64(len(r.Key)+len(r.Value)), topic)
+}
+
+// reportLag reports, per partition, how many messages there are past the last one fetched.
+func reportLag(m metrics.Metrics, cfg Config, fetches kgo.Fetches) {
+	fetches.EachPartition(func(p kgo.FetchTopicPartition) {
+		if len(p.Records) == 0 {
+			return
+		}
+		lag := p.HighWatermark - p.Records[len(p.Records)-1].Offset - 1
+		m.Gauge(MetricConsumerLag, float64(lag),
+			metrics.T("topic", p.Topic),
+			metrics.T("partition", strconv.Itoa(int(p.Partition))),
+			metrics.T("group", cfg.GroupID))
+	})
+}
+
+// errorType names the kind of error for tagging, e.g. not_leader_for_partition or timeout.
+func errorType(err error) string {
+	var ke *kerr.Error
+	switch {
+	case errors.As(err, &ke):
+		return strings.ToLower(ke.Message)
+	case errors.Is(err, context.Canceled):
+		return "canceled"
+	case errors.Is(err, context.DeadlineExceeded), errors.Is(err, kgo.ErrRecordTimeout):
+		return "timeout"
+	case errors.Is(err, kgo.ErrClientClosed):
+		return "client_closed"
+	default:
+		return "other"
+	}
+}
@@ -0,0 +1,84 @@
+package kafka
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/opentracing/opentracing-go"
+	"github.com/zillow/howwegoatzillow/libs/metrics"
+)
+
+type recordedMetrics struct {
+	mtx    sync.Mutex
+	counts map[string]int64
+	gauges map[string]float64
+	timed  map[string]int
+}
+
+func newRecordedMetrics() *recordedMetrics {
+	return &recordedMetrics{counts: map[string]int64{}, gauges: map[string]float64{}, timed: map[string]int{}}
+}
+
+func (m *recordedMetrics) Count(name string, value int64, _ ...metrics.Tag) {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	m.counts[name] += value
+}
+
+func (m *recordedMetrics) Gauge(name string, value float64, _ ...metrics.Tag) {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	m.gauges[name] = value
+}
+
+func (m *recordedMetrics) Timing(name string, _ time.Duration, _ ...metrics.Tag) {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	m.timed[name]++
+}
+
+func Test_Client_ReportsMetrics(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	m := newRecordedMetrics()
+	cfg := newFakeCluster(t, "orders")
+	cfg.Metrics = m
+	c, cleanup := NewClient(cfg, opentracing.NoopTracer{}, nil)
+	defer cleanup()
+
+	w, _ := c.Writer(ctx, Config{Topic: "orders"})
+	for _, key := range []string{"a", "b"} {
+		if _, err := w.Write(ctx, key, []byte("value")); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	r, err := c.Reader(ctx, Config{Topic: "orders", GroupID: "g1", CommitMode: CommitManual})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	msg, err := r.Read(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg.Done()
+	if err := r.Commit(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	if m.counts[MetricProduceMessages] != 2 || m.counts[MetricProduceBytes] != 12 {
+		t.Errorf("unexpected produce counts %v", m.counts)
+	}
+	if m.counts[MetricConsumeMessages] == 0 || m.timed[MetricProduceLatency] != 2 || m.timed[MetricCommitLatency] != 1 {
+		t.Errorf("unexpected consume counts %v and timings %v", m.counts, m.timed)
+	}
+	if _, ok := m.gauges[MetricConsumerLag]; !ok {
+		t.Error("expected consumer lag to be reported")
+	}
+}
@@ -0,0 +1,142 @@
+package kafka
+
+import (
+	"time"
+
+	"github.com/opentracing/opentracing-go"
+	"github.com/zillow/howwegoatzillow/libs/metrics"
+)
+
+// MemoryOption interface to identify functional options that control the MemoryClient behavior
+type MemoryOption interface {
+	apply(c *MemoryClient)
+}
+
+// WithPartitions provides option to override how many partitions a topic gets when it is created. Default is 1.
+func WithPartitions(n int) MemoryOption { return partitionsOption{n} }
+
+type partitionsOption struct{ n int }
+
+func (p partitionsOption) apply(c *MemoryClient) {
+	if p.n > 0 {
+		c.partitions = p.n
+	}
+}
+
+// WithMemoryTracer provides option to override the tracer used by writers. default is noop
+func WithMemoryTracer(t opentracing.Tracer) MemoryOption { return memoryTracerOption{t} }
+
+type memoryTracerOption struct{ t opentracing.Tracer }
+
+func (m memoryTracerOption) apply(c *MemoryClient) {
+	if m.t != nil {
+		c.tracer = m.t
+	}
+}
+
+// WriteOption interface to identify functional options that control a single `Writer.Write`
+type WriteOption interface {
+	apply(m *Message)
+}
+
+// WithHeader provides option to set a header on the written message, replacing any value it already has.
+func WithHeader(key, value string) WriteOption { return headerOption{key, value} }
+
+type headerOption struct{ key, value string }
+
+func (h headerOption) apply(m *Message) { m.Headers.Set(h.key, h.value) }
+
+// WithHeaders provides option to append headers, in order, to the written message. Repeated keys are kept.
+func WithHeaders(headers ...Header) WriteOption { return headersOption{headers} }
+
+type headersOption struct{ headers Headers }
+
+func (h headersOption) apply(m *Message) {
+	for _, hdr := range h.headers {
+		m.Headers.Add(hdr.Key, hdr.Value)
+	}
+}
+
+// SpoolOption interface to identify functional options that control the SpoolClient behavior
+type SpoolOption interface {
+	apply(s *SpoolClient)
+}
+
+// WithSpoolMaxBytes provides option to override how large the spool may grow on disk. Default is 256MiB.
+func WithSpoolMaxBytes(n int64) SpoolOption { return spoolMaxBytesOption{n} }
+
+type spoolMaxBytesOption struct{ n int64 }
+
+func (o spoolMaxBytesOption) apply(s *SpoolClient) {
+	if o.n > 0 {
+		s.maxBytes = o.n
+	}
+}
+
+// WithSpoolWriteTimeout provides option to override how long a write may take before it is spooled. Default is 5s.
+func WithSpoolWriteTimeout(d time.Duration) SpoolOption { return spoolWriteTimeoutOption{d} }
+
+type spoolWriteTimeoutOption struct{ d time.Duration }
+
+func (o spoolWriteTimeoutOption) apply(s *SpoolClient) {
+	if o.d > 0 {
+		s.writeTimeout = o.d
+	}
+}
+
+// WithSpoolDrainInterval provides option to override how often the spool tries to drain. Default is 1s.
+func WithSpoolDrainInterval(d time.Duration) SpoolOption { return spoolDrainIntervalOption{d} }
+
+type spoolDrainIntervalOption struct{ d time.Duration }
+
+func (o spoolDrainIntervalOption) apply(s *SpoolClient) {
+	if o.d > 0 {
+		s.interval = o.d
+	}
+}
+
+// WithSpoolMetrics provides option to report the backlog and how many messages were spooled and drained. default is none
+func WithSpoolMetrics(m metrics.Metrics) SpoolOption { return spoolMetricsOption{m} }
+
+type spoolMetricsOption struct{ m metrics.Metrics }
+
+func (o spoolMetricsOption) apply(s *SpoolClient) {
+	if o.m != nil {
+		s.metrics = o.m
+	}
+}
+
+// TableOption interface to identify functional options that control the Table behavior
+type TableOption interface {
+	apply(t *Table)
+}
+
+// WithTableSnapshot provides option to save the table to path every interval and when Run returns,
+// and to start from it on the next Run instead of the beginning of the topic. default is no snapshots
+func WithTableSnapshot(path string, every time.Duration) TableOption {
+	return tableSnapshotOption{path, every}
+}
+
+type tableSnapshotOption struct {
+	path  string
+	every time.Duration
+}
+
+func (o tableSnapshotOption) apply(t *Table) {
+	if o.path != "" && o.every > 0 {
+		t.snapshotPath = o.path
+		t.snapshotEvery = o.every
+	}
+}
+
+// WithCatchUpIdle provides option to override how long the table waits for a message before it considers
+// itself caught up anyway, if it is within a few offsets of the end. Default is 5s.
+func WithCatchUpIdle(d time.Duration) TableOption { return catchUpIdleOption{d} }
+
+type catchUpIdleOption struct{ d time.Duration }
+
+func (o catchUpIdleOption) apply(t *Table) {
+	if o.d > 0 {
+		t.catchUpIdle = o.d
+	}
+}
@@ -0,0 +1,146 @@
+package kafka
+
+import (
+	"math/rand"
+	"sync"
+
+	"github.com/twmb/franz-go/pkg/kgo"
+)
+
+// Partitioner names accepted in Config.Partitioner.
+const (
+	// PartitionerMurmur2 hashes keys the way the Java client's default partitioner does,
+	// so a key lands on the same partition whichever language wrote it. This is the default.
+	PartitionerMurmur2 = "murmur2"
+	// PartitionerRoundRobin spreads records evenly over partitions, ignoring keys.
+	PartitionerRoundRobin = "roundrobin"
+	// PartitionerSticky sends records to one partition until a batch fills up, ignoring keys.
+	PartitionerSticky = "sticky"
+)
+
+// Partitioner picks the partition for a record. Custom implementations go in Config.CustomPartitioner.
+// Implementations must be safe for concurrent use.
+type Partitioner interface {
+	Partition(key []byte, numPartitions int) int
+}
+
+// Murmur2Partitioner returns the Java compatible key hashing partitioner. Records without a key go round robin.
+func Murmur2Partitioner() Partitioner { return &murmur2Partitioner{} }
+
+// RoundRobinPartitioner returns a partitioner that cycles through partitions.
+func RoundRobinPartitioner() Partitioner { return &roundRobinPartitioner{} }
+
+// StickyPartitioner returns a partitioner that keeps writing to one randomly chosen partition.
+func StickyPartitioner() Partitioner { return &stickyPartitioner{p: -1} }
+
+type murmur2Partitioner struct{ rr roundRobinPartitioner }
+
+func (m *murmur2Partitioner) Partition(key []byte, numPartitions int) int {
+	if len(key) == 0 {
+		return m.rr.Partition(key, numPartitions)
+	}
+	return int(toPositive(murmur2(key)) % int32(numPartitions))
+}
+
+type roundRobinPartitioner struct {
+	mtx  sync.Mutex
+	next int
+}
+
+func (r *roundRobinPartitioner) Partition(key []byte, numPartitions int) int {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	p := r.next % numPartitions
+	r.next++
+	return p
+}
+
+type stickyPartitioner struct {
+	mtx sync.Mutex
+	p   int
+}
+
+func (s *stickyPartitioner) Partition(key []byte, numPartitions int) int {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	if s.p < 0 || s.p >= numPartitions {
+		s.p = rand.Intn(numPartitions)
+	}
+	return s.p
+}
+
+// newPartitioner returns the partitioner the config asks for.
+func newPartitioner(cfg Config) Partitioner {
+	if cfg.CustomPartitioner != nil {
+		return cfg.CustomPartitioner
+	}
+	switch cfg.Partitioner {
+	case PartitionerRoundRobin:
+		return RoundRobinPartitioner()
+	case PartitionerSticky:
+		return StickyPartitioner()
+	default:
+		return Murmur2Partitioner()
+	}
+}
+
+// kgoPartitioner maps the config onto the producer's partitioners. The built in ones are used for
+// the named strategies since they also know when a batch is full, which sticky partitioning relies on.
+func kgoPartitioner(cfg Config) kgo.Partitioner {
+	if cfg.CustomPartitioner != nil {
+		p := cfg.CustomPartitioner
+		return kgo.BasicConsistentPartitioner(func(string) func(*kgo.Record, int) int {
+			return func(r *kgo.Record, n int) int { return p.Partition(r.Key, n) }
+		})
+	}
+	switch cfg.Partitioner {
+	case PartitionerRoundRobin:
+		return kgo.RoundRobinPartitioner()
+	case PartitionerSticky:
+		return kgo.StickyPartitioner()
+	default:
+		// Keyed records are murmur2 hashed exactly like the Java client, the rest are sticky.
+		return kgo.StickyKeyPartitioner(nil)
+	}
+}
+
+// murmur2 is the Java client's murmur2 hash, see org.apache.kafka.common.utils.Utils#murmur2.
+func murmur2(data []byte) int32 {
+	const (
+		seed uint32 = 0x9747b28c
+		m    uint32 = 0x5bd1e995
+		r           = 24
+	)
+
+	length := len(data)
+	h := seed ^ uint32(length)
+
+	for i := 0; i+4 <= length; i += 4 {
+		k := uint32(data[i]) | uint32(data[i+1])<<8 | uint32(data[i+2])<<16 | uint32(data[i+3])<<24
+		k *= m
+		k ^= k >> r
+		k *= m
+		h *= m
+		h ^= k
+	}
+
+	tail := length &^ 3
+	switch length % 4 {
+	case 3:
+		h ^= uint32(data[tail+2]) << 16
+		fallthrough
+	case 2:
+		h ^= uint32(data[tail+1]) << 8
+		fallthrough
+	case 1:
+		h ^= uint32(data[tail])
+		h *= m
+	}
+
+	h ^= h >> 13
+	h *= m
+	h ^= h >> 15
+	return int32(h)
+}
+
+func toPositive(n int32) int32 { return n & 0x7fffffff }
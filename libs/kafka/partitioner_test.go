@@ -0,0 +1,104 @@
+package kafka
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/opentracing/opentracing-go"
+)
+
+// Expected values come from the Java client's UtilsTest#testMurmur2.
+func Test_murmur2_MatchesJavaClient(t *testing.T) {
+	cases := map[string]int32{
+		"21":                         -973932308,
+		"foobar":                     -790332482,
+		"a-little-bit-long-string":   -985981536,
+		"a-little-bit-longer-string": -1486304829,
+		"lkjh234lh9fiuh90y23oiuhsafujhadof229phr9h19h89h8": -58897971,
+		"abc": 479470107,
+	}
+	for key, want := range cases {
+		if got := murmur2([]byte(key)); got != want {
+			t.Errorf("murmur2(%q) = %d, want %d", key, got, want)
+		}
+	}
+}
+
+func Test_Writer_PartitionsLikeMurmur2Partitioner(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	cfg := newFakeCluster(t, "orders")
+	c, cleanup := NewClient(cfg, opentracing.NoopTracer{}, nil)
+	defer cleanup()
+
+	w, _ := c.Writer(ctx, Config{Topic: "orders"})
+	p := Murmur2Partitioner()
+	for _, key := range []string{"zpid-1", "zpid-2", "zpid-3", "zpid-4", "zpid-5"} {
+		resp, err := w.Write(ctx, key, []byte("v"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := p.Partition([]byte(key), 3); int(resp.Partition) != want {
+			t.Errorf("key %s written to partition %d, want %d", key, resp.Partition, want)
+		}
+	}
+}
+
+type fixedPartitioner int
+
+func (f fixedPartitioner) Partition([]byte, int) int { return int(f) }
+
+func Test_Writer_UsesCustomPartitioner(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	cfg := newFakeCluster(t, "orders")
+	cfg.CustomPartitioner = fixedPartitioner(2)
+	c, cleanup := NewClient(cfg, opentracing.NoopTracer{}, nil)
+	defer cleanup()
+
+	w, _ := c.Writer(ctx, Config{Topic: "orders"})
+	resp, err := w.Write(ctx, "zpid-1", []byte("v"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Partition != 2 {
+		t.Errorf("expected partition 2, got %d", resp.Partition)
+	}
+}
+
+func Test_Client_WritersWithDifferentPartitionersAreNotShared(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	cfg := newFakeCluster(t, "regions")
+	c, cleanup := NewClient(cfg, opentracing.NoopTracer{}, nil)
+	defer cleanup()
+
+	first, _ := c.Writer(ctx, Config{Topic: "regions", CustomPartitioner: fixedPartitioner(0)})
+	second, _ := c.Writer(ctx, Config{Topic: "regions", CustomPartitioner: fixedPartitioner(2)})
+	if first == second {
+		t.Fatal("expected writers with different partitioners not to be shared")
+	}
+	again, _ := c.Writer(ctx, Config{Topic: "regions", CustomPartitioner: fixedPartitioner(0)})
+	if again != first {
+		t.Error("expected writers with the same settings to be shared")
+	}
+
+	for want, w := range map[int32]Writer{0: first, 2: second} {
+		resp, err := w.Write(ctx, "a", []byte("a"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.Partition != want {
+			t.Errorf("expected partition %d, got %d", want, resp.Partition)
+		}
+	}
+
+	roundRobin, _ := c.Writer(ctx, Config{Topic: "regions", Partitioner: PartitionerRoundRobin})
+	if roundRobin == first || roundRobin == second {
+		t.Error("expected a writer with a named partitioner not to share one with a custom partitioner")
+	}
+}
@@ -0,0 +1,420 @@
+package kafka
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/twmb/franz-go/pkg/kadm"
+	"github.com/twmb/franz-go/pkg/kerr"
+	"github.com/twmb/franz-go/pkg/kgo"
+	"github.com/twmb/franz-go/pkg/kmsg"
+	"github.com/zillow/howwegoatzillow/libs/metrics"
+)
+
+// ErrReaderClosed is returned by Read once the reader has been closed.
+var ErrReaderClosed = errors.New("kafka reader closed")
+
+const (
+	defaultCommitInterval = 5 * time.Second
+	closeCommitTimeout    = 10 * time.Second
+)
+
+type reader struct {
+	cl      *kgo.Client
+	config  Config
+	logger  Logger
+	tracker *commitTracker
+
+	commitMtx sync.Mutex
+	stop      chan struct{}
+	stopped   sync.WaitGroup
+
+	// pollMtx serializes reads, mtx guards what reads and seeks share.
+	pollMtx sync.Mutex
+	mtx     sync.Mutex
+	buf     []*kgo.Record
+	// assigned holds the partitions a group reader is assigned, or a reader without a group fetched from.
+	assigned map[int32]bool
+	paused   map[int32]bool
+	// cancelPoll wakes up the running poll, so a resumed partition's held back messages are returned.
+	cancelPoll context.CancelFunc
+	// seeks counts seeks, sought holds the count at which each partition was last sought.
+	seeks  int
+	sought map[int32]int
+}
+
+func (r *reader) Read(ctx context.Context) (*Message, error) {
+	r.pollMtx.Lock()
+	defer r.pollMtx.Unlock()
+
+	for {
+		r.mtx.Lock()
+		if rec := r.next(); rec != nil {
+			msg := fromRecord(rec, r.doneFunc(rec))
+			r.mtx.Unlock()
+			return msg, nil
+		}
+		seeks := r.seeks
+		pollCtx, cancel := context.WithCancel(ctx)
+		r.cancelPoll = cancel
+		r.mtx.Unlock()
+
+		// The poll isn't holding mtx, so a seek or resume can happen while it waits.
+		fetches := r.cl.PollFetches(pollCtx)
+		r.mtx.Lock()
+		r.cancelPoll = nil
+		r.mtx.Unlock()
+		woken := pollCtx.Err() != nil
+		cancel()
+		if fetches.IsClientClosed() {
+			return nil, ErrReaderClosed
+		}
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		// A poll woken up early fails with the cancellation on every partition.
+		records := fetches.Records()
+		if !woken {
+			var err error
+			if records, err = fetched(r.metrics(), r.logger, fetches); err != nil {
+				return nil, err
+			}
+		}
+		reportLag(r.metrics(), r.config, fetches)
+
+		r.mtx.Lock()
+		for _, rec := range records {
+			// Records of partitions sought during the poll are from before the seek.
+			if r.sought[rec.Partition] <= seeks {
+				r.buf = append(r.buf, rec)
+			}
+			if r.config.GroupID == "" {
+				r.assigned[rec.Partition] = true
+			}
+		}
+		r.mtx.Unlock()
+	}
+}
+
+// next takes the first buffered record of a partition that isn't paused. Callers must hold mtx.
+func (r *reader) next() *kgo.Record {
+	for i, rec := range r.buf {
+		if !r.paused[rec.Partition] {
+			r.buf = append(r.buf[:i], r.buf[i+1:]...)
+			return rec
+		}
+	}
+	return nil
+}
+
+func (r *reader) Pause(partitions ...int32) {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	for _, p := range partitions {
+		r.paused[p] = true
+	}
+	r.cl.PauseFetchPartitions(map[string][]int32{r.config.Topic: partitions})
+}
+
+func (r *reader) Resume(partitions ...int32) {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	held := false
+	for _, p := range partitions {
+		delete(r.paused, p)
+		for _, rec := range r.buf {
+			held = held || rec.Partition == p
+		}
+	}
+	r.cl.ResumeFetchPartitions(map[string][]int32{r.config.Topic: partitions})
+	if held && r.cancelPoll != nil {
+		r.cancelPoll()
+	}
+}
+
+func (r *reader) Assignment() []int32 {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	return sortedPartitions(r.assigned)
+}
+
+func (r *reader) Seek(ctx context.Context, to Position) error {
+	offsets, err := positionOffsets(ctx, kadm.NewClient(r.cl), r.config.Topic, to)
+	if err != nil {
+		return err
+	}
+
+	r.commitMtx.Lock()
+	defer r.commitMtx.Unlock()
+
+	toCommit, err := r.seek(offsets)
+	if err != nil || len(toCommit) == 0 || r.config.GroupID == "" {
+		return err
+	}
+	return errors.Wrapf(r.commitOffsets(ctx, toCommit), "failed to commit seek of topic %s", r.config.Topic)
+}
+
+// seek moves the partitions the reader reads to offsets, dropping what was read of them so far.
+// It returns the offsets to commit.
+func (r *reader) seek(offsets map[int32]int64) (map[int32]commitOffset, error) {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+
+	if r.config.GroupID != "" {
+		for p := range offsets {
+			if !r.assigned[p] {
+				delete(offsets, p)
+			}
+		}
+	}
+	if len(offsets) == 0 {
+		return nil, nil
+	}
+
+	r.seeks++
+	set := make(map[int32]kgo.EpochOffset, len(offsets))
+	toCommit := make(map[int32]commitOffset, len(offsets))
+	partitions := make([]int32, 0, len(offsets))
+	for p, o := range offsets {
+		set[p] = kgo.EpochOffset{Epoch: -1, Offset: o}
+		toCommit[p] = commitOffset{offset: o, epoch: -1}
+		partitions = append(partitions, p)
+		r.sought[p] = r.seeks
+	}
+	kept := r.buf[:0]
+	for _, rec := range r.buf {
+		if _, ok := offsets[rec.Partition]; !ok {
+			kept = append(kept, rec)
+		}
+	}
+	r.buf = kept
+
+	r.cl.SetOffsets(map[string]map[int32]kgo.EpochOffset{r.config.Topic: set})
+	r.tracker.revoke(partitions...)
+	return toCommit, nil
+}
+
+func (r *reader) Commit(ctx context.Context) error {
+	if r.config.GroupID == "" {
+		return nil
+	}
+
+	r.commitMtx.Lock()
+	defer r.commitMtx.Unlock()
+
+	offsets := r.tracker.commitable()
+	if len(offsets) == 0 {
+		return nil
+	}
+	if err := r.commitOffsets(ctx, offsets); err != nil {
+		return err
+	}
+
+	r.tracker.committed(offsets)
+	return nil
+}
+
+// commitOffsets commits offsets for the group and reports how long it took.
+func (r *reader) commitOffsets(ctx context.Context, offsets map[int32]commitOffset) error {
+	toCommit := make(map[int32]kgo.EpochOffset, len(offsets))
+	for p, o := range offsets {
+		toCommit[p] = kgo.EpochOffset{Epoch: o.epoch, Offset: o.offset}
+	}
+
+	start := time.Now()
+	var commitErr error
+	r.cl.CommitOffsetsSync(ctx, map[string]map[int32]kgo.EpochOffset{r.config.Topic: toCommit},
+		func(_ *kgo.Client, _ *kmsg.OffsetCommitRequest, resp *kmsg.OffsetCommitResponse, err error) {
+			if err != nil {
+				commitErr = err
+				return
+			}
+			for _, t := range resp.Topics {
+				for _, p := range t.Partitions {
+					if err := kerr.ErrorForCode(p.ErrorCode); err != nil && commitErr == nil {
+						commitErr = errors.Wrapf(err, "failed to commit partition %d", p.Partition)
+					}
+				}
+			}
+		})
+	status := "ok"
+	if commitErr != nil {
+		status = "error"
+	}
+	r.metrics().Timing(MetricCommitLatency, time.Since(start),
+		metrics.T("topic", r.config.Topic),
+		metrics.T("group", r.config.GroupID),
+		metrics.T("status", status))
+	return commitErr
+}
+
+func (r *reader) Close() error {
+	if r.stop != nil {
+		close(r.stop)
+		r.stopped.Wait()
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), closeCommitTimeout)
+	defer cancel()
+	err := r.Commit(ctx)
+
+	r.cl.Close()
+	return err
+}
+
+func (r *reader) startAutoCommit() {
+	interval := r.config.CommitInterval
+	if interval <= 0 {
+		interval = defaultCommitInterval
+	}
+
+	r.stop = make(chan struct{})
+	r.stopped.Add(1)
+	go func() {
+		defer r.stopped.Done()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-r.stop:
+				return
+			case <-ticker.C:
+				r.logCommitError(r.Commit(context.Background()))
+			}
+		}
+	}()
+}
+
+// onAssigned records the partitions the group reader now reads.
+func (r *reader) onAssigned(ctx context.Context, _ *kgo.Client, assigned map[string][]int32) {
+	r.mtx.Lock()
+	for _, p := range assigned[r.config.Topic] {
+		r.assigned[p] = true
+	}
+	r.mtx.Unlock()
+
+	if fn := r.config.OnPartitionsAssigned; fn != nil && len(assigned[r.config.Topic]) > 0 {
+		fn(ctx, assigned[r.config.Topic])
+	}
+}
+
+// onRevoked commits what is done on the partitions before another consumer takes them over.
+func (r *reader) onRevoked(ctx context.Context, _ *kgo.Client, revoked map[string][]int32) {
+	if fn := r.config.OnPartitionsRevoked; fn != nil && len(revoked[r.config.Topic]) > 0 {
+		fn(ctx, revoked[r.config.Topic])
+	}
+	r.logCommitError(r.Commit(ctx))
+	r.unassign(revoked[r.config.Topic])
+}
+
+// onLost drops the partitions without committing, they already belong to someone else.
+func (r *reader) onLost(ctx context.Context, _ *kgo.Client, lost map[string][]int32) {
+	if fn := r.config.OnPartitionsRevoked; fn != nil && len(lost[r.config.Topic]) > 0 {
+		fn(ctx, lost[r.config.Topic])
+	}
+	r.unassign(lost[r.config.Topic])
+}
+
+func (r *reader) unassign(partitions []int32) {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	for _, p := range partitions {
+		delete(r.assigned, p)
+	}
+	// Held back messages of revoked partitions are the next owner's to read.
+	kept := r.buf[:0]
+	for _, rec := range r.buf {
+		if r.assigned[rec.Partition] {
+			kept = append(kept, rec)
+		}
+	}
+	r.buf = kept
+	r.tracker.revoke(partitions...)
+}
+
+func sortedPartitions(partitions map[int32]bool) []int32 {
+	sorted := make([]int32, 0, len(partitions))
+	for p := range partitions {
+		sorted = append(sorted, p)
+	}
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	return sorted
+}
+
+// consumeFrom starts consuming every partition of the topic, at the given offsets or from start.
+func (r *reader) consumeFrom(ctx context.Context, offsets map[int32]int64, start kgo.Offset) error {
+	md, err := kadm.NewClient(r.cl).Metadata(ctx, r.config.Topic)
+	if err != nil {
+		return errors.Wrapf(err, "failed to get partitions of topic %s", r.config.Topic)
+	}
+	td, ok := md.Topics[r.config.Topic]
+	if !ok || td.Err != nil {
+		return errors.Wrapf(td.Err, "failed to get partitions of topic %s", r.config.Topic)
+	}
+
+	partitions := make(map[int32]kgo.Offset, len(td.Partitions))
+	for p := range td.Partitions {
+		partitions[p] = start
+		if o, ok := offsets[p]; ok {
+			partitions[p] = kgo.NewOffset().At(o)
+		}
+	}
+	r.cl.AddConsumePartitions(map[string]map[int32]kgo.Offset{r.config.Topic: partitions})
+	return nil
+}
+
+func (r *reader) metrics() metrics.Metrics { return metrics.OrNoop(r.config.Metrics) }
+
+// fetched returns the records of a poll. Fetch errors are counted and logged by partition, and only returned
+// when no partition fetched records: the commit would move past records dropped for another partition's error.
+func fetched(m metrics.Metrics, logger Logger, fetches kgo.Fetches) ([]*kgo.Record, error) {
+	records := fetches.Records()
+	for _, e := range fetches.Errors() {
+		m.Count(MetricConsumeErrors, 1, metrics.T("topic", e.Topic), metrics.T("error", errorType(e.Err)))
+		err := errors.Wrapf(e.Err, "failed to fetch topic %s partition %d", e.Topic, e.Partition)
+		if len(records) == 0 {
+			return nil, err
+		}
+		if logger != nil {
+			logger.Error(context.Background(), "failed to fetch kafka partition", "error", err)
+		}
+	}
+	return records, nil
+}
+
+func (r *reader) logCommitError(err error) {
+	if err != nil && r.logger != nil {
+		r.logger.Error(context.Background(), "failed to commit kafka offsets",
+			"error", err,
+			"topic", r.config.Topic,
+			"group", r.config.GroupID)
+	}
+}
+
+func (r *reader) doneFunc(rec *kgo.Record) func() {
+	if r.config.GroupID == "" {
+		return nil
+	}
+	p := r.tracker.track(rec.Partition, rec.Offset, rec.LeaderEpoch)
+	return func() { r.tracker.doneIn(p, rec.Offset) }
+}
+
+func fromRecord(rec *kgo.Record, done func()) *Message {
+	headers := make(Headers, 0, len(rec.Headers))
+	for _, h := range rec.Headers {
+		headers = append(headers, Header{Key: h.Key, Value: h.Value})
+	}
+	return &Message{
+		Key:       string(rec.Key),
+		Headers:   headers,
+		Topic:     rec.Topic,
+		Offset:    rec.Offset,
+		Partition: rec.Partition,
+		Timestamp: rec.Timestamp,
+		value:     rec.Value,
+		done:      done,
+	}
+}
@@ -0,0 +1,249 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/opentracing/opentracing-go"
+	"github.com/twmb/franz-go/pkg/kgo"
+)
+
+func Test_Reader_SeekCommitsForGroup(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	cfg := newFakeCluster(t, "regions")
+	c, cleanup := NewClient(cfg, opentracing.NoopTracer{}, nil)
+	defer cleanup()
+	w, _ := c.Writer(ctx, Config{Topic: "regions", CustomPartitioner: fixedPartitioner(0)})
+	for _, key := range []string{"a", "b", "c"} {
+		if _, err := w.Write(ctx, key, []byte(key)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	r, err := c.Reader(ctx, Config{Topic: "regions", GroupID: "g", CommitMode: CommitManual})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 3; i++ {
+		msg, err := r.Read(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		msg.Done()
+	}
+	if err := r.Seek(ctx, AtOffset(1)); err != nil {
+		t.Fatal(err)
+	}
+	// Done before the commit, but read before the seek: it must not move the group past the seek.
+	if err := r.Commit(ctx); err != nil {
+		t.Fatal(err)
+	}
+	msg, err := r.Read(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg.Key != "b" {
+		t.Errorf("expected to read b after seeking to offset 1, got %s", msg.Key)
+	}
+	_ = r.Close()
+
+	adm, closeAdmin, err := NewAdmin(cfg, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer closeAdmin()
+	desc, err := adm.DescribeGroup(ctx, "g")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := desc.Offsets["regions"][0]; got != 1 {
+		t.Errorf("expected the seek to be committed at 1, got %d", got)
+	}
+}
+
+func Test_Reader_StartFromLatest(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	cfg := newFakeCluster(t, "regions")
+	c, cleanup := NewClient(cfg, opentracing.NoopTracer{}, nil)
+	defer cleanup()
+	w, _ := c.Writer(ctx, Config{Topic: "regions", CustomPartitioner: fixedPartitioner(0)})
+	if _, err := w.Write(ctx, "old", []byte("old")); err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := c.Reader(ctx, Config{Topic: "regions", GroupID: "g", StartFrom: &Latest})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	// Keep writing until the reader has joined and started at the end, it must never see old.
+	go func() {
+		for ctx.Err() == nil {
+			_, _ = w.Write(ctx, "new", []byte("new"))
+			time.Sleep(100 * time.Millisecond)
+		}
+	}()
+	msg, err := r.Read(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg.Key != "new" {
+		t.Errorf("expected to start from the latest message, got %s", msg.Key)
+	}
+}
+
+func Test_MemoryClient_SeekAndStartFrom(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	c := NewMemoryClient()
+	w, _ := c.Writer(ctx, Config{Topic: "regions"})
+	for _, key := range []string{"a", "b", "c"} {
+		_, _ = w.Write(ctx, key, []byte(key))
+	}
+
+	r, _ := c.Reader(ctx, Config{Topic: "regions", GroupID: "g", StartFrom: &Latest})
+	_, _ = w.Write(ctx, "d", []byte("d"))
+	msg, err := r.Read(ctx)
+	if err != nil || msg.Key != "d" {
+		t.Fatalf("expected to start from the latest message, got %v %v", msg, err)
+	}
+	msg.Done()
+
+	if err := r.Seek(ctx, AtOffset(1)); err != nil {
+		t.Fatal(err)
+	}
+	if got := c.Committed("g", "regions")[0]; got != 1 {
+		t.Errorf("expected the seek to be committed at 1, got %d", got)
+	}
+	msg, _ = r.Read(ctx)
+	if msg.Key != "b" {
+		t.Errorf("expected to read b after seeking to offset 1, got %s", msg.Key)
+	}
+}
+
+func Test_Reader_PauseResumeAndAssignment(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	cfg := newFakeCluster(t, "regions")
+	c, cleanup := NewClient(cfg, opentracing.NoopTracer{}, nil)
+	defer cleanup()
+	w, _ := c.Writer(ctx, Config{Topic: "regions", CustomPartitioner: fixedPartitioner(0)})
+	for _, key := range []string{"a", "b"} {
+		if _, err := w.Write(ctx, key, []byte(key)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	assigned := make(chan []int32, 1)
+	r, err := c.Reader(ctx, Config{
+		Topic:                "regions",
+		GroupID:              "g",
+		OnPartitionsAssigned: func(_ context.Context, partitions []int32) { assigned <- partitions },
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	msg, err := r.Read(ctx)
+	if err != nil || msg.Key != "a" {
+		t.Fatalf("expected to read a, got %v %v", msg, err)
+	}
+	if got := <-assigned; len(got) != 3 {
+		t.Errorf("expected all 3 partitions to be assigned, got %v", got)
+	}
+	if got := r.Assignment(); len(got) != 3 || got[0] != 0 || got[2] != 2 {
+		t.Errorf("expected assignment [0 1 2], got %v", got)
+	}
+
+	// b was fetched together with a, pausing must hold it back until the partition is resumed.
+	r.Pause(0)
+	readCtx, cancelRead := context.WithTimeout(ctx, 500*time.Millisecond)
+	defer cancelRead()
+	if msg, err := r.Read(readCtx); err == nil {
+		t.Fatalf("expected no message from a paused partition, got %s", msg.Key)
+	}
+
+	go func() {
+		time.Sleep(200 * time.Millisecond)
+		r.Resume(0)
+	}()
+	msg, err = r.Read(ctx)
+	if err != nil || msg.Key != "b" {
+		t.Fatalf("expected to read b after resuming, got %v %v", msg, err)
+	}
+}
+
+func Test_MemoryClient_PauseAndRebalanceCallbacks(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	c := NewMemoryClient(WithPartitions(2))
+	w, _ := c.Writer(ctx, Config{Topic: "regions", CustomPartitioner: fixedPartitioner(0)})
+	_, _ = w.Write(ctx, "a", []byte("a"))
+
+	var assigned, revoked []int32
+	r, _ := c.Reader(ctx, Config{
+		Topic:                "regions",
+		GroupID:              "g",
+		OnPartitionsAssigned: func(_ context.Context, partitions []int32) { assigned = partitions },
+		OnPartitionsRevoked:  func(_ context.Context, partitions []int32) { revoked = partitions },
+	})
+	if len(assigned) != 2 {
+		t.Errorf("expected both partitions to be assigned, got %v", assigned)
+	}
+
+	r.Pause(0)
+	readCtx, cancelRead := context.WithTimeout(ctx, 100*time.Millisecond)
+	defer cancelRead()
+	if msg, err := r.Read(readCtx); err == nil {
+		t.Fatalf("expected no message from a paused partition, got %s", msg.Key)
+	}
+	r.Resume(0)
+	if msg, err := r.Read(ctx); err != nil || msg.Key != "a" {
+		t.Fatalf("expected to read a after resuming, got %v %v", msg, err)
+	}
+
+	_ = r.Close()
+	if len(revoked) != 2 {
+		t.Errorf("expected both partitions to be revoked on close, got %v", revoked)
+	}
+}
+
+func Test_Fetched_KeepsRecordsWhenAnotherPartitionFails(t *testing.T) {
+	m := newRecordedMetrics()
+	partitionErr := errors.New("not authorized")
+	fetches := kgo.Fetches{{Topics: []kgo.FetchTopic{{
+		Topic: "orders",
+		Partitions: []kgo.FetchPartition{
+			{Partition: 0, Err: partitionErr},
+			{Partition: 1, Records: []*kgo.Record{{Topic: "orders", Partition: 1, Offset: 7}}},
+		},
+	}}}}
+
+	records, err := fetched(m, nil, fetches)
+	if err != nil || len(records) != 1 || records[0].Offset != 7 {
+		t.Fatalf("expected the record of partition 1, got %v, %v", records, err)
+	}
+	if m.counts[MetricConsumeErrors] != 1 {
+		t.Errorf("expected the partition error to be counted, got %d", m.counts[MetricConsumeErrors])
+	}
+
+	// Without records from any partition the error is returned.
+	_, err = fetched(m, nil, kgo.Fetches{{Topics: []kgo.FetchTopic{{
+		Topic:      "orders",
+		Partitions: []kgo.FetchPartition{{Partition: 0, Err: partitionErr}},
+	}}}})
+	if !errors.Is(err, partitionErr) {
+		t.Errorf("expected the partition error, got %v", err)
+	}
+}
@@ -0,0 +1,100 @@
+package schemaregistry
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/hamba/avro/v2"
+	"github.com/pkg/errors"
+	"github.com/zillow/howwegoatzillow/libs/kafka"
+)
+
+// lookupTimeout bounds how long decoding waits on the registry for a schema it hasn't seen yet.
+const lookupTimeout = 10 * time.Second
+
+type avroCodec struct {
+	registry Client
+	id       int
+	schema   avro.Schema
+
+	mtx     sync.RWMutex
+	writers map[int]avro.Schema
+}
+
+// NewAvroCodec creates a kafka.Codec that encodes values with the Avro schema, registering it under subject.
+// Decoding uses the schema each payload was written with, looked up by the id in the payload.
+func NewAvroCodec(ctx context.Context, registry Client, subject, schema string) (kafka.Codec, error) {
+	parsed, err := avro.Parse(schema)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid avro schema")
+	}
+
+	id, err := register(ctx, registry, subject, Schema{Type: TypeAvro, Schema: schema})
+	if err != nil {
+		return nil, err
+	}
+
+	return &avroCodec{
+		registry: registry,
+		id:       id,
+		schema:   parsed,
+		writers:  map[int]avro.Schema{id: parsed},
+	}, nil
+}
+
+func (c *avroCodec) ContentType() string { return "application/vnd.confluent.avro" }
+
+func (c *avroCodec) Marshal(v interface{}) ([]byte, error) {
+	payload, err := avro.Marshal(c.schema, v)
+	if err != nil {
+		return nil, err
+	}
+	return frame(c.id, nil, payload), nil
+}
+
+func (c *avroCodec) Unmarshal(data []byte, v interface{}) error {
+	id, payload, err := unframe(data)
+	if err != nil {
+		return err
+	}
+	schema, err := c.writerSchema(id)
+	if err != nil {
+		return err
+	}
+	return avro.Unmarshal(schema, payload, v)
+}
+
+func (c *avroCodec) writerSchema(id int) (avro.Schema, error) {
+	c.mtx.RLock()
+	schema, ok := c.writers[id]
+	c.mtx.RUnlock()
+
+	if ok {
+		return schema, nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), lookupTimeout)
+	defer cancel()
+
+	s, err := c.registry.SchemaByID(ctx, id)
+	if err != nil && !isNotFound(err) {
+		// The payload may well be fine, the registry wasn't there to tell.
+		return nil, &kafka.TransientError{Err: err}
+	}
+	if err != nil {
+		return nil, err
+	}
+	if s.Type != TypeAvro {
+		return nil, errors.Errorf("schema %d is %s, not %s", id, s.Type, TypeAvro)
+	}
+	schema, err = avro.Parse(s.Schema)
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid avro schema %d", id)
+	}
+
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	c.writers[id] = schema
+	return schema, nil
+}
@@ -0,0 +1,217 @@
+// Package schemaregistry provides kafka.Codec implementations that speak the Confluent wire format
+// and register their schemas with a Confluent compatible schema registry.
+package schemaregistry
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const contentType = "application/vnd.schemaregistry.v1+json"
+
+// Schema types understood by the registry.
+const (
+	TypeAvro     = "AVRO"
+	TypeProtobuf = "PROTOBUF"
+)
+
+// Schema ...
+type Schema struct {
+	Type   string
+	Schema string
+}
+
+// Config ...
+type Config struct {
+	URL      string
+	Username string
+	Password string
+}
+
+// Client talks to the schema registry. Lookups are cached, schemas are immutable once registered.
+type Client interface {
+	Register(ctx context.Context, subject string, schema Schema) (int, error)
+	SchemaByID(ctx context.Context, id int) (Schema, error)
+	IsCompatible(ctx context.Context, subject string, schema Schema) (bool, error)
+}
+
+type client struct {
+	config     Config
+	httpClient *http.Client
+
+	mtx     sync.RWMutex
+	ids     map[string]int
+	schemas map[int]Schema
+}
+
+// NewClient creates a registry Client for the registry at config.URL.
+func NewClient(config Config, options ...Option) Client {
+	c := &client{
+		config:     config,
+		httpClient: &http.Client{Timeout: 10 * time.Second},
+		ids:        make(map[string]int),
+		schemas:    make(map[int]Schema),
+	}
+
+	for _, option := range options {
+		if option != nil {
+			option.apply(c)
+		}
+	}
+
+	return c
+}
+
+// ValueSubject returns the subject the registry's default TopicNameStrategy uses for values of topic.
+func ValueSubject(topic string) string { return topic + "-value" }
+
+// Register registers the schema under subject, returning its id. Registering an existing schema is a lookup.
+func (c *client) Register(ctx context.Context, subject string, schema Schema) (int, error) {
+	cacheKey := subject + "|" + schema.Type + "|" + schema.Schema
+
+	c.mtx.RLock()
+	id, ok := c.ids[cacheKey]
+	c.mtx.RUnlock()
+
+	if ok {
+		return id, nil
+	}
+
+	var resp struct {
+		ID int `json:"id"`
+	}
+	path := fmt.Sprintf("/subjects/%s/versions", url.PathEscape(subject))
+	if _, err := c.do(ctx, http.MethodPost, path, schemaRequest(schema), &resp); err != nil {
+		return 0, errors.Wrapf(err, "failed to register schema for subject %s", subject)
+	}
+
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	c.ids[cacheKey] = resp.ID
+	c.schemas[resp.ID] = schema
+	return resp.ID, nil
+}
+
+// SchemaByID fetches the schema registered with id.
+func (c *client) SchemaByID(ctx context.Context, id int) (Schema, error) {
+	c.mtx.RLock()
+	schema, ok := c.schemas[id]
+	c.mtx.RUnlock()
+
+	if ok {
+		return schema, nil
+	}
+
+	var resp struct {
+		Schema     string `json:"schema"`
+		SchemaType string `json:"schemaType"`
+	}
+	if _, err := c.do(ctx, http.MethodGet, fmt.Sprintf("/schemas/ids/%d", id), nil, &resp); err != nil {
+		return Schema{}, errors.Wrapf(err, "failed to fetch schema %d", id)
+	}
+
+	schema = Schema{Type: resp.SchemaType, Schema: resp.Schema}
+	if schema.Type == "" {
+		schema.Type = TypeAvro
+	}
+
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	c.schemas[id] = schema
+	return schema, nil
+}
+
+// IsCompatible checks the schema against the latest version registered under subject.
+// A subject that doesn't exist yet is compatible with anything.
+func (c *client) IsCompatible(ctx context.Context, subject string, schema Schema) (bool, error) {
+	var resp struct {
+		IsCompatible bool `json:"is_compatible"`
+	}
+	path := fmt.Sprintf("/compatibility/subjects/%s/versions/latest", url.PathEscape(subject))
+	status, err := c.do(ctx, http.MethodPost, path, schemaRequest(schema), &resp)
+	if status == http.StatusNotFound {
+		return true, nil
+	}
+	if err != nil {
+		return false, errors.Wrapf(err, "failed to check compatibility for subject %s", subject)
+	}
+	return resp.IsCompatible, nil
+}
+
+// statusError is the error of a request the registry answered with an error status.
+type statusError struct {
+	status  int
+	code    int
+	message string
+}
+
+func (e *statusError) Error() string {
+	return fmt.Sprintf("schema registry returned %d: %s (code %d)", e.status, e.message, e.code)
+}
+
+// isNotFound reports whether err is the registry saying what was asked for doesn't exist.
+func isNotFound(err error) bool {
+	var se *statusError
+	return errors.As(err, &se) && se.status == http.StatusNotFound
+}
+
+func (c *client) do(ctx context.Context, method, path string, body, out interface{}) (int, error) {
+	var reqBody bytes.Buffer
+	if body != nil {
+		if err := json.NewEncoder(&reqBody).Encode(body); err != nil {
+			return 0, err
+		}
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, strings.TrimRight(c.config.URL, "/")+path, &reqBody)
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Accept", contentType)
+	if body != nil {
+		req.Header.Set("Content-Type", contentType)
+	}
+	if c.config.Username != "" {
+		req.SetBasicAuth(c.config.Username, c.config.Password)
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= http.StatusBadRequest {
+		var regErr struct {
+			ErrorCode int    `json:"error_code"`
+			Message   string `json:"message"`
+		}
+		_ = json.NewDecoder(resp.Body).Decode(&regErr)
+		return resp.StatusCode, &statusError{status: resp.StatusCode, code: regErr.ErrorCode, message: regErr.Message}
+	}
+
+	return resp.StatusCode, json.NewDecoder(resp.Body).Decode(out)
+}
+
+type registerRequest struct {
+	Schema     string `json:"schema"`
+	SchemaType string `json:"schemaType,omitempty"`
+}
+
+func schemaRequest(s Schema) registerRequest {
+	req := registerRequest{Schema: s.Schema}
+	// The registry treats a missing type as AVRO and older registries reject the field altogether.
+	if s.Type != TypeAvro {
+		req.SchemaType = s.Type
+	}
+	return req
+}
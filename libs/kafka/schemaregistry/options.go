@@ -0,0 +1,22 @@
+package schemaregistry
+
+import (
+	"net/http"
+)
+
+// Option interface to identify functional options that control the registry Client
+type Option interface {
+	apply(c *client)
+}
+
+// WithHTTPClient provides option to override the http client used to talk to the registry.
+// Default is a plain http.Client with a 10 second timeout.
+func WithHTTPClient(h *http.Client) Option { return httpClientOption{h} }
+
+type httpClientOption struct{ h *http.Client }
+
+func (o httpClientOption) apply(c *client) {
+	if o.h != nil {
+		c.httpClient = o.h
+	}
+}
@@ -0,0 +1,63 @@
+package schemaregistry
+
+import (
+	"context"
+	"encoding/binary"
+
+	"github.com/pkg/errors"
+	"github.com/zillow/howwegoatzillow/libs/kafka"
+)
+
+type protobufCodec struct {
+	id      int
+	indexes []byte
+}
+
+// NewProtobufCodec creates a kafka.Codec for protobuf messages, registering schema, the .proto source, under subject.
+// Encoded values are expected to be the first message declared in schema.
+func NewProtobufCodec(ctx context.Context, registry Client, subject, schema string) (kafka.Codec, error) {
+	id, err := register(ctx, registry, subject, Schema{Type: TypeProtobuf, Schema: schema})
+	if err != nil {
+		return nil, err
+	}
+	// The wire format lists the path to the message within the schema. [0], the first message, is written as a single 0.
+	return &protobufCodec{id: id, indexes: []byte{0}}, nil
+}
+
+func (c *protobufCodec) ContentType() string { return "application/vnd.confluent.protobuf" }
+
+func (c *protobufCodec) Marshal(v interface{}) ([]byte, error) {
+	payload, err := kafka.Protobuf.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	return frame(c.id, c.indexes, payload), nil
+}
+
+func (c *protobufCodec) Unmarshal(data []byte, v interface{}) error {
+	_, payload, err := unframe(data)
+	if err != nil {
+		return err
+	}
+	payload, err = skipMessageIndexes(payload)
+	if err != nil {
+		return err
+	}
+	return kafka.Protobuf.Unmarshal(payload, v)
+}
+
+// skipMessageIndexes drops the zigzag varint encoded message index array that precedes the protobuf payload.
+func skipMessageIndexes(data []byte) ([]byte, error) {
+	count, n := binary.Varint(data)
+	if n <= 0 || count < 0 {
+		return nil, errors.New("invalid protobuf message indexes")
+	}
+	data = data[n:]
+	for i := int64(0); i < count; i++ {
+		if _, n = binary.Varint(data); n <= 0 {
+			return nil, errors.New("invalid protobuf message indexes")
+		}
+		data = data[n:]
+	}
+	return data, nil
+}
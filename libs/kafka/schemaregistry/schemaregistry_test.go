@@ -0,0 +1,209 @@
+package schemaregistry
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/hamba/avro/v2"
+	"github.com/zillow/howwegoatzillow/libs/kafka"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+// fakeRegistry implements the handful of registry endpoints the client uses.
+type fakeRegistry struct {
+	mtx          sync.Mutex
+	schemas      []registerRequest
+	subjects     map[string][]int
+	incompatible bool
+	unavailable  bool
+	lookups      int
+}
+
+func newFakeRegistry(t *testing.T) (*fakeRegistry, *httptest.Server) {
+	f := &fakeRegistry{subjects: map[string][]int{}}
+	srv := httptest.NewServer(http.HandlerFunc(f.serveHTTP))
+	t.Cleanup(srv.Close)
+	return f, srv
+}
+
+func (f *fakeRegistry) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+
+	var req registerRequest
+	_ = json.NewDecoder(r.Body).Decode(&req)
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+
+	switch {
+	case parts[0] == "compatibility":
+		if len(f.subjects[parts[2]]) == 0 {
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprint(w, `{"error_code":40401,"message":"Subject not found"}`)
+			return
+		}
+		fmt.Fprintf(w, `{"is_compatible":%t}`, !f.incompatible)
+	case parts[0] == "subjects":
+		for i, s := range f.schemas {
+			if s == req {
+				fmt.Fprintf(w, `{"id":%d}`, i+1)
+				return
+			}
+		}
+		f.schemas = append(f.schemas, req)
+		f.subjects[parts[1]] = append(f.subjects[parts[1]], len(f.schemas))
+		fmt.Fprintf(w, `{"id":%d}`, len(f.schemas))
+	case parts[0] == "schemas":
+		f.lookups++
+		var id int
+		fmt.Sscanf(parts[2], "%d", &id)
+		switch {
+		case f.unavailable:
+			w.WriteHeader(http.StatusServiceUnavailable)
+		case id < 1 || id > len(f.schemas):
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprint(w, `{"error_code":40403,"message":"Schema not found"}`)
+		default:
+			_ = json.NewEncoder(w).Encode(f.schemas[id-1])
+		}
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+const listingSchema = `{
+	"type": "record",
+	"name": "Listing",
+	"fields": [
+		{"name": "zpid", "type": "long"},
+		{"name": "price", "type": "string"}
+	]
+}`
+
+type listing struct {
+	Zpid  int64  `avro:"zpid"`
+	Price string `avro:"price"`
+}
+
+func Test_AvroCodec_RoundTripsThroughWireFormat(t *testing.T) {
+	ctx := context.Background()
+	fake, srv := newFakeRegistry(t)
+	registry := NewClient(Config{URL: srv.URL})
+
+	codec, err := NewAvroCodec(ctx, registry, ValueSubject("listings"), listingSchema)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c := kafka.NewMemoryClient()
+	w, _ := c.Writer(ctx, kafka.Config{Topic: "listings"})
+	if _, err := kafka.NewTypedWriter[listing](w, codec).Write(ctx, "1", listing{Zpid: 1, Price: "100"}); err != nil {
+		t.Fatal(err)
+	}
+
+	msg := c.Messages("listings")[0]
+	if id, _, err := unframe(msg.Value()); err != nil || id != 1 {
+		t.Fatalf("expected schema id 1 in the payload, got %d (%v)", id, err)
+	}
+
+	// A fresh codec has to look the writer schema up, and caches it afterwards.
+	reader := &avroCodec{registry: NewClient(Config{URL: srv.URL}), writers: map[int]avro.Schema{}}
+	for i := 0; i < 2; i++ {
+		got, err := kafka.Decode[listing](msg, reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != (listing{Zpid: 1, Price: "100"}) {
+			t.Errorf("unexpected value %+v", got)
+		}
+	}
+	fake.mtx.Lock()
+	defer fake.mtx.Unlock()
+	if fake.lookups != 1 {
+		t.Errorf("expected 1 schema lookup, got %d", fake.lookups)
+	}
+}
+
+func Test_ProtobufCodec_RoundTripsThroughWireFormat(t *testing.T) {
+	ctx := context.Background()
+	_, srv := newFakeRegistry(t)
+
+	codec, err := NewProtobufCodec(ctx, NewClient(Config{URL: srv.URL}), ValueSubject("greetings"),
+		`syntax = "proto3"; message StringValue { string value = 1; }`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := codec.Marshal(wrapperspb.String("hello"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data[5] != 0 {
+		t.Errorf("expected the [0] message index shortcut, got %d", data[5])
+	}
+
+	var got *wrapperspb.StringValue
+	if err := codec.Unmarshal(data, &got); err != nil {
+		t.Fatal(err)
+	}
+	if got.GetValue() != "hello" {
+		t.Errorf("unexpected value %q", got.GetValue())
+	}
+}
+
+func Test_NewAvroCodec_FailsOnIncompatibleSchema(t *testing.T) {
+	ctx := context.Background()
+	fake, srv := newFakeRegistry(t)
+	registry := NewClient(Config{URL: srv.URL})
+
+	if _, err := NewAvroCodec(ctx, registry, "listings-value", listingSchema); err != nil {
+		t.Fatal(err)
+	}
+
+	fake.mtx.Lock()
+	fake.incompatible = true
+	fake.mtx.Unlock()
+	_, err := NewAvroCodec(ctx, registry, "listings-value", strings.Replace(listingSchema, `"long"`, `"string"`, 1))
+	if !errors.Is(err, ErrIncompatibleSchema) {
+		t.Errorf("expected ErrIncompatibleSchema, got %v", err)
+	}
+}
+
+func Test_AvroCodec_RegistryOutageIsNotADecodeError(t *testing.T) {
+	ctx := context.Background()
+	fake, srv := newFakeRegistry(t)
+	codec, err := NewAvroCodec(ctx, NewClient(Config{URL: srv.URL}), ValueSubject("listings"), listingSchema)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := kafka.NewMemoryClient()
+	w, _ := c.Writer(ctx, kafka.Config{Topic: "listings"})
+	_, _ = kafka.NewTypedWriter[listing](w, codec).Write(ctx, "1", listing{Zpid: 1, Price: "100"})
+	msg := c.Messages("listings")[0]
+
+	fake.mtx.Lock()
+	fake.unavailable = true
+	fake.mtx.Unlock()
+
+	reader := &avroCodec{registry: NewClient(Config{URL: srv.URL}), writers: map[int]avro.Schema{}}
+	_, err = kafka.Decode[listing](msg, reader)
+	var decodeErr *kafka.DecodeError
+	if err == nil || errors.As(err, &decodeErr) {
+		t.Fatalf("expected a registry outage to be retryable, got %v", err)
+	}
+
+	// A schema id the registry doesn't know is the payload's fault.
+	unknown := frame(42, nil, []byte{0})
+	fake.mtx.Lock()
+	fake.unavailable = false
+	fake.mtx.Unlock()
+	if err := reader.Unmarshal(unknown, &listing{}); err == nil || !isNotFound(err) {
+		t.Fatalf("expected the unknown schema to be not found, got %v", err)
+	}
+}
@@ -0,0 +1,46 @@
+package schemaregistry
+
+import (
+	"context"
+	"encoding/binary"
+
+	"github.com/pkg/errors"
+)
+
+// magicByte starts every payload in the Confluent wire format. It is followed by the 4 byte big endian schema id.
+const magicByte byte = 0
+
+// ErrIncompatibleSchema is returned when a codec's schema can't be registered because
+// it breaks the compatibility rules configured for its subject.
+var ErrIncompatibleSchema = errors.New("schema is not compatible with the registered subject")
+
+func frame(id int, prefix, payload []byte) []byte {
+	out := make([]byte, 5, 5+len(prefix)+len(payload))
+	out[0] = magicByte
+	binary.BigEndian.PutUint32(out[1:5], uint32(id))
+	out = append(out, prefix...)
+	return append(out, payload...)
+}
+
+func unframe(data []byte) (int, []byte, error) {
+	if len(data) < 5 {
+		return 0, nil, errors.Errorf("payload of %d bytes is too short for the schema registry wire format", len(data))
+	}
+	if data[0] != magicByte {
+		return 0, nil, errors.Errorf("unknown magic byte %d", data[0])
+	}
+	return int(binary.BigEndian.Uint32(data[1:5])), data[5:], nil
+}
+
+// register checks the schema is compatible with its subject and registers it.
+// Codecs do this once when they are created, so an incompatible schema stops a writer from starting.
+func register(ctx context.Context, registry Client, subject string, schema Schema) (int, error) {
+	ok, err := registry.IsCompatible(ctx, subject, schema)
+	if err != nil {
+		return 0, err
+	}
+	if !ok {
+		return 0, errors.Wrapf(ErrIncompatibleSchema, "subject %s", subject)
+	}
+	return registry.Register(ctx, subject, schema)
+}
@@ -0,0 +1,118 @@
+package kafka
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"os"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/twmb/franz-go/pkg/kgo"
+	"github.com/twmb/franz-go/pkg/sasl"
+	"github.com/twmb/franz-go/pkg/sasl/plain"
+	"github.com/twmb/franz-go/pkg/sasl/scram"
+)
+
+// SASL mechanisms accepted in SASLConfig.Mechanism.
+const (
+	SASLPlain       = "PLAIN"
+	SASLScramSHA256 = "SCRAM-SHA-256"
+	SASLScramSHA512 = "SCRAM-SHA-512"
+)
+
+// TLSConfig enables TLS to the brokers. Certificates are read from files when a reader, writer or admin
+// is created, so rotated certificates are picked up by new clients without a restart.
+type TLSConfig struct {
+	// CAFile is the PEM bundle brokers are verified against. Default is the system pool.
+	CAFile string
+	// CertFile and KeyFile are the PEM client certificate and key, for clusters that require mutual TLS.
+	CertFile string
+	KeyFile  string
+	// ServerName overrides the name the broker certificates are verified for.
+	ServerName         string
+	InsecureSkipVerify bool
+}
+
+// SASLConfig authenticates to the brokers with SASL.
+type SASLConfig struct {
+	// Mechanism is SASLPlain, SASLScramSHA256 or SASLScramSHA512.
+	Mechanism string
+	Username  string
+	// Password is used if set, otherwise it is read from PasswordFile, e.g. a mounted kubernetes secret.
+	Password     string `json:"-"`
+	PasswordFile string
+}
+
+func (c Config) securityOpts() ([]kgo.Opt, error) {
+	var opts []kgo.Opt
+
+	if c.TLS != nil {
+		tlsCfg, err := c.TLS.build()
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, kgo.DialTLSConfig(tlsCfg))
+	}
+
+	if c.SASL != nil {
+		mechanism, err := c.SASL.build()
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, kgo.SASL(mechanism))
+	}
+
+	return opts, nil
+}
+
+func (t *TLSConfig) build() (*tls.Config, error) {
+	cfg := &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		ServerName:         t.ServerName,
+		InsecureSkipVerify: t.InsecureSkipVerify, //nolint:gosec // opt-in for local clusters
+	}
+
+	if t.CAFile != "" {
+		pem, err := os.ReadFile(t.CAFile)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to read kafka CA file")
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, errors.Errorf("no certificates found in kafka CA file %s", t.CAFile)
+		}
+		cfg.RootCAs = pool
+	}
+
+	if t.CertFile != "" || t.KeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(t.CertFile, t.KeyFile)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to load kafka client certificate")
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+
+	return cfg, nil
+}
+
+func (s *SASLConfig) build() (sasl.Mechanism, error) {
+	password := s.Password
+	if password == "" && s.PasswordFile != "" {
+		b, err := os.ReadFile(s.PasswordFile)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to read kafka SASL password file")
+		}
+		password = strings.TrimSpace(string(b))
+	}
+
+	switch strings.ToUpper(s.Mechanism) {
+	case SASLPlain:
+		return plain.Auth{User: s.Username, Pass: password}.AsMechanism(), nil
+	case SASLScramSHA256:
+		return scram.Auth{User: s.Username, Pass: password}.AsSha256Mechanism(), nil
+	case SASLScramSHA512:
+		return scram.Auth{User: s.Username, Pass: password}.AsSha512Mechanism(), nil
+	default:
+		return nil, errors.Errorf("unsupported kafka SASL mechanism %q", s.Mechanism)
+	}
+}
@@ -0,0 +1,60 @@
+package kafka
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/opentracing/opentracing-go"
+	"github.com/twmb/franz-go/pkg/kfake"
+)
+
+func Test_Client_AuthenticatesWithScramPasswordFile(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	cluster, err := kfake.NewCluster(
+		kfake.NumBrokers(1),
+		kfake.SeedTopics(1, "orders"),
+		kfake.EnableSASL(),
+		kfake.Superuser(SASLScramSHA512, "svc", "s3cret"),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cluster.Close()
+
+	passwordFile := filepath.Join(t.TempDir(), "password")
+	if err := os.WriteFile(passwordFile, []byte("s3cret\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := Config{
+		BootstrapServers: cluster.ListenAddrs(),
+		SASL:             &SASLConfig{Mechanism: SASLScramSHA512, Username: "svc", PasswordFile: passwordFile},
+	}
+	c, cleanup := NewClient(cfg, opentracing.NoopTracer{}, nil)
+	defer cleanup()
+
+	w, err := c.Writer(ctx, Config{Topic: "orders"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.Write(ctx, "a", []byte("a")); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func Test_Config_SecurityErrors(t *testing.T) {
+	for name, cfg := range map[string]Config{
+		"unknown mechanism":     {SASL: &SASLConfig{Mechanism: "GSSAPI"}},
+		"missing password file": {SASL: &SASLConfig{Mechanism: SASLPlain, PasswordFile: "/does/not/exist"}},
+		"missing CA file":       {TLS: &TLSConfig{CAFile: "/does/not/exist"}},
+	} {
+		if _, err := cfg.securityOpts(); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
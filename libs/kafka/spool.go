@@ -0,0 +1,605 @@
+package kafka
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/zillow/howwegoatzillow/libs/metrics"
+)
+
+// ErrSpoolFull is returned when a write fails and the spool has no room left to keep it.
+var ErrSpoolFull = errors.New("kafka spool is full")
+
+// Metrics reported by the spool.
+const (
+	MetricSpoolMessages = "kafka.spool.messages"
+	MetricSpoolBytes    = "kafka.spool.bytes"
+	MetricSpoolSpooled  = "kafka.spool.spooled"
+	MetricSpoolDrained  = "kafka.spool.drained"
+)
+
+const (
+	// spoolSegmentFile is the name of a log segment by its sequence number.
+	spoolSegmentFile = "spool-%020d.log"
+	spoolPosFile     = "spool.pos"
+	// spoolFrameHeader is the length and crc32 in front of every entry.
+	spoolFrameHeader = 8
+	// spoolSegments is about how many segments a full spool is split in, drained ones are deleted.
+	spoolSegments = 8
+	// spoolDrainBatch caps how many entries are read and written at once while draining.
+	spoolDrainBatch = 1000
+)
+
+// SpoolResponse is what a write kept in the spool returns in place of where it was written.
+var SpoolResponse = Response{Partition: -1, Offset: -1}
+
+// SpoolClient wraps a Client so writes that fail, e.g. while the brokers are unreachable, go to a write ahead log
+// on disk instead of failing. Spooled writes return SpoolResponse and are drained in order once the brokers are back.
+// While anything is spooled new writes are spooled too, so they stay behind the ones written before them.
+// The log is split in segments, which are deleted once drained, so a spool that never drains completely
+// still gives back the space.
+//
+// Writes are stamped with their ce_id before the first attempt, so a write that timed out but reached
+// the broker anyway has the same id when it is drained and idempotent consumers drop the duplicate.
+type SpoolClient struct {
+	c      Client
+	logger Logger
+
+	dir          string
+	maxBytes     int64
+	writeTimeout time.Duration
+	interval     time.Duration
+	metrics      metrics.Metrics
+
+	mtx sync.Mutex
+	// segments are the log segments, oldest first. Entries are appended to the last one, which is open in log.
+	segments []spoolSegment
+	log      *os.File
+	pos      int64 // bytes of the first segment already drained
+	backlog  int64 // bytes spooled and not drained yet
+	messages int
+	lastErr  error
+	// rejected is set once a write didn't fit, until the backlog is drained.
+	rejected bool
+
+	stop    chan struct{}
+	stopped sync.WaitGroup
+}
+
+// SpoolStatus is a snapshot of the spool's backlog.
+type SpoolStatus struct {
+	Messages  int    `json:"messages"`
+	Bytes     int64  `json:"bytes"`
+	MaxBytes  int64  `json:"maxBytes"`
+	LastError string `json:"lastError,omitempty"`
+}
+
+type spoolSegment struct {
+	seq  int64
+	size int64
+}
+
+type spoolEntry struct {
+	Topic   string  `json:"topic"`
+	Key     string  `json:"key"`
+	Value   []byte  `json:"value"`
+	Headers Headers `json:"headers"`
+}
+
+// NewSpoolClient spools failed writes to c under dir, picking up whatever an earlier run left there.
+// The returned func stops draining and closes the log, call it before closing c.
+func NewSpoolClient(c Client, dir string, logger Logger, options ...SpoolOption) (*SpoolClient, func(), error) {
+	s := &SpoolClient{
+		c:            c,
+		logger:       logger,
+		dir:          dir,
+		maxBytes:     256 << 20,
+		writeTimeout: 5 * time.Second,
+		interval:     time.Second,
+		metrics:      metrics.Noop{},
+		stop:         make(chan struct{}),
+	}
+	for _, option := range options {
+		if option != nil {
+			option.apply(s)
+		}
+	}
+
+	if err := s.open(); err != nil {
+		return nil, nil, err
+	}
+	s.stopped.Add(1)
+	go s.drainLoop()
+
+	return s, s.close, nil
+}
+
+func (s *SpoolClient) Reader(ctx context.Context, topicConfig Config) (Reader, error) {
+	return s.c.Reader(ctx, topicConfig)
+}
+
+func (s *SpoolClient) Writer(ctx context.Context, topicConfig Config) (Writer, error) {
+	w, err := s.c.Writer(ctx, topicConfig)
+	if err != nil {
+		return nil, err
+	}
+	return &spoolWriter{w: w, topic: topicConfig.Topic, s: s}, nil
+}
+
+// Status returns the current backlog.
+func (s *SpoolClient) Status() SpoolStatus {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	st := SpoolStatus{Messages: s.messages, Bytes: s.backlog, MaxBytes: s.maxBytes}
+	if s.lastErr != nil {
+		st.LastError = s.lastErr.Error()
+	}
+	return st
+}
+
+// ReadinessCheck reports the service unready once the spool is 90% full or turned a write away, so traffic moves to instances
+// that can still take writes. Use it with server.WithReadinessCheck.
+func (s *SpoolClient) ReadinessCheck(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		s.mtx.Lock()
+		full := s.rejected || s.backlog >= s.maxBytes/10*9
+		s.mtx.Unlock()
+		if !full {
+			next(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusServiceUnavailable)
+		_ = json.NewEncoder(w).Encode(s.Status())
+	}
+}
+
+func (s *SpoolClient) open() error {
+	if err := os.MkdirAll(s.dir, 0o755); err != nil {
+		return errors.Wrapf(err, "failed to create spool dir %s", s.dir)
+	}
+	names, err := filepath.Glob(filepath.Join(s.dir, "spool-*.log"))
+	if err != nil {
+		return errors.Wrap(err, "failed to list spool segments")
+	}
+	var seqs []int64
+	for _, name := range names {
+		var seq int64
+		if _, err := fmt.Sscanf(filepath.Base(name), spoolSegmentFile, &seq); err == nil {
+			seqs = append(seqs, seq)
+		}
+	}
+	sort.Slice(seqs, func(i, j int) bool { return seqs[i] < seqs[j] })
+
+	var posSeq, pos int64
+	if b, err := os.ReadFile(filepath.Join(s.dir, spoolPosFile)); err == nil {
+		_, _ = fmt.Sscanf(string(b), "%d %d", &posSeq, &pos)
+	}
+
+	for _, seq := range seqs {
+		// Segments before the position were drained, the process stopped before deleting them.
+		if seq < posSeq {
+			if err := os.Remove(s.segmentPath(seq)); err != nil {
+				return errors.Wrap(err, "failed to delete drained spool segment")
+			}
+			continue
+		}
+		from := int64(0)
+		if seq == posSeq && len(s.segments) == 0 {
+			from = pos
+		}
+		// Count what is left to drain. A torn entry at the end, from a crash mid write, is cut off.
+		from, size, n, err := s.scanSegment(seq, from)
+		if err != nil {
+			return err
+		}
+		if len(s.segments) == 0 {
+			s.pos = from
+		}
+		s.segments = append(s.segments, spoolSegment{seq: seq, size: size})
+		s.backlog += size - from
+		s.messages += n
+	}
+	if len(s.segments) == 0 {
+		s.segments = []spoolSegment{{seq: posSeq}}
+	}
+
+	last := s.segments[len(s.segments)-1]
+	f, err := os.OpenFile(s.segmentPath(last.seq), os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return errors.Wrap(err, "failed to open spool")
+	}
+	if err := f.Truncate(last.size); err != nil {
+		f.Close()
+		return errors.Wrap(err, "failed to truncate spool")
+	}
+	if _, err := f.Seek(last.size, io.SeekStart); err != nil {
+		f.Close()
+		return errors.Wrap(err, "failed to open spool")
+	}
+	s.log = f
+	s.reportBacklog()
+	return nil
+}
+
+// scanSegment returns where the entries of the segment left to drain start and end, and how many there are.
+func (s *SpoolClient) scanSegment(seq, from int64) (int64, int64, int, error) {
+	f, err := os.Open(s.segmentPath(seq))
+	if err != nil {
+		return 0, 0, 0, errors.Wrap(err, "failed to open spool segment")
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return 0, 0, 0, errors.Wrap(err, "failed to open spool segment")
+	}
+	// A position past the end means the segment was emptied before the position was saved.
+	if from > info.Size() {
+		from = 0
+	}
+	end, n := from, 0
+	err = readEntries(f, from, -1, func(_ spoolEntry, next int64) error {
+		end, n = next, n+1
+		return nil
+	})
+	return from, end, n, err
+}
+
+func (s *SpoolClient) segmentPath(seq int64) string {
+	return filepath.Join(s.dir, fmt.Sprintf(spoolSegmentFile, seq))
+}
+
+func (s *SpoolClient) close() {
+	close(s.stop)
+	s.stopped.Wait()
+
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	_ = s.log.Close()
+}
+
+// spooling reports whether there is a backlog new writes have to queue behind.
+func (s *SpoolClient) spooling() bool {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	return s.messages > 0
+}
+
+// spool appends msg to the log. cause is why it couldn't be written straight away, if it was tried.
+func (s *SpoolClient) spool(msg *Message, cause error) (Response, error) {
+	data, err := json.Marshal(spoolEntry{Topic: msg.Topic, Key: msg.Key, Value: msg.value, Headers: msg.Headers})
+	if err != nil {
+		return Response{}, errors.Wrap(err, "failed to encode spool entry")
+	}
+	frame := make([]byte, spoolFrameHeader+len(data))
+	binary.BigEndian.PutUint32(frame, uint32(len(data)))
+	binary.BigEndian.PutUint32(frame[4:], crc32.ChecksumIEEE(data))
+	copy(frame[spoolFrameHeader:], data)
+
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	if s.backlog+int64(len(frame)) > s.maxBytes {
+		s.rejected = true
+		if cause != nil {
+			return Response{}, errors.Wrapf(ErrSpoolFull, "%v", cause)
+		}
+		return Response{}, ErrSpoolFull
+	}
+	last := &s.segments[len(s.segments)-1]
+	if last.size > 0 && last.size+int64(len(frame)) > s.maxBytes/spoolSegments {
+		if err := s.roll(); err != nil {
+			return Response{}, err
+		}
+		last = &s.segments[len(s.segments)-1]
+	}
+	if _, err := s.log.Write(frame); err != nil {
+		// Drop whatever part made it, so the next entry starts on a frame boundary.
+		_ = s.log.Truncate(last.size)
+		_, _ = s.log.Seek(last.size, io.SeekStart)
+		return Response{}, errors.Wrap(err, "failed to write spool")
+	}
+	if err := s.log.Sync(); err != nil {
+		return Response{}, errors.Wrap(err, "failed to sync spool")
+	}
+	last.size += int64(len(frame))
+	s.backlog += int64(len(frame))
+	s.messages++
+	if cause != nil {
+		s.lastErr = cause
+	}
+	s.metrics.Count(MetricSpoolSpooled, 1, metrics.T("topic", msg.Topic))
+	s.reportBacklog()
+	return SpoolResponse, nil
+}
+
+func (s *SpoolClient) drainLoop() {
+	defer s.stopped.Done()
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.stop:
+			return
+		case <-ticker.C:
+			if err := s.drain(); err != nil && s.logger != nil {
+				s.logger.Error(context.Background(), "failed to drain kafka spool", "error", err)
+			}
+		}
+	}
+}
+
+// roll starts a new segment for the entries to come. It must be called with mtx held.
+func (s *SpoolClient) roll() error {
+	seq := s.segments[len(s.segments)-1].seq + 1
+	f, err := os.OpenFile(s.segmentPath(seq), os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0o644)
+	if err != nil {
+		return errors.Wrap(err, "failed to create spool segment")
+	}
+	_ = s.log.Close()
+	s.log = f
+	s.segments = append(s.segments, spoolSegment{seq: seq})
+	return nil
+}
+
+// drain writes spooled entries in order, a batch at a time, until the spool is empty or a write fails.
+func (s *SpoolClient) drain() error {
+	ctx := context.Background()
+	writers := make(map[string]Writer)
+	for {
+		select {
+		case <-s.stop:
+			return nil
+		default:
+		}
+
+		s.mtx.Lock()
+		first, pos := s.segments[0], s.pos
+		s.mtx.Unlock()
+		if pos >= first.size {
+			return nil
+		}
+
+		entries, ends, err := s.readBatch(first, pos)
+		if err != nil {
+			return err
+		}
+		if len(entries) == 0 {
+			return errors.Errorf("kafka spool segment %d is corrupt at %d", first.seq, pos)
+		}
+
+		n, err := s.writeBatch(ctx, writers, entries)
+		if n > 0 {
+			if err := s.drained(ends[n-1], n); err != nil {
+				return err
+			}
+		}
+		if err != nil {
+			s.mtx.Lock()
+			s.lastErr = err
+			s.mtx.Unlock()
+			return err
+		}
+	}
+}
+
+// readBatch reads up to spoolDrainBatch entries of the segment from pos, with the position after each.
+func (s *SpoolClient) readBatch(seg spoolSegment, pos int64) ([]spoolEntry, []int64, error) {
+	f, err := os.Open(s.segmentPath(seg.seq))
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "failed to open spool segment")
+	}
+	defer f.Close()
+
+	var entries []spoolEntry
+	var ends []int64
+	errFull := errors.New("batch full")
+	err = readEntries(f, pos, seg.size, func(e spoolEntry, next int64) error {
+		entries, ends = append(entries, e), append(ends, next)
+		if len(entries) == spoolDrainBatch {
+			return errFull
+		}
+		return nil
+	})
+	if err != nil && err != errFull {
+		return nil, nil, err
+	}
+	return entries, ends, nil
+}
+
+// writeBatch writes the entries, each run of the same topic in one batch, and returns how many were
+// written before the first failure. Entries of a failed batch that did get written are written again
+// with the rest, consumers drop them by their ce_id.
+func (s *SpoolClient) writeBatch(ctx context.Context, writers map[string]Writer, entries []spoolEntry) (int, error) {
+	for i := 0; i < len(entries); {
+		topic := entries[i].Topic
+		var records []Record
+		for j := i; j < len(entries) && entries[j].Topic == topic; j++ {
+			records = append(records, Record{Key: entries[j].Key, Value: entries[j].Value, Headers: entries[j].Headers})
+		}
+
+		w, ok := writers[topic]
+		if !ok {
+			var err error
+			if w, err = s.c.Writer(ctx, Config{Topic: topic}); err != nil {
+				return i, err
+			}
+			writers[topic] = w
+		}
+		wctx, cancel := context.WithTimeout(ctx, s.writeTimeout)
+		_, err := w.WriteBatch(wctx, records)
+		cancel()
+		if err != nil {
+			return i, err
+		}
+		s.metrics.Count(MetricSpoolDrained, int64(len(records)), metrics.T("topic", topic))
+		i += len(records)
+	}
+	return len(entries), nil
+}
+
+// drained records that the n entries of the first segment up to pos were written. Segments drained to
+// their end are deleted, and the last one is emptied once everything was drained.
+func (s *SpoolClient) drained(pos int64, n int) error {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	s.backlog -= pos - s.pos
+	s.pos = pos
+	s.messages -= n
+
+	var done []int64
+	for len(s.segments) > 1 && s.pos == s.segments[0].size {
+		done = append(done, s.segments[0].seq)
+		s.segments, s.pos = s.segments[1:], 0
+	}
+	if s.messages == 0 {
+		if err := s.log.Truncate(0); err != nil {
+			return errors.Wrap(err, "failed to truncate spool")
+		}
+		if _, err := s.log.Seek(0, io.SeekStart); err != nil {
+			return errors.Wrap(err, "failed to truncate spool")
+		}
+		s.segments[0].size, s.pos, s.backlog, s.lastErr, s.rejected = 0, 0, 0, nil, false
+	}
+	s.reportBacklog()
+
+	// The position is saved before the segments are deleted, open deletes the ones a crash left behind it.
+	tmp := filepath.Join(s.dir, spoolPosFile+".tmp")
+	if err := os.WriteFile(tmp, []byte(fmt.Sprintf("%d %d", s.segments[0].seq, s.pos)), 0o644); err != nil {
+		return errors.Wrap(err, "failed to save spool position")
+	}
+	if err := os.Rename(tmp, filepath.Join(s.dir, spoolPosFile)); err != nil {
+		return errors.Wrap(err, "failed to save spool position")
+	}
+	for _, seq := range done {
+		if err := os.Remove(s.segmentPath(seq)); err != nil {
+			return errors.Wrap(err, "failed to delete drained spool segment")
+		}
+	}
+	return nil
+}
+
+// reportBacklog must be called with mtx held.
+func (s *SpoolClient) reportBacklog() {
+	s.metrics.Gauge(MetricSpoolMessages, float64(s.messages))
+	s.metrics.Gauge(MetricSpoolBytes, float64(s.backlog))
+}
+
+// readEntries calls fn for each whole entry of f between from and to, or the end of f if to is negative,
+// with the position of the entry after it. It stops at the first torn or corrupt entry.
+func readEntries(f *os.File, from, to int64, fn func(e spoolEntry, next int64) error) error {
+	var r io.Reader = io.NewSectionReader(f, from, 1<<62)
+	if to >= 0 {
+		r = io.NewSectionReader(f, from, to-from)
+	}
+	br := bufio.NewReader(r)
+
+	pos := from
+	header := make([]byte, spoolFrameHeader)
+	for {
+		if _, err := io.ReadFull(br, header); err != nil {
+			return nil
+		}
+		data := make([]byte, binary.BigEndian.Uint32(header))
+		if _, err := io.ReadFull(br, data); err != nil || crc32.ChecksumIEEE(data) != binary.BigEndian.Uint32(header[4:]) {
+			return nil
+		}
+		var e spoolEntry
+		if err := json.Unmarshal(data, &e); err != nil {
+			return nil
+		}
+		pos += int64(spoolFrameHeader + len(data))
+		if err := fn(e, pos); err != nil {
+			return err
+		}
+	}
+}
+
+type spoolWriter struct {
+	w     Writer
+	topic string
+	s     *SpoolClient
+}
+
+func (w *spoolWriter) Write(ctx context.Context, key string, value []byte, options ...WriteOption) (Response, error) {
+	msg, err := newMessage(w.topic, key, value, options...)
+	if err != nil {
+		return Response{}, err
+	}
+	if w.s.spooling() {
+		return w.s.spool(msg, nil)
+	}
+
+	wctx, cancel := context.WithTimeout(ctx, w.s.writeTimeout)
+	resp, err := w.w.Write(wctx, msg.Key, msg.value, WithHeaders(msg.Headers...))
+	cancel()
+	if err == nil || ctx.Err() != nil {
+		return resp, err
+	}
+	return w.s.spool(msg, err)
+}
+
+func (w *spoolWriter) WriteBatch(ctx context.Context, records []Record) ([]Response, error) {
+	responses := make([]Response, len(records))
+	errs := make([]error, len(records))
+
+	var wg sync.WaitGroup
+	wg.Add(len(records))
+	for i, r := range records {
+		i := i
+		w.WriteAsync(ctx, r, func(d Delivery) {
+			responses[i], errs[i] = d.Response, d.Err
+			wg.Done()
+		})
+	}
+	wg.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			return responses, err
+		}
+	}
+	return responses, nil
+}
+
+// WriteAsync spools the record if the producer fails it. That happens once it gave up retrying,
+// so records written while the brokers are unreachable only reach the spool after the producer's timeouts.
+func (w *spoolWriter) WriteAsync(ctx context.Context, record Record, onDelivery func(Delivery)) {
+	deliver := func(resp Response, err error) {
+		if onDelivery != nil {
+			onDelivery(Delivery{Record: record, Response: resp, Err: err})
+		}
+	}
+
+	msg, err := newMessage(w.topic, record.Key, record.Value, record.options()...)
+	if err != nil {
+		deliver(Response{}, err)
+		return
+	}
+	if w.s.spooling() {
+		deliver(w.s.spool(msg, nil))
+		return
+	}
+
+	w.w.WriteAsync(ctx, Record{Key: msg.Key, Value: msg.value, Headers: msg.Headers}, func(d Delivery) {
+		if d.Err != nil {
+			deliver(w.s.spool(msg, d.Err))
+			return
+		}
+		deliver(d.Response, nil)
+	})
+}
+
+func (w *spoolWriter) Flush(ctx context.Context) error { return w.w.Flush(ctx) }
@@ -0,0 +1,172 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// flakyClient fails every write while down is set, like a producer that can't reach the brokers,
+// and writes with failKey always.
+type flakyClient struct {
+	*MemoryClient
+	down    atomic.Bool
+	failKey string
+}
+
+func (c *flakyClient) Writer(ctx context.Context, topicConfig Config) (Writer, error) {
+	w, err := c.MemoryClient.Writer(ctx, topicConfig)
+	return &flakyWriter{Writer: w, c: c}, err
+}
+
+type flakyWriter struct {
+	Writer
+	c *flakyClient
+}
+
+func (w *flakyWriter) Write(ctx context.Context, key string, value []byte, options ...WriteOption) (Response, error) {
+	if w.c.down.Load() || key == w.c.failKey {
+		return Response{}, errors.New("broker unreachable")
+	}
+	return w.Writer.Write(ctx, key, value, options...)
+}
+
+func (w *flakyWriter) WriteBatch(ctx context.Context, records []Record) ([]Response, error) {
+	for _, r := range records {
+		if w.c.down.Load() || r.Key == w.c.failKey {
+			return make([]Response, len(records)), errors.New("broker unreachable")
+		}
+	}
+	return w.Writer.WriteBatch(ctx, records)
+}
+
+func Test_SpoolClient_SpoolsWhileDownAndDrainsInOrder(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	dir := t.TempDir()
+	fc := &flakyClient{MemoryClient: NewMemoryClient()}
+	fc.down.Store(true)
+
+	s, cleanup, err := NewSpoolClient(fc, dir, nil, WithSpoolDrainInterval(10*time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	w, _ := s.Writer(ctx, Config{Topic: "orders"})
+	for _, key := range []string{"a", "b"} {
+		resp, err := w.Write(ctx, key, []byte(key), WithHeader("tenant", "zillow"))
+		if err != nil || resp != SpoolResponse {
+			t.Fatalf("expected the write to be spooled, got %v, %v", resp, err)
+		}
+	}
+	if st := s.Status(); st.Messages != 2 || st.LastError != "broker unreachable" {
+		t.Errorf("unexpected status %+v", st)
+	}
+	cleanup()
+
+	// The backlog survives a restart.
+	s, cleanup, err = NewSpoolClient(fc, dir, nil, WithSpoolDrainInterval(10*time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cleanup()
+	if st := s.Status(); st.Messages != 2 {
+		t.Fatalf("expected 2 spooled messages after reopening, got %+v", st)
+	}
+	w, _ = s.Writer(ctx, Config{Topic: "orders"})
+	if resp, _ := w.Write(ctx, "c", []byte("c")); resp != SpoolResponse {
+		t.Error("expected writes to queue behind the backlog")
+	}
+
+	fc.down.Store(false)
+	if err := fc.WaitFor(ctx, "orders", 3); err != nil {
+		t.Fatal(err)
+	}
+	msgs := fc.Messages("orders")
+	for i, key := range []string{"a", "b", "c"} {
+		if msgs[i].Key != key {
+			t.Errorf("expected %s at offset %d, got %s", key, i, msgs[i].Key)
+		}
+	}
+	if msgs[0].Headers.Get("tenant") != "zillow" {
+		t.Errorf("expected the spooled headers to be kept, got %v", msgs[0].Headers)
+	}
+	for ctx.Err() == nil && s.Status().Messages != 0 {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if resp, err := w.Write(ctx, "d", []byte("d")); err != nil || resp == SpoolResponse {
+		t.Errorf("expected a direct write once drained, got %v, %v", resp, err)
+	}
+}
+
+func Test_SpoolClient_FullAndReadiness(t *testing.T) {
+	fc := &flakyClient{MemoryClient: NewMemoryClient()}
+	fc.down.Store(true)
+	s, cleanup, err := NewSpoolClient(fc, t.TempDir(), nil, WithSpoolMaxBytes(300))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cleanup()
+
+	ctx := context.Background()
+	w, _ := s.Writer(ctx, Config{Topic: "orders"})
+	var full error
+	for i := 0; i < 10 && full == nil; i++ {
+		_, full = w.Write(ctx, "a", []byte("payload"))
+	}
+	if !errors.Is(full, ErrSpoolFull) {
+		t.Fatalf("expected ErrSpoolFull, got %v", full)
+	}
+
+	rec := httptest.NewRecorder()
+	s.ReadinessCheck(func(w http.ResponseWriter, r *http.Request) {})(rec, httptest.NewRequest("GET", "/ready", nil))
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("expected unready while the spool is full, got %d", rec.Code)
+	}
+}
+
+func Test_SpoolClient_DeletesDrainedSegments(t *testing.T) {
+	fc := &flakyClient{MemoryClient: NewMemoryClient(), failKey: "stuck"}
+	fc.down.Store(true)
+	dir := t.TempDir()
+	s, cleanup, err := NewSpoolClient(fc, dir, nil, WithSpoolMaxBytes(4000), WithSpoolDrainInterval(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cleanup()
+
+	ctx := context.Background()
+	w, _ := s.Writer(ctx, Config{Topic: "orders"})
+	for _, key := range []string{"a", "b", "c", "d", "e", "f", "g", "h", "i"} {
+		if _, err := w.Write(ctx, key, []byte("payload")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// The last entry keeps failing, so the spool never drains completely.
+	stuck, _ := s.Writer(ctx, Config{Topic: "payments"})
+	if _, err := stuck.Write(ctx, "stuck", []byte("payload")); err != nil {
+		t.Fatal(err)
+	}
+	if segments, _ := filepath.Glob(filepath.Join(dir, "spool-*.log")); len(segments) < 3 {
+		t.Fatalf("expected the log to be split in segments, got %v", segments)
+	}
+	fc.down.Store(false)
+	if err := s.drain(); err == nil {
+		t.Fatal("expected the stuck entry to fail draining")
+	}
+
+	if st := s.Status(); st.Messages != 1 || st.Bytes >= st.MaxBytes/spoolSegments {
+		t.Errorf("expected only the stuck entry left, got %+v", st)
+	}
+	if segments, _ := filepath.Glob(filepath.Join(dir, "spool-*.log")); len(segments) != 1 {
+		t.Errorf("expected the drained segments to be deleted, got %v", segments)
+	}
+	if resp, err := w.Write(ctx, "j", []byte("payload")); err != nil || resp != SpoolResponse {
+		t.Errorf("expected room for new writes behind the stuck entry, got %v, %v", resp, err)
+	}
+}
@@ -0,0 +1,312 @@
+package kafka
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Change is an update Table subscribers are told about. Deleted is set for tombstones, New is then nil.
+type Change struct {
+	Key     string
+	Old     []byte
+	New     []byte
+	Deleted bool
+}
+
+// Table keeps the latest value of every key of a compacted topic in memory. Run reads the topic from
+// the beginning, or from the last snapshot, and keeps applying messages until its context is done.
+// Messages with an empty value are tombstones and delete the key.
+type Table struct {
+	client Client
+	admin  Admin
+	topic  string
+	logger Logger
+
+	snapshotPath  string
+	snapshotEvery time.Duration
+	catchUpIdle   time.Duration
+
+	mtx     sync.RWMutex
+	entries map[string][]byte
+	offsets map[int32]int64 // next offset to apply, by partition
+
+	subMtx  sync.Mutex
+	subs    map[int]func(Change)
+	nextSub int
+
+	ready     chan struct{}
+	readyOnce sync.Once
+}
+
+type tableSnapshot struct {
+	Topic   string            `json:"topic"`
+	Offsets map[int32]int64   `json:"offsets"`
+	Entries map[string][]byte `json:"entries"`
+}
+
+// NewTable creates a table of topic. admin is used to find out when the table has caught up.
+func NewTable(client Client, admin Admin, topic string, logger Logger, options ...TableOption) *Table {
+	t := &Table{
+		client:      client,
+		admin:       admin,
+		topic:       topic,
+		logger:      logger,
+		catchUpIdle: 5 * time.Second,
+		entries:     make(map[string][]byte),
+		offsets:     make(map[int32]int64),
+		subs:        make(map[int]func(Change)),
+		ready:       make(chan struct{}),
+	}
+	for _, option := range options {
+		if option != nil {
+			option.apply(t)
+		}
+	}
+	return t
+}
+
+// Get returns the latest value of key.
+func (t *Table) Get(key string) ([]byte, bool) {
+	t.mtx.RLock()
+	defer t.mtx.RUnlock()
+	v, ok := t.entries[key]
+	return v, ok
+}
+
+// Len returns how many keys the table holds.
+func (t *Table) Len() int {
+	t.mtx.RLock()
+	defer t.mtx.RUnlock()
+	return len(t.entries)
+}
+
+// Subscribe calls fn for every change applied from now on, in topic order, from the goroutine running Run.
+// fn should return quickly, the table doesn't move on until it does. Call the returned func to stop, fn may
+// call it too. A change being applied while it stops can still be passed to fn.
+func (t *Table) Subscribe(fn func(Change)) func() {
+	t.subMtx.Lock()
+	defer t.subMtx.Unlock()
+	id := t.nextSub
+	t.nextSub++
+	t.subs[id] = fn
+	return func() {
+		t.subMtx.Lock()
+		defer t.subMtx.Unlock()
+		delete(t.subs, id)
+	}
+}
+
+// Ready reports whether the table has caught up with the end of the topic as it was when Run started.
+func (t *Table) Ready() bool {
+	select {
+	case <-t.ready:
+		return true
+	default:
+		return false
+	}
+}
+
+// WaitReady blocks until the table is ready or ctx is done.
+func (t *Table) WaitReady(ctx context.Context) error {
+	select {
+	case <-t.ready:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// ReadinessCheck reports the service unready until the table has caught up. Use it with server.WithReadinessCheck.
+func (t *Table) ReadinessCheck(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !t.Ready() {
+			http.Error(w, "table "+t.topic+" is catching up", http.StatusServiceUnavailable)
+			return
+		}
+		next(w, r)
+	}
+}
+
+// Run fills the table and keeps it up to date until ctx is done.
+// The table is ready once every partition reached its end offset, or once no message arrived for
+// the catch up idle time while every partition is within a few offsets of its end, which covers topics
+// ending in transaction markers rather than messages.
+func (t *Table) Run(ctx context.Context) error {
+	if err := t.loadSnapshot(); err != nil {
+		return err
+	}
+
+	end, err := t.admin.EndOffsets(ctx, t.topic)
+	if err != nil {
+		return err
+	}
+
+	t.mtx.RLock()
+	start := make(map[int32]int64, len(t.offsets))
+	for p, o := range t.offsets {
+		start[p] = o
+	}
+	t.mtx.RUnlock()
+	r, err := t.client.Reader(ctx, Config{Topic: t.topic, NoGroup: true, StartOffsets: start})
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	defer t.saveSnapshot()
+
+	if t.caughtUp(end) {
+		t.markReady()
+	}
+
+	wait := t.catchUpIdle
+	if t.snapshotPath != "" && t.snapshotEvery < wait {
+		wait = t.snapshotEvery
+	}
+	lastMsg, lastSnapshot := time.Now(), time.Now()
+	for {
+		readCtx, cancel := context.WithTimeout(ctx, wait)
+		msg, err := r.Read(readCtx)
+		cancel()
+		if ctx.Err() != nil {
+			return nil
+		}
+
+		switch {
+		case errors.Is(err, context.DeadlineExceeded):
+			if time.Since(lastMsg) >= t.catchUpIdle && t.nearEnd(end) {
+				t.markReady()
+			}
+		case err != nil:
+			return err
+		default:
+			lastMsg = time.Now()
+			t.apply(msg)
+			if !t.Ready() && t.caughtUp(end) {
+				t.markReady()
+			}
+		}
+
+		if t.snapshotPath != "" && time.Since(lastSnapshot) >= t.snapshotEvery {
+			t.saveSnapshot()
+			lastSnapshot = time.Now()
+		}
+	}
+}
+
+func (t *Table) apply(msg *Message) {
+	change := Change{Key: msg.Key, New: msg.Value(), Deleted: len(msg.Value()) == 0}
+	if change.Deleted {
+		change.New = nil
+	}
+
+	t.mtx.Lock()
+	change.Old = t.entries[msg.Key]
+	if change.Deleted {
+		delete(t.entries, msg.Key)
+	} else {
+		t.entries[msg.Key] = change.New
+	}
+	t.offsets[msg.Partition] = msg.Offset + 1
+	t.mtx.Unlock()
+
+	// Subscribers are called without subMtx, so they can unsubscribe.
+	t.subMtx.Lock()
+	subs := make([]func(Change), 0, len(t.subs))
+	for _, fn := range t.subs {
+		subs = append(subs, fn)
+	}
+	t.subMtx.Unlock()
+	for _, fn := range subs {
+		fn(change)
+	}
+}
+
+func (t *Table) caughtUp(end map[int32]int64) bool {
+	t.mtx.RLock()
+	defer t.mtx.RUnlock()
+	for p, o := range end {
+		if t.offsets[p] < o {
+			return false
+		}
+	}
+	return true
+}
+
+// tableMarkerSlack is how many offsets at the end of a partition may be transaction markers, which
+// are never read, for the table to count as caught up once reading goes idle.
+const tableMarkerSlack = 10
+
+// nearEnd reports whether every partition is within tableMarkerSlack offsets of end.
+func (t *Table) nearEnd(end map[int32]int64) bool {
+	t.mtx.RLock()
+	defer t.mtx.RUnlock()
+	for p, o := range end {
+		if t.offsets[p] < o-tableMarkerSlack {
+			return false
+		}
+	}
+	return true
+}
+
+func (t *Table) markReady() {
+	t.readyOnce.Do(func() { close(t.ready) })
+}
+
+func (t *Table) loadSnapshot() error {
+	if t.snapshotPath == "" {
+		return nil
+	}
+	data, err := os.ReadFile(t.snapshotPath)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return errors.Wrapf(err, "failed to read table snapshot %s", t.snapshotPath)
+	}
+
+	var snap tableSnapshot
+	if err := json.Unmarshal(data, &snap); err != nil || snap.Topic != t.topic {
+		// A snapshot that can't be used only costs a full read of the topic.
+		if t.logger != nil {
+			t.logger.Error(context.Background(), "ignoring kafka table snapshot", "path", t.snapshotPath, "error", err)
+		}
+		return nil
+	}
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+	if snap.Entries != nil {
+		t.entries = snap.Entries
+	}
+	if snap.Offsets != nil {
+		t.offsets = snap.Offsets
+	}
+	return nil
+}
+
+func (t *Table) saveSnapshot() {
+	if t.snapshotPath == "" {
+		return
+	}
+	t.mtx.RLock()
+	data, err := json.Marshal(tableSnapshot{Topic: t.topic, Offsets: t.offsets, Entries: t.entries})
+	t.mtx.RUnlock()
+
+	if err == nil {
+		tmp := t.snapshotPath + ".tmp"
+		if err = os.MkdirAll(filepath.Dir(t.snapshotPath), 0o755); err == nil {
+			if err = os.WriteFile(tmp, data, 0o644); err == nil {
+				err = os.Rename(tmp, t.snapshotPath)
+			}
+		}
+	}
+	if err != nil && t.logger != nil {
+		t.logger.Error(context.Background(), "failed to save kafka table snapshot", "path", t.snapshotPath, "error", err)
+	}
+}
@@ -0,0 +1,192 @@
+package kafka
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/opentracing/opentracing-go"
+)
+
+func Test_Table_CatchesUpAndAppliesTombstones(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	c := NewMemoryClient(WithPartitions(2))
+	w, _ := c.Writer(ctx, Config{Topic: "regions"})
+	_, _ = w.Write(ctx, "wa", []byte("Washington"))
+	_, _ = w.Write(ctx, "or", []byte("Oregon"))
+	_, _ = w.Write(ctx, "ca", []byte("Cali"))
+	_, _ = w.Write(ctx, "ca", []byte("California"))
+
+	snapshot := filepath.Join(t.TempDir(), "regions.json")
+	table := NewTable(c, c, "regions", nil, WithTableSnapshot(snapshot, time.Hour))
+	runCtx, stop := context.WithCancel(ctx)
+	done := make(chan error)
+	go func() { done <- table.Run(runCtx) }()
+
+	if err := table.WaitReady(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if v, _ := table.Get("ca"); string(v) != "California" || table.Len() != 3 {
+		t.Errorf("unexpected table after catching up, ca=%q len=%d", v, table.Len())
+	}
+
+	changes := make(chan Change, 1)
+	var unsubscribe func()
+	// Subscribers can unsubscribe from their callback.
+	unsubscribe = table.Subscribe(func(ch Change) {
+		changes <- ch
+		unsubscribe()
+	})
+	_, _ = w.Write(ctx, "or", nil)
+	ch := <-changes
+	if ch.Key != "or" || !ch.Deleted || string(ch.Old) != "Oregon" {
+		t.Errorf("unexpected change %+v", ch)
+	}
+	if _, ok := table.Get("or"); ok {
+		t.Error("expected the tombstone to delete the key")
+	}
+
+	stop()
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+
+	// A new table starts from the snapshot and only reads what was written since.
+	_, _ = w.Write(ctx, "nv", []byte("Nevada"))
+	restored := NewTable(c, c, "regions", nil, WithTableSnapshot(snapshot, time.Hour))
+	var applied []string
+	restored.Subscribe(func(ch Change) { applied = append(applied, ch.Key) })
+	restoredCtx, stopRestored := context.WithCancel(ctx)
+	go func() { done <- restored.Run(restoredCtx) }()
+	if err := restored.WaitReady(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if restored.Len() != 3 || len(applied) != 1 || applied[0] != "nv" {
+		t.Errorf("expected only nv to be applied on top of the snapshot, got %v and %d keys", applied, restored.Len())
+	}
+	// Run saves a snapshot when it stops, it must be done before the temp dir is removed.
+	stopRestored()
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+}
+
+// laggingAdmin reports end offsets further than the messages the table can read.
+type laggingAdmin struct {
+	*MemoryClient
+	end int64
+}
+
+func (a laggingAdmin) EndOffsets(ctx context.Context, topic string) (map[int32]int64, error) {
+	return map[int32]int64{0: a.end}, nil
+}
+
+func Test_Table_OnlyIdlesIntoReadyNearTheEnd(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	c := NewMemoryClient()
+	w, _ := c.Writer(ctx, Config{Topic: "regions"})
+	for _, key := range []string{"wa", "or", "ca"} {
+		_, _ = w.Write(ctx, key, []byte(key))
+	}
+
+	// Offsets 3 and 4 are transaction markers the reader never gets.
+	markers := NewTable(c, laggingAdmin{c, 5}, "regions", nil, WithCatchUpIdle(20*time.Millisecond))
+	go func() { _ = markers.Run(ctx) }()
+	if err := markers.WaitReady(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	// A reader that stopped getting messages far from the end isn't caught up.
+	behind := NewTable(c, laggingAdmin{c, 100}, "regions", nil, WithCatchUpIdle(20*time.Millisecond))
+	go func() { _ = behind.Run(ctx) }()
+	time.Sleep(200 * time.Millisecond)
+	if behind.Ready() {
+		t.Error("expected the table not to be ready 97 offsets from the end")
+	}
+}
+
+func Test_Table_DoesNotJoinTheClientsDefaultGroup(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	cfg := newFakeCluster(t, "regions")
+	cfg.GroupID = "regions-worker"
+	c, cleanup := NewClient(cfg, opentracing.NoopTracer{}, nil)
+	defer cleanup()
+	adm, closeAdmin, err := NewAdmin(cfg, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer closeAdmin()
+
+	w, _ := c.Writer(ctx, Config{Topic: "regions"})
+	for _, key := range []string{"wa", "or", "ca"} {
+		if _, err := w.Write(ctx, key, []byte(key)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// The service's group has consumed everything, a table in that group would start at the end.
+	r, err := c.Reader(ctx, Config{Topic: "regions", CommitMode: CommitManual})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 3; i++ {
+		msg, err := r.Read(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		msg.Done()
+	}
+	if err := r.Commit(ctx); err != nil {
+		t.Fatal(err)
+	}
+	_ = r.Close()
+
+	table := NewTable(c, adm, "regions", nil, WithCatchUpIdle(100*time.Millisecond))
+	runCtx, stop := context.WithCancel(ctx)
+	done := make(chan error)
+	go func() { done <- table.Run(runCtx) }()
+	if err := table.WaitReady(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if table.Len() != 3 {
+		t.Errorf("expected the table to read the whole topic, got %d keys", table.Len())
+	}
+	stop()
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+}
+
+func Test_Reader_StartOffsets(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	cfg := newFakeCluster(t, "regions")
+	c, cleanup := NewClient(cfg, opentracing.NoopTracer{}, nil)
+	defer cleanup()
+	w, _ := c.Writer(ctx, Config{Topic: "regions", CustomPartitioner: fixedPartitioner(0)})
+	for _, key := range []string{"a", "b", "c"} {
+		if _, err := w.Write(ctx, key, []byte(key)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	r, err := c.Reader(ctx, Config{Topic: "regions", StartOffsets: map[int32]int64{0: 2}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	msg, err := r.Read(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg.Key != "c" || msg.Offset != 2 {
+		t.Errorf("expected to start at offset 2, got %s at %d", msg.Key, msg.Offset)
+	}
+}
@@ -0,0 +1,155 @@
+package kafka
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"strconv"
+	"strings"
+
+	"github.com/opentracing/opentracing-go"
+	"github.com/pkg/errors"
+)
+
+// W3C trace context headers, see https://www.w3.org/TR/trace-context/.
+// Writers set them next to the opentracing headers so consumers written in other languages can continue the trace.
+const (
+	TraceparentHeader = "traceparent"
+	TracestateHeader  = "tracestate"
+)
+
+const sampledFlag byte = 0x01
+
+// TraceContext is a W3C trace context.
+type TraceContext struct {
+	TraceID [16]byte
+	SpanID  [8]byte
+	Flags   byte
+	State   string
+}
+
+// ParseTraceparent parses a traceparent header value.
+func ParseTraceparent(s string) (TraceContext, error) {
+	var tc TraceContext
+
+	parts := strings.Split(strings.TrimSpace(s), "-")
+	if len(parts) < 4 || len(parts[0]) != 2 || parts[0] == "ff" {
+		return tc, errors.Errorf("invalid traceparent %q", s)
+	}
+	// Version 00 has exactly four fields, later versions may append more.
+	if parts[0] == "00" && len(parts) != 4 {
+		return tc, errors.Errorf("invalid traceparent %q", s)
+	}
+
+	if err := decodeHex(tc.TraceID[:], parts[1]); err != nil {
+		return tc, errors.Wrapf(err, "invalid trace id in traceparent %q", s)
+	}
+	if err := decodeHex(tc.SpanID[:], parts[2]); err != nil {
+		return tc, errors.Wrapf(err, "invalid parent id in traceparent %q", s)
+	}
+	var flags [1]byte
+	if err := decodeHex(flags[:], parts[3]); err != nil {
+		return tc, errors.Wrapf(err, "invalid flags in traceparent %q", s)
+	}
+	tc.Flags = flags[0]
+
+	if tc.TraceID == ([16]byte{}) || tc.SpanID == ([8]byte{}) {
+		return tc, errors.Errorf("traceparent %q has an all zero id", s)
+	}
+	return tc, nil
+}
+
+// Traceparent formats the traceparent header value.
+func (tc TraceContext) Traceparent() string {
+	return "00-" + hex.EncodeToString(tc.TraceID[:]) + "-" + hex.EncodeToString(tc.SpanID[:]) + "-" + hex.EncodeToString([]byte{tc.Flags})
+}
+
+// Sampled reports whether the upstream caller recorded the trace.
+func (tc TraceContext) Sampled() bool { return tc.Flags&sampledFlag != 0 }
+
+// CompatHeaders returns the same trace in the formats other tracers extract: datadog, B3 and jaeger.
+// The trace id is truncated to its lower 64 bits where the format can't carry 128.
+func (tc TraceContext) CompatHeaders() map[string]string {
+	sampled := "0"
+	if tc.Sampled() {
+		sampled = "1"
+	}
+	traceID := hex.EncodeToString(tc.TraceID[:])
+	spanID := hex.EncodeToString(tc.SpanID[:])
+
+	return map[string]string{
+		"x-datadog-trace-id":          strconv.FormatUint(binary.BigEndian.Uint64(tc.TraceID[8:]), 10),
+		"x-datadog-parent-id":         strconv.FormatUint(binary.BigEndian.Uint64(tc.SpanID[:]), 10),
+		"x-datadog-sampling-priority": sampled,
+		"x-b3-traceid":                traceID,
+		"x-b3-spanid":                 spanID,
+		"x-b3-sampled":                sampled,
+		"uber-trace-id":               traceID + ":" + spanID + ":0:" + hex.EncodeToString([]byte{tc.Flags}),
+	}
+}
+
+// TraceContext returns the W3C trace context the message was written with, if any.
+func (m *Message) TraceContext() (TraceContext, bool) {
+	tp, ok := m.Headers.Lookup(TraceparentHeader)
+	if !ok {
+		return TraceContext{}, false
+	}
+	tc, err := ParseTraceparent(string(tp))
+	if err != nil {
+		return TraceContext{}, false
+	}
+	tc.State = m.Headers.Get(TracestateHeader)
+	return tc, true
+}
+
+type traceContextKey struct{}
+
+// ContextWithTraceContext returns a copy of ctx carrying tc. Writes made with the returned context continue tc's trace.
+func ContextWithTraceContext(ctx context.Context, tc TraceContext) context.Context {
+	return context.WithValue(ctx, traceContextKey{}, tc)
+}
+
+// TraceContextFromContext returns the trace context stored in ctx, if any.
+func TraceContextFromContext(ctx context.Context) (TraceContext, bool) {
+	tc, ok := ctx.Value(traceContextKey{}).(TraceContext)
+	return tc, ok
+}
+
+// spanIDs is implemented by span contexts that expose 64 bit ids, the datadog tracer's among them.
+type spanIDs interface {
+	TraceID() uint64
+	SpanID() uint64
+}
+
+// newTraceContext builds the trace context of the producer span.
+// An upstream W3C trace is continued, otherwise the tracer's own ids are used when it exposes them.
+func newTraceContext(ctx context.Context, span opentracing.Span) TraceContext {
+	tc := TraceContext{Flags: sampledFlag}
+	parent, hasParent := TraceContextFromContext(ctx)
+	ids, hasIDs := span.Context().(spanIDs)
+
+	switch {
+	case hasParent:
+		tc.TraceID, tc.Flags, tc.State = parent.TraceID, parent.Flags, parent.State
+	case hasIDs && ids.TraceID() != 0:
+		binary.BigEndian.PutUint64(tc.TraceID[8:], ids.TraceID())
+	default:
+		_, _ = rand.Read(tc.TraceID[:])
+	}
+
+	if hasIDs && ids.SpanID() != 0 {
+		binary.BigEndian.PutUint64(tc.SpanID[:], ids.SpanID())
+	} else {
+		_, _ = rand.Read(tc.SpanID[:])
+	}
+	return tc
+}
+
+func decodeHex(dst []byte, s string) error {
+	if len(s) != hex.EncodedLen(len(dst)) || strings.ToLower(s) != s {
+		return errors.Errorf("expected %d lowercase hex characters", hex.EncodedLen(len(dst)))
+	}
+	_, err := hex.Decode(dst, []byte(s))
+	return err
+}
@@ -0,0 +1,73 @@
+package kafka
+
+import (
+	"context"
+	"testing"
+)
+
+func Test_ParseTraceparent(t *testing.T) {
+	const tp = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+	tc, err := ParseTraceparent(tp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !tc.Sampled() {
+		t.Error("expected sampled flag")
+	}
+	if got := tc.Traceparent(); got != tp {
+		t.Errorf("round trip gave %q", got)
+	}
+
+	for _, invalid := range []string{
+		"",
+		"ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+		"00-00000000000000000000000000000000-00f067aa0ba902b7-01",
+		"00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra",
+	} {
+		if _, err := ParseTraceparent(invalid); err == nil {
+			t.Errorf("expected %q to be rejected", invalid)
+		}
+	}
+}
+
+func Test_Writer_ContinuesUpstreamTraceContext(t *testing.T) {
+	upstream, _ := ParseTraceparent("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	upstream.State = "vendor=abc"
+	ctx := ContextWithTraceContext(context.Background(), upstream)
+
+	c := NewMemoryClient()
+	w, _ := c.Writer(ctx, Config{Topic: "listings"})
+	_, _ = w.Write(ctx, "1", []byte("v"), WithHeaders(
+		Header{Key: "hop", Value: []byte("a")},
+		Header{Key: "hop", Value: []byte("b")},
+	))
+
+	msg := c.Messages("listings")[0]
+	tc, ok := msg.TraceContext()
+	if !ok {
+		t.Fatal("expected a traceparent header")
+	}
+	if tc.TraceID != upstream.TraceID {
+		t.Error("expected the upstream trace id to carry over")
+	}
+	if tc.SpanID == upstream.SpanID {
+		t.Error("expected a new span id for the producer")
+	}
+	if tc.State != "vendor=abc" {
+		t.Errorf("expected tracestate to carry over, got %q", tc.State)
+	}
+
+	var hops []string
+	for _, h := range msg.Headers {
+		if h.Key == "hop" {
+			hops = append(hops, string(h.Value))
+		}
+	}
+	if len(hops) != 2 || hops[0] != "a" || hops[1] != "b" {
+		t.Errorf("expected repeated headers in order, got %v", hops)
+	}
+	if msg.Headers.Get("hop") != "b" {
+		t.Errorf("expected the last value to win, got %q", msg.Headers.Get("hop"))
+	}
+}
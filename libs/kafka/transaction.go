@@ -0,0 +1,283 @@
+package kafka
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+
+	"github.com/opentracing/opentracing-go"
+	"github.com/pkg/errors"
+	"github.com/twmb/franz-go/pkg/kgo"
+	"github.com/zillow/howwegoatzillow/libs/metrics"
+)
+
+// Isolation levels accepted in Config.Isolation.
+const (
+	// IsolationReadUncommitted reads every message, including those of open and aborted transactions. This is the default.
+	IsolationReadUncommitted = "read_uncommitted"
+	// IsolationReadCommitted only reads messages of committed transactions, and messages written outside of one.
+	IsolationReadCommitted = "read_committed"
+)
+
+var _ TransactionalClient = (*client)(nil)
+
+// Transactor reads with IsolationReadCommitted, so chained transactional pipelines stay exactly once.
+// Config.MaxInFlight must be 0, transactions need idempotent writes.
+func (c *client) Transactor(ctx context.Context, topicConfig Config, transactionalID string) (Transactor, error) {
+	cfg := topicConfig.withDefaults(c.config)
+	if cfg.GroupID == "" {
+		return nil, errors.New("transactor needs a GroupID to commit offsets for")
+	}
+	if cfg.MaxInFlight > 0 {
+		return nil, errors.New("transactor needs idempotent writes, MaxInFlight must be 0")
+	}
+
+	opts, err := c.clientOpts(cfg)
+	if err != nil {
+		return nil, err
+	}
+	start := Earliest
+	if cfg.StartFrom != nil {
+		start = *cfg.StartFrom
+	}
+	opts = append(opts,
+		kgo.ConsumeTopics(cfg.Topic),
+		kgo.ConsumerGroup(cfg.GroupID),
+		kgo.ConsumeResetOffset(start.kgoOffset()),
+		kgo.TransactionalID(transactionalID),
+		kgo.FetchIsolationLevel(kgo.ReadCommitted()),
+		// Don't read offsets another transaction is about to commit, they could be read again.
+		kgo.RequireStableFetchOffsets(),
+		kgo.RecordPartitioner(kgoPartitioner(cfg)),
+	)
+	sess, err := kgo.NewGroupTransactSession(opts...)
+	if err != nil {
+		return nil, err
+	}
+	return &transactor{sess: sess, config: cfg, tracer: c.tracer, logger: c.logger}, nil
+}
+
+type transactor struct {
+	sess   *kgo.GroupTransactSession
+	config Config
+	tracer opentracing.Tracer
+	logger Logger
+	inTx   bool
+	undone *undone
+}
+
+// undone counts the messages polled in a transaction that aren't done yet.
+// Each transaction gets its own, so messages of an aborted one can't count in the next.
+type undone struct{ n int64 }
+
+// track makes msg count until it is marked done.
+func (u *undone) track(msg *Message) {
+	atomic.AddInt64(&u.n, 1)
+	var once sync.Once
+	msg.done = func() { once.Do(func() { atomic.AddInt64(&u.n, -1) }) }
+}
+
+func (u *undone) any() bool { return u != nil && atomic.LoadInt64(&u.n) > 0 }
+
+func (t *transactor) Poll(ctx context.Context) ([]*Message, error) {
+	for {
+		fetches := t.sess.PollFetches(ctx)
+		if fetches.IsClientClosed() {
+			return nil, ErrReaderClosed
+		}
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		records, err := fetched(metrics.OrNoop(t.config.Metrics), t.logger, fetches)
+		if err != nil {
+			return nil, err
+		}
+		reportLag(metrics.OrNoop(t.config.Metrics), t.config, fetches)
+
+		if len(records) == 0 {
+			continue
+		}
+		if !t.inTx {
+			if err := t.sess.Begin(); err != nil {
+				return nil, errors.Wrap(err, "failed to begin transaction")
+			}
+			t.inTx = true
+			t.undone = &undone{}
+		}
+		msgs := make([]*Message, len(records))
+		for i, rec := range records {
+			msgs[i] = fromRecord(rec, nil)
+			t.undone.track(msgs[i])
+		}
+		return msgs, nil
+	}
+}
+
+func (t *transactor) Writer(topic string) Writer {
+	return &writer{cl: t.sess.Client(), topic: topic, tracer: t.tracer}
+}
+
+func (t *transactor) Commit(ctx context.Context) (bool, error) {
+	if t.undone.any() {
+		return false, t.Abort(ctx)
+	}
+	return t.end(ctx, kgo.TryCommit)
+}
+
+func (t *transactor) Abort(ctx context.Context) error {
+	_, err := t.end(ctx, kgo.TryAbort)
+	return err
+}
+
+func (t *transactor) end(ctx context.Context, try kgo.TransactionEndTry) (bool, error) {
+	if !t.inTx {
+		return false, nil
+	}
+	t.inTx = false
+	t.undone = nil
+	committed, err := t.sess.End(ctx, try)
+	return committed, errors.Wrap(err, "failed to end transaction")
+}
+
+// Close aborts the running transaction and leaves the group.
+func (t *transactor) Close() error {
+	ctx, cancel := context.WithTimeout(context.Background(), closeCommitTimeout)
+	defer cancel()
+	err := t.Abort(ctx)
+	t.sess.Close()
+	return err
+}
+
+var _ TransactionalClient = (*MemoryClient)(nil)
+
+// Transactor returns a transactor whose writes are only appended to their topics when it commits.
+func (c *MemoryClient) Transactor(ctx context.Context, topicConfig Config, transactionalID string) (Transactor, error) {
+	if topicConfig.GroupID == "" {
+		return nil, errors.New("transactor needs a GroupID to commit offsets for")
+	}
+	r, err := c.Reader(ctx, topicConfig)
+	if err != nil {
+		return nil, err
+	}
+	return &memTransactor{c: c, r: r.(*memReader)}, nil
+}
+
+type memTransactor struct {
+	c *MemoryClient
+	r *memReader
+
+	mtx     sync.Mutex
+	pending []memPending
+	undone  *undone
+}
+
+type memPending struct {
+	msg         *Message
+	partitioner Partitioner
+}
+
+func (t *memTransactor) Poll(ctx context.Context) ([]*Message, error) {
+	msg, err := t.r.Read(ctx)
+	if err != nil {
+		return nil, err
+	}
+	msgs := []*Message{msg}
+	if t.undone == nil {
+		t.undone = &undone{}
+	}
+
+	t.c.mtx.Lock()
+	defer t.c.mtx.Unlock()
+	for next := t.r.next(); next != nil; next = t.r.next() {
+		msgs = append(msgs, next)
+	}
+	for _, m := range msgs {
+		t.undone.track(m)
+	}
+	return msgs, nil
+}
+
+func (t *memTransactor) Writer(topic string) Writer {
+	return &memTxWriter{t: t, topic: topic, partitioner: newPartitioner(Config{})}
+}
+
+func (t *memTransactor) Commit(ctx context.Context) (bool, error) {
+	if t.undone.any() {
+		return false, t.Abort(ctx)
+	}
+
+	t.undone = nil
+	t.mtx.Lock()
+	pending := t.pending
+	t.pending = nil
+	t.mtx.Unlock()
+
+	for _, p := range pending {
+		t.c.append(p.msg, p.partitioner)
+	}
+
+	t.c.mtx.Lock()
+	defer t.c.mtx.Unlock()
+	copy(t.r.group.committed, t.r.group.next)
+	t.c.notify()
+	return true, nil
+}
+
+func (t *memTransactor) Abort(ctx context.Context) error {
+	t.undone = nil
+	t.mtx.Lock()
+	t.pending = nil
+	t.mtx.Unlock()
+
+	t.c.mtx.Lock()
+	defer t.c.mtx.Unlock()
+	copy(t.r.group.next, t.r.group.committed)
+	t.c.notify()
+	return nil
+}
+
+func (t *memTransactor) Close() error {
+	err := t.Abort(context.Background())
+	t.c.mtx.Lock()
+	defer t.c.mtx.Unlock()
+	t.r.closed = true
+	t.c.notify()
+	return err
+}
+
+type memTxWriter struct {
+	t           *memTransactor
+	topic       string
+	partitioner Partitioner
+}
+
+func (w *memTxWriter) Write(ctx context.Context, key string, value []byte, options ...WriteOption) (Response, error) {
+	msg, err := newMessage(w.topic, key, value, options...)
+	if err != nil {
+		return Response{}, err
+	}
+	w.t.mtx.Lock()
+	defer w.t.mtx.Unlock()
+	w.t.pending = append(w.t.pending, memPending{msg: msg, partitioner: w.partitioner})
+	return Response{Partition: -1, Offset: -1}, nil
+}
+
+func (w *memTxWriter) WriteBatch(ctx context.Context, records []Record) ([]Response, error) {
+	responses := make([]Response, len(records))
+	for i, r := range records {
+		var err error
+		if responses[i], err = w.Write(ctx, r.Key, r.Value, r.options()...); err != nil {
+			return responses, err
+		}
+	}
+	return responses, nil
+}
+
+func (w *memTxWriter) WriteAsync(ctx context.Context, record Record, onDelivery func(Delivery)) {
+	resp, err := w.Write(ctx, record.Key, record.Value, record.options()...)
+	if onDelivery != nil {
+		onDelivery(Delivery{Record: record, Response: resp, Err: err})
+	}
+}
+
+func (w *memTxWriter) Flush(ctx context.Context) error { return nil }
@@ -0,0 +1,60 @@
+package kafka
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func Test_MemoryClient_TransactorCommitsOnlyWhenDone(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	c := NewMemoryClient()
+	w, _ := c.Writer(ctx, Config{Topic: "payments"})
+	_, _ = w.Write(ctx, "a", []byte("1"))
+	_, _ = w.Write(ctx, "b", []byte("2"))
+
+	tx, err := c.Transactor(ctx, Config{Topic: "payments", GroupID: "billing"}, "billing-0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tx.Close()
+
+	msgs, err := tx.Poll(ctx)
+	if err != nil || len(msgs) != 2 {
+		t.Fatalf("expected both messages, got %d %v", len(msgs), err)
+	}
+	out := tx.Writer("invoices")
+	for _, msg := range msgs {
+		_, _ = out.Write(ctx, msg.Key, msg.Value())
+	}
+	msgs[0].Done()
+
+	// b isn't done, so nothing is written or committed and both messages come again.
+	if committed, err := tx.Commit(ctx); committed || err != nil {
+		t.Fatalf("expected the transaction to abort, got %v %v", committed, err)
+	}
+	if n := len(c.Messages("invoices")); n != 0 {
+		t.Errorf("expected no output from the aborted transaction, got %d", n)
+	}
+	msgs[1].Done() // too late, the transaction is gone
+
+	msgs, err = tx.Poll(ctx)
+	if err != nil || len(msgs) != 2 {
+		t.Fatalf("expected both messages again, got %d %v", len(msgs), err)
+	}
+	for _, msg := range msgs {
+		_, _ = out.Write(ctx, msg.Key, msg.Value())
+		msg.Done()
+	}
+	if committed, err := tx.Commit(ctx); !committed || err != nil {
+		t.Fatalf("expected the transaction to commit, got %v %v", committed, err)
+	}
+	if n := len(c.Messages("invoices")); n != 2 {
+		t.Errorf("expected 2 invoices, got %d", n)
+	}
+	if got := c.Committed("billing", "payments")[0]; got != 2 {
+		t.Errorf("expected offsets committed up to 2, got %d", got)
+	}
+}
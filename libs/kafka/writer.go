@@ -0,0 +1,173 @@
+package kafka
+
+import (
+	"context"
+	"sync"
+
+	"github.com/google/uuid"
+	"github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/ext"
+	"github.com/twmb/franz-go/pkg/kgo"
+)
+
+type writer struct {
+	cl     *kgo.Client
+	topic  string
+	tracer opentracing.Tracer
+}
+
+func (w *writer) Write(ctx context.Context, key string, value []byte, options ...WriteOption) (Response, error) {
+	msg, err := newMessage(w.topic, key, value, options...)
+	if err != nil {
+		return Response{}, err
+	}
+
+	span, ctx := startWriteSpan(ctx, w.tracer, msg)
+	defer span.Finish()
+
+	rec, err := w.cl.ProduceSync(ctx, toRecord(msg)).First()
+	if err != nil {
+		setSpanError(span, err)
+		return Response{}, err
+	}
+
+	resp := Response{Partition: rec.Partition, Offset: rec.Offset}
+	setSpanResponse(span, resp)
+	return resp, nil
+}
+
+func (w *writer) WriteBatch(ctx context.Context, records []Record) ([]Response, error) {
+	responses := make([]Response, len(records))
+	errs := make([]error, len(records))
+
+	var wg sync.WaitGroup
+	wg.Add(len(records))
+	for i, r := range records {
+		i := i
+		w.produce(ctx, r, func(resp Response, err error) {
+			responses[i], errs[i] = resp, err
+			wg.Done()
+		})
+	}
+	wg.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			return responses, err
+		}
+	}
+	return responses, nil
+}
+
+func (w *writer) WriteAsync(ctx context.Context, record Record, onDelivery func(Delivery)) {
+	// The record outlives the caller, e.g. an http request, so only its values should carry over.
+	w.produce(context.WithoutCancel(ctx), record, func(resp Response, err error) {
+		if onDelivery != nil {
+			onDelivery(Delivery{Record: record, Response: resp, Err: err})
+		}
+	})
+}
+
+func (w *writer) Flush(ctx context.Context) error {
+	return w.cl.Flush(ctx)
+}
+
+// produce hands the record to the producer. Each record gets its own span, finished once it is delivered.
+func (w *writer) produce(ctx context.Context, r Record, done func(Response, error)) {
+	msg, err := newMessage(w.topic, r.Key, r.Value, r.options()...)
+	if err != nil {
+		done(Response{}, err)
+		return
+	}
+	span, ctx := startWriteSpan(ctx, w.tracer, msg)
+
+	w.cl.Produce(ctx, toRecord(msg), func(rec *kgo.Record, err error) {
+		defer span.Finish()
+		if err != nil {
+			setSpanError(span, err)
+			done(Response{}, err)
+			return
+		}
+		resp := Response{Partition: rec.Partition, Offset: rec.Offset}
+		setSpanResponse(span, resp)
+		done(resp, nil)
+	})
+}
+
+// newMessage builds an outgoing message stamped with the CloudEvents attributes every writer adds.
+func newMessage(topic, key string, value []byte, options ...WriteOption) (*Message, error) {
+	msg := &Message{
+		Key:   key,
+		Topic: topic,
+		value: value,
+	}
+
+	for _, option := range options {
+		if option != nil {
+			option.apply(msg)
+		}
+	}
+	stampEvent(msg)
+	if msg.structured {
+		if err := toStructured(msg); err != nil {
+			return nil, err
+		}
+	}
+	return msg, nil
+}
+
+func newID() string { return uuid.New().String() }
+
+// startWriteSpan starts the producer span and injects it into the message headers,
+// both in the tracer's own format and as W3C trace context unless the caller set a traceparent already.
+func startWriteSpan(ctx context.Context, tracer opentracing.Tracer, msg *Message) (opentracing.Span, context.Context) {
+	span, spanCtx := opentracing.StartSpanFromContextWithTracer(ctx, tracer, "kafka_write", ext.SpanKindProducer)
+	ext.MessageBusDestination.Set(span, msg.Topic)
+	_ = tracer.Inject(span.Context(), opentracing.TextMap, &writeAttributeCarrier{msg})
+
+	if _, ok := msg.Headers.Lookup(TraceparentHeader); !ok {
+		tc := newTraceContext(ctx, span)
+		msg.Headers.Set(TraceparentHeader, tc.Traceparent())
+		if tc.State != "" {
+			msg.Headers.Set(TracestateHeader, tc.State)
+		}
+	}
+	return span, spanCtx
+}
+
+func setSpanResponse(span opentracing.Span, resp Response) {
+	span.SetTag("partition", resp.Partition)
+	span.SetTag("offset", resp.Offset)
+}
+
+func setSpanError(span opentracing.Span, err error) {
+	ext.Error.Set(span, true)
+	span.SetTag("error.message", err.Error())
+}
+
+type writeAttributeCarrier struct{ msg *Message }
+
+// Set conforms to the TextMapWriter interface.
+func (c *writeAttributeCarrier) Set(key, val string) {
+	c.msg.Headers.Set(key, val)
+}
+
+func (r Record) options() []WriteOption {
+	return []WriteOption{WithHeaders(r.Headers...)}
+}
+
+func toRecord(msg *Message) *kgo.Record {
+	rec := &kgo.Record{
+		Topic:   msg.Topic,
+		Value:   msg.value,
+		Headers: make([]kgo.RecordHeader, 0, len(msg.Headers)),
+	}
+	// An empty key is no key at all, so partitioners don't hash every keyless record to the same place.
+	if msg.Key != "" {
+		rec.Key = []byte(msg.Key)
+	}
+	for _, h := range msg.Headers {
+		rec.Headers = append(rec.Headers, kgo.RecordHeader{Key: h.Key, Value: h.Value})
+	}
+	return rec
+}
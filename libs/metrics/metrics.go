@@ -0,0 +1,45 @@
+// Package metrics is the metrics interface the libs report through, with DogStatsD and Prometheus backends.
+package metrics
+
+import (
+	"time"
+)
+
+// Metrics records measurements. Names are dot separated, e.g. kafka.produce.latency,
+// and backends translate them to their own conventions.
+type Metrics interface {
+	// Count adds value to a counter.
+	Count(name string, value int64, tags ...Tag)
+	// Gauge sets the current value of something, e.g. consumer lag.
+	Gauge(name string, value float64, tags ...Tag)
+	// Timing records a duration into a distribution.
+	Timing(name string, value time.Duration, tags ...Tag)
+}
+
+// Tag is a dimension a measurement is broken down by, e.g. topic.
+type Tag struct {
+	Key   string
+	Value string
+}
+
+// T creates a Tag.
+func T(key, value string) Tag { return Tag{Key: key, Value: value} }
+
+var _ Metrics = Noop{}
+
+// Noop drops every measurement. It is the default wherever metrics are optional.
+type Noop struct{}
+
+func (Noop) Count(name string, value int64, tags ...Tag) {}
+
+func (Noop) Gauge(name string, value float64, tags ...Tag) {}
+
+func (Noop) Timing(name string, value time.Duration, tags ...Tag) {}
+
+// OrNoop returns m, or Noop if m is nil.
+func OrNoop(m Metrics) Metrics {
+	if m == nil {
+		return Noop{}
+	}
+	return m
+}
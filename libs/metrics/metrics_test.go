@@ -0,0 +1,75 @@
+package metrics
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func Test_Prometheus_NamesAndLabels(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	p := NewPrometheus(reg, "app")
+
+	p.Count("kafka.produce.messages", 2, T("topic", "orders"), T("status", "ok"))
+	p.Count("kafka.produce.messages", 1, T("topic", "orders"))
+	p.Gauge("kafka.consumer.lag", 7, T("topic", "orders"), T("partition", "0"))
+	p.Timing("kafka.commit.latency", 20*time.Millisecond, T("topic", "orders"))
+
+	expected := `
+# HELP app_kafka_produce_messages_total kafka.produce.messages
+# TYPE app_kafka_produce_messages_total counter
+app_kafka_produce_messages_total{status="",topic="orders"} 1
+app_kafka_produce_messages_total{status="ok",topic="orders"} 2
+# HELP app_kafka_consumer_lag kafka.consumer.lag
+# TYPE app_kafka_consumer_lag gauge
+app_kafka_consumer_lag{partition="0",topic="orders"} 7
+`
+	err := testutil.GatherAndCompare(reg, strings.NewReader(expected),
+		"app_kafka_produce_messages_total", "app_kafka_consumer_lag")
+	if err != nil {
+		t.Error(err)
+	}
+	if n := testutil.CollectAndCount(reg, "app_kafka_commit_latency_seconds"); n != 1 {
+		t.Errorf("expected one commit latency series, got %d", n)
+	}
+}
+
+func Test_Prometheus_DeclaredLabels(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	var errs []error
+	p := NewPrometheus(reg, "app", WithLabels("worker.processed", "topic", "status"),
+		WithErrorHandler(func(err error) { errs = append(errs, err) }))
+
+	// The first measurement leaves status out, it still is a label.
+	p.Count("worker.processed", 1, T("topic", "orders"))
+	p.Count("worker.processed", 2, T("topic", "orders"), T("status", "ok"))
+
+	// Measurements that don't fit are dropped and reported once, instead of panicking on the hot path.
+	for i := 0; i < 2; i++ {
+		p.Count("worker.processed", 1, T("tier", "1"))
+		p.Gauge("worker.processed.total", 1)
+	}
+	if len(errs) != 2 {
+		t.Errorf("expected an undeclared tag and a name registered with another type reported once each, got %v", errs)
+	}
+
+	expected := `
+# HELP app_worker_processed_total worker.processed
+# TYPE app_worker_processed_total counter
+app_worker_processed_total{status="",topic="orders"} 1
+app_worker_processed_total{status="ok",topic="orders"} 2
+`
+	if err := testutil.GatherAndCompare(reg, strings.NewReader(expected), "app_worker_processed_total"); err != nil {
+		t.Error(err)
+	}
+}
+
+func Test_StatsdTags(t *testing.T) {
+	got := statsdTags([]Tag{T("topic", "orders"), T("partition", "3")})
+	if strings.Join(got, ",") != "topic:orders,partition:3" {
+		t.Errorf("unexpected tags %v", got)
+	}
+}
@@ -0,0 +1,220 @@
+package metrics
+
+import (
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var _ Metrics = (*Prometheus)(nil)
+
+// Prometheus records measurements as prometheus collectors, created and registered on first use.
+// Dots in names become underscores, counters get a _total suffix and timings are histograms in seconds.
+// A metric's label names are the ones declared with WithLabels, or else the tag keys it was first recorded
+// with. Tags missing a label get "". Measurements are recorded from the hot path, so rather than panic like
+// the prometheus client, a measurement with a tag that isn't one of the metric's labels, or of a metric that
+// can't be registered, is dropped and the error reported once, see WithErrorHandler.
+type Prometheus struct {
+	registerer prometheus.Registerer
+	namespace  string
+	onError    func(err error)
+
+	mtx        sync.Mutex
+	counters   map[string]*prometheus.CounterVec
+	gauges     map[string]*prometheus.GaugeVec
+	histograms map[string]*prometheus.HistogramVec
+	labels     map[string][]string
+	// reported holds the errors already reported, so a broken metric doesn't flood the logs.
+	reported map[string]bool
+}
+
+// PrometheusOption interface to identify functional options that control the Prometheus behavior
+type PrometheusOption interface {
+	apply(p *Prometheus)
+}
+
+// WithLabels provides option to declare the tag keys metric name is recorded with, for metrics whose first
+// measurement may leave some of them out. default is the tag keys of the first measurement
+func WithLabels(name string, keys ...string) PrometheusOption { return labelsOption{name, keys} }
+
+type labelsOption struct {
+	name string
+	keys []string
+}
+
+// WithErrorHandler provides option to report the errors of measurements that are dropped, once per metric and
+// problem. default logs them with the standard library's log package
+func WithErrorHandler(fn func(err error)) PrometheusOption { return errorHandlerOption{fn} }
+
+type errorHandlerOption struct{ fn func(err error) }
+
+func (o errorHandlerOption) apply(p *Prometheus) {
+	if o.fn != nil {
+		p.onError = o.fn
+	}
+}
+
+func (o labelsOption) apply(p *Prometheus) {
+	labels := make([]string, len(o.keys))
+	for i, k := range o.keys {
+		labels[i] = promName(k)
+	}
+	sort.Strings(labels)
+	p.labels[o.name] = labels
+}
+
+// NewPrometheus registers collectors with registerer, e.g. prometheus.DefaultRegisterer, prefixing names with namespace.
+func NewPrometheus(registerer prometheus.Registerer, namespace string, options ...PrometheusOption) *Prometheus {
+	p := &Prometheus{
+		registerer: registerer,
+		namespace:  namespace,
+		onError:    func(err error) { log.Printf("metrics: %v", err) },
+		counters:   make(map[string]*prometheus.CounterVec),
+		gauges:     make(map[string]*prometheus.GaugeVec),
+		histograms: make(map[string]*prometheus.HistogramVec),
+		labels:     make(map[string][]string),
+		reported:   make(map[string]bool),
+	}
+	for _, option := range options {
+		if option != nil {
+			option.apply(p)
+		}
+	}
+	return p
+}
+
+func (p *Prometheus) Count(name string, value int64, tags ...Tag) {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+
+	c, ok := p.counters[name]
+	if !ok {
+		c = register(p, name, prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: p.namespace,
+			Name:      promName(name) + "_total",
+			Help:      name,
+		}, p.labelNames(name, tags)))
+		p.counters[name] = c
+	}
+	if labels, ok := p.labelValues(name, tags); ok && c != nil {
+		if counter, err := c.GetMetricWith(labels); err == nil {
+			counter.Add(float64(value))
+		} else {
+			p.report(name+"/"+err.Error(), errors.Wrapf(err, "dropped %s", name))
+		}
+	}
+}
+
+func (p *Prometheus) Gauge(name string, value float64, tags ...Tag) {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+
+	g, ok := p.gauges[name]
+	if !ok {
+		g = register(p, name, prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: p.namespace,
+			Name:      promName(name),
+			Help:      name,
+		}, p.labelNames(name, tags)))
+		p.gauges[name] = g
+	}
+	if labels, ok := p.labelValues(name, tags); ok && g != nil {
+		if gauge, err := g.GetMetricWith(labels); err == nil {
+			gauge.Set(value)
+		} else {
+			p.report(name+"/"+err.Error(), errors.Wrapf(err, "dropped %s", name))
+		}
+	}
+}
+
+func (p *Prometheus) Timing(name string, value time.Duration, tags ...Tag) {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+
+	h, ok := p.histograms[name]
+	if !ok {
+		h = register(p, name, prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: p.namespace,
+			Name:      promName(name) + "_seconds",
+			Help:      name,
+			Buckets:   prometheus.DefBuckets,
+		}, p.labelNames(name, tags)))
+		p.histograms[name] = h
+	}
+	if labels, ok := p.labelValues(name, tags); ok && h != nil {
+		if histogram, err := h.GetMetricWith(labels); err == nil {
+			histogram.Observe(value.Seconds())
+		} else {
+			p.report(name+"/"+err.Error(), errors.Wrapf(err, "dropped %s", name))
+		}
+	}
+}
+
+// register registers c, or returns the collector already registered under its name. It returns nil, and
+// reports why, if c can't be registered, the metric's measurements are dropped then. Callers must hold mtx.
+func register[C prometheus.Collector](p *Prometheus, name string, c C) C {
+	var none C
+	err := p.registerer.Register(c)
+	if err == nil {
+		return c
+	}
+	if are, ok := err.(prometheus.AlreadyRegisteredError); ok {
+		if existing, ok := are.ExistingCollector.(C); ok {
+			return existing
+		}
+		err = errors.Errorf("it is registered as a %T", are.ExistingCollector)
+	}
+	p.report(name, errors.Wrapf(err, "failed to register metric %s, dropping its measurements", name))
+	return none
+}
+
+// labelNames returns the metric's declared label names, or fixes them on first use. Callers must hold mtx.
+func (p *Prometheus) labelNames(name string, tags []Tag) []string {
+	if keys, ok := p.labels[name]; ok {
+		return keys
+	}
+	keys := make([]string, 0, len(tags))
+	for _, t := range tags {
+		keys = append(keys, promName(t.Key))
+	}
+	sort.Strings(keys)
+	p.labels[name] = keys
+	return keys
+}
+
+// labelValues maps tags onto the metric's label names. It returns false, and reports the tag, if one isn't
+// a label of the metric. Callers must hold mtx.
+func (p *Prometheus) labelValues(name string, tags []Tag) (prometheus.Labels, bool) {
+	labels := make(prometheus.Labels, len(p.labels[name]))
+	for _, k := range p.labels[name] {
+		labels[k] = ""
+	}
+	for _, t := range tags {
+		key := promName(t.Key)
+		if _, ok := labels[key]; !ok {
+			p.report(name+"/"+key, errors.Errorf("metric %s has no label %s, its labels are %v; declare them with WithLabels, dropping its measurements tagged %s",
+				name, key, p.labels[name], key))
+			return nil, false
+		}
+		labels[key] = t.Value
+	}
+	return labels, true
+}
+
+// report calls the error handler the first time an error is reported under key. Callers must hold mtx.
+func (p *Prometheus) report(key string, err error) {
+	if p.reported[key] {
+		return
+	}
+	p.reported[key] = true
+	p.onError(err)
+}
+
+func promName(name string) string {
+	return strings.NewReplacer(".", "_", "-", "_").Replace(name)
+}
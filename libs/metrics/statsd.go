@@ -0,0 +1,42 @@
+package metrics
+
+import (
+	"time"
+
+	"github.com/DataDog/datadog-go/statsd"
+)
+
+var _ Metrics = (*StatsD)(nil)
+
+// StatsD sends measurements to a DogStatsD agent. Tags are sent as key:value.
+type StatsD struct {
+	client statsd.ClientInterface
+}
+
+// NewStatsD sends through client, e.g. one created with statsd.New("127.0.0.1:8125", statsd.WithNamespace("myapp.")).
+func NewStatsD(client statsd.ClientInterface) *StatsD {
+	return &StatsD{client: client}
+}
+
+func (s *StatsD) Count(name string, value int64, tags ...Tag) {
+	_ = s.client.Count(name, value, statsdTags(tags), 1)
+}
+
+func (s *StatsD) Gauge(name string, value float64, tags ...Tag) {
+	_ = s.client.Gauge(name, value, statsdTags(tags), 1)
+}
+
+func (s *StatsD) Timing(name string, value time.Duration, tags ...Tag) {
+	_ = s.client.Distribution(name, float64(value)/float64(time.Millisecond), statsdTags(tags), 1)
+}
+
+func statsdTags(tags []Tag) []string {
+	if len(tags) == 0 {
+		return nil
+	}
+	out := make([]string, len(tags))
+	for i, t := range tags {
+		out[i] = t.Key + ":" + t.Value
+	}
+	return out
+}
@@ -0,0 +1,130 @@
+// Package outbox makes a database write and the kafka messages describing it atomic.
+// Events are inserted into an outbox table in the same transaction as the write, and a Relay
+// publishes them to kafka afterwards. Events can be published more than once but are never lost,
+// and events sharing a topic and key are published in the order they were inserted.
+package outbox
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+	"github.com/pkg/errors"
+	"github.com/zillow/howwegoatzillow/libs/kafka"
+)
+
+// Event is a message to publish once the transaction it was inserted in commits.
+type Event struct {
+	Topic   string
+	Key     string
+	Value   []byte
+	Headers kafka.Headers
+}
+
+// Config ...
+type Config struct {
+	// Table is the outbox table. Default is outbox.
+	Table string
+	// BatchSize is how many events the relay publishes per transaction. Default is 100.
+	BatchSize int
+	// PollInterval is how long the relay waits when there is nothing left to publish. Default is 1 second.
+	PollInterval time.Duration
+	// MaxAttempts is how many times an event is tried before the relay gives up on it. Events it gave up on
+	// stay in the table and hold back later events with the same key until someone deals with them. Default is 10.
+	MaxAttempts int
+	// RetryBackoff is the wait before the first retry, doubling on every attempt after. Default is 1 second.
+	RetryBackoff time.Duration
+	// MaxRetryBackoff caps the doubling RetryBackoff. Default is 1 hour.
+	MaxRetryBackoff time.Duration
+	// Retention is how long published events are kept before cleanup deletes them. Default is 24 hours.
+	Retention time.Duration
+	// CleanupInterval is how often the relay deletes published events. Default is 1 hour.
+	CleanupInterval time.Duration
+}
+
+func (c Config) withDefaults() Config {
+	if c.Table == "" {
+		c.Table = "outbox"
+	}
+	if c.BatchSize <= 0 {
+		c.BatchSize = 100
+	}
+	if c.PollInterval <= 0 {
+		c.PollInterval = time.Second
+	}
+	if c.MaxAttempts <= 0 {
+		c.MaxAttempts = 10
+	}
+	if c.RetryBackoff <= 0 {
+		c.RetryBackoff = time.Second
+	}
+	if c.MaxRetryBackoff <= 0 {
+		c.MaxRetryBackoff = time.Hour
+	}
+	if c.Retention <= 0 {
+		c.Retention = 24 * time.Hour
+	}
+	if c.CleanupInterval <= 0 {
+		c.CleanupInterval = time.Hour
+	}
+	return c
+}
+
+// Schema returns the DDL creating the outbox table for config.
+func Schema(config Config) string {
+	t := config.withDefaults().Table
+	return fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %[1]s (
+	id              BIGSERIAL PRIMARY KEY,
+	topic           TEXT NOT NULL,
+	key             TEXT NOT NULL,
+	value           BYTEA,
+	headers         JSONB,
+	created_at      TIMESTAMPTZ NOT NULL DEFAULT now(),
+	attempts        INT NOT NULL DEFAULT 0,
+	next_attempt_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+	last_error      TEXT,
+	sent_at         TIMESTAMPTZ
+);
+CREATE INDEX IF NOT EXISTS %[1]s_unsent ON %[1]s (topic, key, id) WHERE sent_at IS NULL;
+CREATE INDEX IF NOT EXISTS %[1]s_sent ON %[1]s (sent_at) WHERE sent_at IS NOT NULL;`, t)
+}
+
+// retryBackoff returns the wait before retrying an event that failed attempts times before.
+func (c Config) retryBackoff(attempts int) time.Duration {
+	backoff := c.RetryBackoff << attempts
+	// Shifted this far the backoff overflowed.
+	if attempts >= 63 || backoff>>attempts != c.RetryBackoff || backoff > c.MaxRetryBackoff {
+		return c.MaxRetryBackoff
+	}
+	return backoff
+}
+
+// Insert adds events to the outbox as part of tx. They are published once tx commits, and dropped if it rolls back.
+// Events get their CloudEvents id here unless they have one, so every attempt to publish them carries the same id
+// and consumers can drop the duplicates.
+func Insert(ctx context.Context, tx *sqlx.Tx, config Config, events ...Event) error {
+	query := fmt.Sprintf("INSERT INTO %s (topic, key, value, headers) VALUES ($1, $2, $3, $4)", config.withDefaults().Table)
+	for _, e := range events {
+		if _, ok := e.Headers.Lookup(kafka.IDHeader); !ok && !isStructured(e.Headers) {
+			id := kafka.Header{Key: kafka.IDHeader, Value: []byte(uuid.New().String())}
+			e.Headers = append(append(kafka.Headers(nil), e.Headers...), id)
+		}
+		headers, err := json.Marshal(e.Headers)
+		if err != nil {
+			return errors.Wrap(err, "failed to encode outbox event headers")
+		}
+		if _, err := tx.ExecContext(ctx, query, e.Topic, e.Key, e.Value, headers); err != nil {
+			return errors.Wrapf(err, "failed to insert outbox event for topic %s", e.Topic)
+		}
+	}
+	return nil
+}
+
+// isStructured reports whether the event is a CloudEvents structured mode envelope, which carries its id itself.
+func isStructured(headers kafka.Headers) bool {
+	return strings.HasPrefix(headers.Get(kafka.ContentTypeHeader), kafka.CloudEventsContentType)
+}
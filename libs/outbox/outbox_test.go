@@ -0,0 +1,164 @@
+package outbox
+
+import (
+	"context"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/jmoiron/sqlx"
+	"github.com/zillow/howwegoatzillow/libs/kafka"
+)
+
+func Test_Insert(t *testing.T) {
+	ctx := context.Background()
+	db, mock, _ := sqlmock.New()
+	defer db.Close()
+
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO events_outbox (topic, key, value, headers)")).
+		WithArgs("listings", "1", []byte("hello"), headersWithID{tenant: "zillow"}).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+
+	tx, _ := sqlx.NewDb(db, "sqlmock").Beginx()
+	err := Insert(ctx, tx, Config{Table: "events_outbox"}, Event{
+		Topic:   "listings",
+		Key:     "1",
+		Value:   []byte("hello"),
+		Headers: kafka.Headers{{Key: "tenant", Value: []byte("zillow")}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = tx.Commit()
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+// headersWithID matches encoded headers that have the tenant header and an event id.
+type headersWithID struct{ tenant string }
+
+func (m headersWithID) Match(v driver.Value) bool {
+	var headers kafka.Headers
+	if b, ok := v.([]byte); !ok || json.Unmarshal(b, &headers) != nil {
+		return false
+	}
+	return headers.Get("tenant") == m.tenant && headers.Get(kafka.IDHeader) != ""
+}
+
+func Test_Relay_PublishesAndMarksSent(t *testing.T) {
+	ctx := context.Background()
+	db, mock, _ := sqlmock.New()
+	defer db.Close()
+
+	client := kafka.NewMemoryClient()
+	relay := NewRelay(Config{}, sqlx.NewDb(db, "sqlmock"), client, nil)
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta("FOR UPDATE SKIP LOCKED")).
+		WithArgs(10, 100).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "topic", "key", "value", "headers", "attempts"}).
+			AddRow(1, "listings", "1", []byte("a"), []byte(`[{"Key":"tenant","Value":"emlsbG93"}]`), 0).
+			AddRow(2, "listings", "2", []byte("b"), nil, 0))
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE outbox SET sent_at = now() WHERE id = ANY($1)")).
+		WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectCommit()
+
+	n, err := relay.RelayOnce(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 2 {
+		t.Errorf("expected 2 events relayed, got %d", n)
+	}
+	msgs := client.Messages("listings")
+	if len(msgs) != 2 || msgs[0].Headers.Get("tenant") != "zillow" {
+		t.Fatalf("unexpected messages %v", msgs)
+	}
+	if msgs[1].Headers.Get(kafka.IDHeader) == "" {
+		t.Error("expected an event id for a row inserted without one")
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func Test_Relay_KeepsEventIDAcrossAttempts(t *testing.T) {
+	ctx := context.Background()
+	db, mock, _ := sqlmock.New()
+	defer db.Close()
+
+	client := kafka.NewMemoryClient()
+	relay := NewRelay(Config{}, sqlx.NewDb(db, "sqlmock"), client, nil)
+
+	// The row is claimed again, as after a relay that published it but failed to mark it sent.
+	for i := 0; i < 2; i++ {
+		mock.ExpectBegin()
+		mock.ExpectQuery(regexp.QuoteMeta("FOR UPDATE SKIP LOCKED")).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "topic", "key", "value", "headers", "attempts"}).
+				AddRow(3, "listings", "1", []byte("a"), nil, i))
+		mock.ExpectExec(regexp.QuoteMeta("UPDATE outbox SET sent_at = now()")).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectCommit()
+		if _, err := relay.RelayOnce(ctx); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	msgs := client.Messages("listings")
+	if len(msgs) != 2 || msgs[0].EventID() == "" || msgs[0].EventID() != msgs[1].EventID() {
+		t.Errorf("expected both attempts to carry the same event id, got %v", msgs)
+	}
+}
+
+type failingClient struct{ kafka.Client }
+
+func (failingClient) Writer(ctx context.Context, topicConfig kafka.Config) (kafka.Writer, error) {
+	return nil, errors.New("no brokers")
+}
+
+func Test_Relay_RecordsFailures(t *testing.T) {
+	ctx := context.Background()
+	db, mock, _ := sqlmock.New()
+	defer db.Close()
+
+	relay := NewRelay(Config{}, sqlx.NewDb(db, "sqlmock"), failingClient{}, nil)
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta("FOR UPDATE SKIP LOCKED")).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "topic", "key", "value", "headers", "attempts"}).
+			AddRow(7, "listings", "1", []byte("a"), nil, 2))
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE outbox SET attempts = attempts + 1")).
+		WithArgs(7, "no brokers", sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	if _, err := relay.RelayOnce(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func Test_Config_RetryBackoffIsCapped(t *testing.T) {
+	cfg := Config{}.withDefaults()
+	for attempts, want := range map[int]time.Duration{
+		0:   time.Second,
+		3:   8 * time.Second,
+		12:  time.Hour,
+		40:  time.Hour,
+		100: time.Hour,
+	} {
+		if got := cfg.retryBackoff(attempts); got != want {
+			t.Errorf("expected %s after %d attempts, got %s", want, attempts, got)
+		}
+	}
+}
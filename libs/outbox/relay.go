@@ -0,0 +1,179 @@
+package outbox
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+	"github.com/pkg/errors"
+	"github.com/zillow/howwegoatzillow/libs/kafka"
+)
+
+// Logger ...
+type Logger interface {
+	Error(ctx context.Context, msg string, keysAndValues ...interface{})
+}
+
+// Relay publishes outbox events to kafka. Any number of relays can run against the same table,
+// each claims its own rows.
+type Relay struct {
+	config Config
+	db     *sqlx.DB
+	client kafka.Client
+	logger Logger
+}
+
+// NewRelay creates a relay publishing events from config.Table through client.
+func NewRelay(config Config, db *sqlx.DB, client kafka.Client, logger Logger) *Relay {
+	return &Relay{config: config.withDefaults(), db: db, client: client, logger: logger}
+}
+
+// Run publishes events until ctx is done.
+func (r *Relay) Run(ctx context.Context) {
+	lastCleanup := time.Now()
+	for ctx.Err() == nil {
+		n, err := r.RelayOnce(ctx)
+		if err != nil {
+			r.logError(ctx, "outbox relay failed", err)
+		}
+
+		if time.Since(lastCleanup) >= r.config.CleanupInterval {
+			if _, err := r.Cleanup(ctx); err != nil {
+				r.logError(ctx, "outbox cleanup failed", err)
+			}
+			lastCleanup = time.Now()
+		}
+
+		// Keep going while there is work, a key with many events only has one published per batch.
+		if err == nil && n > 0 {
+			continue
+		}
+		select {
+		case <-time.After(r.config.PollInterval):
+		case <-ctx.Done():
+		}
+	}
+}
+
+type row struct {
+	ID       int64  `db:"id"`
+	Topic    string `db:"topic"`
+	Key      string `db:"key"`
+	Value    []byte `db:"value"`
+	Headers  []byte `db:"headers"`
+	Attempts int    `db:"attempts"`
+}
+
+// RelayOnce publishes one batch of due events and returns how many it claimed.
+// An event is only claimed once every earlier event with the same topic and key has been sent.
+func (r *Relay) RelayOnce(ctx context.Context) (int, error) {
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return 0, errors.Wrap(err, "failed to begin outbox transaction")
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	var rows []row
+	query := fmt.Sprintf(`SELECT id, topic, key, value, headers, attempts FROM %[1]s o
+WHERE o.sent_at IS NULL AND o.next_attempt_at <= now() AND o.attempts < $1
+AND NOT EXISTS (SELECT 1 FROM %[1]s p WHERE p.topic = o.topic AND p.key = o.key AND p.sent_at IS NULL AND p.id < o.id)
+ORDER BY o.id LIMIT $2 FOR UPDATE SKIP LOCKED`, r.config.Table)
+	if err := tx.SelectContext(ctx, &rows, query, r.config.MaxAttempts, r.config.BatchSize); err != nil {
+		return 0, errors.Wrap(err, "failed to claim outbox events")
+	}
+	if len(rows) == 0 {
+		return 0, nil
+	}
+
+	errs := r.publish(ctx, rows)
+
+	var sent []int64
+	for i, rw := range rows {
+		if errs[i] == nil {
+			sent = append(sent, rw.ID)
+			continue
+		}
+		_, err := tx.ExecContext(ctx,
+			fmt.Sprintf("UPDATE %s SET attempts = attempts + 1, last_error = $2, next_attempt_at = $3 WHERE id = $1", r.config.Table),
+			rw.ID, errs[i].Error(), time.Now().Add(r.config.retryBackoff(rw.Attempts)))
+		if err != nil {
+			return 0, errors.Wrap(err, "failed to record outbox failure")
+		}
+	}
+	if len(sent) > 0 {
+		_, err := tx.ExecContext(ctx,
+			fmt.Sprintf("UPDATE %s SET sent_at = now() WHERE id = ANY($1)", r.config.Table),
+			pq.Array(sent))
+		if err != nil {
+			return 0, errors.Wrap(err, "failed to mark outbox events sent")
+		}
+	}
+
+	return len(rows), errors.Wrap(tx.Commit(), "failed to commit outbox transaction")
+}
+
+// publish writes the rows and returns each one's error.
+func (r *Relay) publish(ctx context.Context, rows []row) []error {
+	errs := make([]error, len(rows))
+	writers := make(map[string]kafka.Writer)
+
+	var wg sync.WaitGroup
+	for i, rw := range rows {
+		w, ok := writers[rw.Topic]
+		if !ok {
+			var err error
+			if w, err = r.client.Writer(ctx, kafka.Config{Topic: rw.Topic}); err != nil {
+				errs[i] = err
+				continue
+			}
+			writers[rw.Topic] = w
+		}
+
+		var headers kafka.Headers
+		if len(rw.Headers) > 0 {
+			if err := json.Unmarshal(rw.Headers, &headers); err != nil {
+				errs[i] = errors.Wrap(err, "failed to decode outbox event headers")
+				continue
+			}
+		}
+		// Events inserted without an id get one derived from the row, the same on every attempt.
+		if _, ok := headers.Lookup(kafka.IDHeader); !ok && !isStructured(headers) {
+			id := uuid.NewSHA1(uuid.NameSpaceURL, []byte(fmt.Sprintf("outbox:%s/%d", r.config.Table, rw.ID)))
+			headers = append(headers, kafka.Header{Key: kafka.IDHeader, Value: []byte(id.String())})
+		}
+
+		i := i
+		wg.Add(1)
+		w.WriteAsync(ctx, kafka.Record{Key: rw.Key, Value: rw.Value, Headers: headers}, func(d kafka.Delivery) {
+			defer wg.Done()
+			errs[i] = d.Err
+		})
+	}
+	for _, w := range writers {
+		_ = w.Flush(ctx)
+	}
+	wg.Wait()
+	return errs
+}
+
+// Cleanup deletes events that were sent longer ago than the retention.
+func (r *Relay) Cleanup(ctx context.Context) (int64, error) {
+	res, err := r.db.ExecContext(ctx,
+		fmt.Sprintf("DELETE FROM %s WHERE sent_at < $1", r.config.Table),
+		time.Now().Add(-r.config.Retention))
+	if err != nil {
+		return 0, errors.Wrap(err, "failed to delete sent outbox events")
+	}
+	return res.RowsAffected()
+}
+
+func (r *Relay) logError(ctx context.Context, msg string, err error) {
+	if r.logger != nil {
+		r.logger.Error(ctx, msg, "error", err, "table", r.config.Table)
+	}
+}
@@ -0,0 +1,166 @@
+// Package stream declares small consume-transform-produce pipelines that run on a worker.Worker, e.g.
+//
+//	stream.Stream("listings").
+//		Filter(func(ctx context.Context, r stream.Record) bool { return r.Headers.Get("tenant") == "zillow" }).
+//		Map(enrich).
+//		To("listings.enriched").
+//		Run(ctx, factory, "listings-enricher")
+//
+// A message is only marked done once everything it produced was written, so a crash replays it rather than
+// losing output. Output can then be written more than once. Its ce_id header is derived from the input
+// message's id, or its topic, partition and offset, and where the record came out of the pipeline, so a
+// replay writes the same ids again and consumers dedupe on them.
+package stream
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+	"github.com/zillow/howwegoatzillow/libs/kafka"
+	"github.com/zillow/howwegoatzillow/libs/worker"
+)
+
+// Record is a message flowing through a pipeline.
+type Record struct {
+	Key       string
+	Value     []byte
+	Headers   kafka.Headers
+	Timestamp time.Time
+}
+
+// step turns one record into any number of records.
+type step func(ctx context.Context, r Record) ([]Record, error)
+
+// Pipeline is a chain of steps from a source topic to an output topic.
+type Pipeline struct {
+	topic string
+	steps []step
+	to    string
+}
+
+// Stream starts a pipeline reading topic.
+func Stream(topic string) *Pipeline {
+	return &Pipeline{topic: topic}
+}
+
+// Filter drops the records fn returns false for.
+func (p *Pipeline) Filter(fn func(ctx context.Context, r Record) bool) *Pipeline {
+	return p.then(func(ctx context.Context, r Record) ([]Record, error) {
+		if !fn(ctx, r) {
+			return nil, nil
+		}
+		return []Record{r}, nil
+	})
+}
+
+// Map replaces each record with what fn returns. An error fails the message, as a worker processor error does.
+func (p *Pipeline) Map(fn func(ctx context.Context, r Record) (Record, error)) *Pipeline {
+	return p.then(func(ctx context.Context, r Record) ([]Record, error) {
+		out, err := fn(ctx, r)
+		if err != nil {
+			return nil, err
+		}
+		return []Record{out}, nil
+	})
+}
+
+// FlatMap replaces each record with any number of records.
+func (p *Pipeline) FlatMap(fn func(ctx context.Context, r Record) ([]Record, error)) *Pipeline {
+	return p.then(fn)
+}
+
+// To writes what comes out of the pipeline to topic.
+func (p *Pipeline) To(topic string) *Pipeline {
+	p.to = topic
+	return p
+}
+
+func (p *Pipeline) then(s step) *Pipeline {
+	p.steps = append(p.steps, s)
+	return p
+}
+
+// Run runs the pipeline on a worker of factory in consumer group groupID until ctx is done.
+func (p *Pipeline) Run(ctx context.Context, factory worker.Factory, groupID string, options ...worker.RunOption) {
+	factory.Create(kafka.Config{Topic: p.topic, GroupID: groupID}).Run(ctx, p.Processor(factory.Client()), options...)
+}
+
+// Processor returns the pipeline as a worker processor writing its output with client.
+func (p *Pipeline) Processor(client kafka.Client) worker.Processor {
+	return func(ctx context.Context, msg *kafka.Message) error {
+		records := []Record{{Key: msg.Key, Value: msg.Value(), Headers: msg.Headers, Timestamp: msg.Timestamp}}
+		// ids identify each record by the input message and its position out of every step, the same on a replay.
+		ids := []string{inputID(msg)}
+		for _, s := range p.steps {
+			var next []Record
+			var nextIDs []string
+			for i, r := range records {
+				out, err := s(context.WithValue(ctx, recordIDKey{}, ids[i]), r)
+				if err != nil {
+					return err
+				}
+				next = append(next, out...)
+				for j := range out {
+					nextIDs = append(nextIDs, ids[i]+"/"+strconv.Itoa(j))
+				}
+			}
+			if records, ids = next, nextIDs; len(records) == 0 {
+				return nil
+			}
+		}
+		if p.to == "" {
+			return nil
+		}
+
+		w, err := client.Writer(ctx, kafka.Config{Topic: p.to})
+		if err != nil {
+			return errors.Wrapf(err, "failed to get writer for %s", p.to)
+		}
+		out := make([]kafka.Record, len(records))
+		for i, r := range records {
+			headers := outputHeaders(r.Headers)
+			headers.Set(kafka.IDHeader, uuid.NewSHA1(uuid.NameSpaceURL, []byte("stream:"+p.to+"/"+ids[i])).String())
+			out[i] = kafka.Record{Key: r.Key, Value: r.Value, Headers: headers}
+		}
+		// ctx carries the span of the message being processed, so the writes are traced as its children.
+		_, err = w.WriteBatch(ctx, out)
+		return errors.Wrapf(err, "failed to write to %s", p.to)
+	}
+}
+
+// inputID identifies msg by its event id, which survives it being written again, or else its place in the topic.
+func inputID(msg *kafka.Message) string {
+	if id := msg.EventID(); id != "" {
+		return id
+	}
+	return fmt.Sprintf("%s/%d/%d", msg.Topic, msg.Partition, msg.Offset)
+}
+
+type recordIDKey struct{}
+
+// recordID returns the id of the record a step is called with, false outside of a pipeline's processor.
+func recordID(ctx context.Context) (string, bool) {
+	id, ok := ctx.Value(recordIDKey{}).(string)
+	return id, ok
+}
+
+// outputHeaders keeps the headers of a record except the ones that identify the input message:
+// an output record is a new event with its own id, and its own span in the trace.
+func outputHeaders(headers kafka.Headers) kafka.Headers {
+	out := make(kafka.Headers, 0, len(headers))
+	for _, h := range headers {
+		switch {
+		case strings.HasPrefix(h.Key, kafka.CloudEventsHeaderPrefix),
+			h.Key == kafka.TraceparentHeader,
+			h.Key == kafka.TracestateHeader:
+		default:
+			out = append(out, h)
+		}
+	}
+	return out
+}
@@ -0,0 +1,163 @@
+package stream
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/zillow/howwegoatzillow/libs/kafka"
+	"github.com/zillow/howwegoatzillow/libs/worker"
+)
+
+func Test_Pipeline_FilterMapTo(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	client := kafka.NewMemoryClient()
+	w, _ := client.Writer(ctx, kafka.Config{Topic: "listings"})
+	_, _ = w.Write(ctx, "a", []byte("keep"), kafka.WithHeader("tenant", "zillow"))
+	_, _ = w.Write(ctx, "b", []byte("drop"))
+	_, _ = w.Write(ctx, "c", []byte("keep too"), kafka.WithHeader("tenant", "zillow"))
+
+	go Stream("listings").
+		Filter(func(ctx context.Context, r Record) bool { return r.Headers.Get("tenant") == "zillow" }).
+		Map(func(ctx context.Context, r Record) (Record, error) {
+			r.Value = []byte(strings.ToUpper(string(r.Value)))
+			return r, nil
+		}).
+		To("listings.upper").
+		Run(ctx, worker.NewFactory(client), "upper")
+
+	if err := client.WaitFor(ctx, "listings.upper", 2); err != nil {
+		t.Fatal(err)
+	}
+	got := map[string]string{}
+	for _, msg := range client.Messages("listings.upper") {
+		got[msg.Key] = string(msg.Value())
+		if msg.Headers.Get("tenant") != "zillow" {
+			t.Error("expected headers to be carried over")
+		}
+		if msg.EventID() == client.Messages("listings")[0].EventID() {
+			t.Error("expected output to get its own event id")
+		}
+	}
+	if len(got) != 2 || got["a"] != "KEEP" || got["c"] != "KEEP TOO" {
+		t.Errorf("unexpected output %v", got)
+	}
+}
+
+func Test_Aggregate_Windows(t *testing.T) {
+	count := func(ctx context.Context, agg []byte, r Record) ([]byte, error) {
+		n, _ := strconv.Atoi(string(agg))
+		return []byte(strconv.Itoa(n + 1)), nil
+	}
+	base := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	at := func(d time.Duration) Record { return Record{Key: "k", Timestamp: base.Add(d)} }
+
+	tests := []struct {
+		name    string
+		windows Windows
+		records []Record
+		// want is the value and window start, from base, of the last record emitted for each input
+		want   []string
+		stored int
+	}{
+		{
+			name:    "tumbling",
+			windows: Tumbling(time.Minute),
+			records: []Record{at(0), at(30 * time.Second), at(time.Minute), at(50 * time.Second)},
+			want:    []string{"1@0s", "2@0s", "1@1m0s", ""},
+			stored:  1,
+		},
+		{
+			name:    "tumbling with grace",
+			windows: Tumbling(time.Minute).Grace(30 * time.Second),
+			records: []Record{at(0), at(time.Minute), at(50 * time.Second), at(2 * time.Minute)},
+			want:    []string{"1@0s", "1@1m0s", "2@0s", "1@2m0s"},
+			stored:  2,
+		},
+		{
+			name:    "sliding",
+			windows: Sliding(time.Minute, 30*time.Second),
+			records: []Record{at(0), at(40 * time.Second)},
+			want:    []string{"1@0s", "1@30s"},
+			stored:  2,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := NewMemoryStore()
+			p := Stream("in").Aggregate(tt.windows, store, count)
+			for i, r := range tt.records {
+				out, err := p.steps[0](context.Background(), r)
+				if err != nil {
+					t.Fatal(err)
+				}
+				got := ""
+				if len(out) > 0 {
+					last := out[len(out)-1]
+					start, _ := time.Parse(time.RFC3339Nano, last.Headers.Get(WindowStartHeader))
+					got = string(last.Value) + "@" + start.Sub(base).String()
+				}
+				if got != tt.want[i] {
+					t.Errorf("record %d: expected %q, got %q", i, tt.want[i], got)
+				}
+			}
+			if store.Len() != tt.stored {
+				t.Errorf("expected %d windows stored, got %d", tt.stored, store.Len())
+			}
+		})
+	}
+}
+
+func Test_Windows_RejectsWindowsThatMissRecords(t *testing.T) {
+	for name, fn := range map[string]func(){
+		"zero size":               func() { Tumbling(0) },
+		"zero advance":            func() { Sliding(time.Minute, 0) },
+		"advance beyond the size": func() { Sliding(time.Minute, 2*time.Minute) },
+		"zero value":              func() { Stream("in").Aggregate(Windows{}, NewMemoryStore(), nil) },
+	} {
+		t.Run(name, func(t *testing.T) {
+			defer func() {
+				if recover() == nil {
+					t.Error("expected a panic")
+				}
+			}()
+			fn()
+		})
+	}
+}
+
+func Test_Aggregate_ProcessingAgainDoesNotCountTwice(t *testing.T) {
+	ctx := context.Background()
+	count := func(ctx context.Context, agg []byte, r Record) ([]byte, error) {
+		n, _ := strconv.Atoi(string(agg))
+		return []byte(strconv.Itoa(n + 1)), nil
+	}
+
+	client := kafka.NewMemoryClient()
+	w, _ := client.Writer(ctx, kafka.Config{Topic: "views"})
+	_, _ = w.Write(ctx, "k", []byte("view"))
+	msg := client.Messages("views")[0]
+
+	process := Stream("views").Aggregate(Tumbling(time.Minute), NewMemoryStore(), count).To("views.counts").Processor(client)
+	// The second run is a retry or redelivery of the same message.
+	for i := 0; i < 2; i++ {
+		if err := process(ctx, msg); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	out := client.Messages("views.counts")
+	if len(out) != 2 {
+		t.Fatalf("expected 2 outputs, got %d", len(out))
+	}
+	if string(out[1].Value()) != "1" {
+		t.Errorf("expected the record to be counted once, got %s", out[1].Value())
+	}
+	if out[0].EventID() == "" || out[0].EventID() != out[1].EventID() {
+		t.Errorf("expected the same output id on both runs, got %q and %q", out[0].EventID(), out[1].EventID())
+	}
+}
@@ -0,0 +1,246 @@
+package stream
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/zillow/howwegoatzillow/libs/kafka"
+)
+
+// Headers set on the records a window aggregation produces.
+const (
+	WindowStartHeader = "window-start"
+	WindowEndHeader   = "window-end"
+)
+
+// Windows describes how records are grouped in time, by their timestamp.
+type Windows struct {
+	size    time.Duration
+	advance time.Duration
+	grace   time.Duration
+}
+
+// Tumbling windows are size long and don't overlap, every record is in exactly one.
+// It panics if size isn't positive.
+func Tumbling(size time.Duration) Windows {
+	return Windows{size: size, advance: size}.check()
+}
+
+// Sliding windows are size long and start every advance, so a record is in size/advance of them.
+// It panics unless 0 < advance <= size: windows advancing further than their size would leave gaps
+// that records fall into no window of.
+func Sliding(size, advance time.Duration) Windows {
+	return Windows{size: size, advance: advance}.check()
+}
+
+// check panics on windows that can't hold every record, at the time a pipeline is declared.
+func (w Windows) check() Windows {
+	switch {
+	case w.size <= 0:
+		panic(fmt.Sprintf("stream: window size must be positive, got %s", w.size))
+	case w.advance <= 0 || w.advance > w.size:
+		panic(fmt.Sprintf("stream: window advance must be positive and at most the size %s, got %s", w.size, w.advance))
+	}
+	return w
+}
+
+// Grace keeps windows open for records that arrive up to d late. Default is 0.
+func (w Windows) Grace(d time.Duration) Windows {
+	w.grace = d
+	return w
+}
+
+// starts returns the starts of the windows t falls in, oldest first.
+func (w Windows) starts(t time.Time) []time.Time {
+	last := t.Truncate(w.advance)
+	var starts []time.Time
+	for s := last.Add(-w.size + w.advance); !s.After(last); s = s.Add(w.advance) {
+		if t.Before(s.Add(w.size)) {
+			starts = append(starts, s)
+		}
+	}
+	return starts
+}
+
+// Aggregator folds a record into the aggregate of its window and key. agg is nil for the window's first record.
+type Aggregator func(ctx context.Context, agg []byte, r Record) ([]byte, error)
+
+// Store keeps the state of windows. Implementations must be safe for concurrent use.
+type Store interface {
+	// Get returns false if there is nothing under key.
+	Get(ctx context.Context, key string) ([]byte, bool, error)
+	Put(ctx context.Context, key string, value []byte) error
+	Delete(ctx context.Context, key string) error
+}
+
+// Aggregate folds records into per key aggregates for each window they fall in, kept in store.
+// Every update emits the window's current aggregate, keyed by the record key, with window-start
+// and window-end headers in RFC3339. Records for windows closed longer than the grace period are dropped.
+//
+// Each open window also remembers the records it folded in, so a message processed again, because writing
+// the output failed or it was redelivered, emits the window's aggregate without folding the record twice.
+// Records are identified by their message's id and place in the pipeline, see Processor. What a window
+// folded in is kept in memory until it closes, a message redelivered after the process restarted is
+// folded again.
+//
+// Closed windows are deleted from the store as time moves on. Windows left open when the process stops
+// are not, so a persistent store should expire entries after the window size and grace on its own.
+// It panics on windows not made by Tumbling or Sliding.
+func (p *Pipeline) Aggregate(windows Windows, store Store, fn Aggregator) *Pipeline {
+	a := &aggregation{
+		windows: windows.check(),
+		store:   store,
+		fn:      fn,
+		open:    make(map[time.Time]map[string]struct{}),
+		applied: make(map[string]map[string]struct{}),
+	}
+	return p.then(a.step)
+}
+
+type aggregation struct {
+	windows Windows
+	store   Store
+	fn      Aggregator
+
+	// mtx serializes updates, workers process messages concurrently.
+	mtx sync.Mutex
+	// now is the latest record timestamp seen, the aggregation's idea of the current time.
+	now time.Time
+	// open holds the store keys of every window still open, by window end.
+	open map[time.Time]map[string]struct{}
+	// applied holds the ids of the records folded into each open window, by store key.
+	applied map[string]map[string]struct{}
+}
+
+func (a *aggregation) step(ctx context.Context, r Record) ([]Record, error) {
+	a.mtx.Lock()
+	defer a.mtx.Unlock()
+
+	if r.Timestamp.After(a.now) {
+		a.now = r.Timestamp
+	}
+
+	id, known := recordID(ctx)
+	var out []Record
+	for _, start := range a.windows.starts(r.Timestamp) {
+		end := start.Add(a.windows.size)
+		if !end.Add(a.windows.grace).After(a.now) {
+			continue
+		}
+
+		key := r.Key + "@" + strconv.FormatInt(start.UnixMilli(), 10)
+		state, err := a.get(ctx, key)
+		if err != nil {
+			return nil, err
+		}
+		if _, done := a.applied[key][id]; !known || !done {
+			if state.Aggregate, err = a.fn(ctx, state.Aggregate, r); err != nil {
+				return nil, err
+			}
+			if err := a.put(ctx, key, state); err != nil {
+				return nil, err
+			}
+			if known {
+				if a.applied[key] == nil {
+					a.applied[key] = make(map[string]struct{})
+				}
+				a.applied[key][id] = struct{}{}
+			}
+		}
+		if a.open[end] == nil {
+			a.open[end] = make(map[string]struct{})
+		}
+		a.open[end][key] = struct{}{}
+
+		rec := Record{Key: r.Key, Value: state.Aggregate, Headers: append(kafka.Headers(nil), r.Headers...), Timestamp: r.Timestamp}
+		rec.Headers.Set(WindowStartHeader, start.UTC().Format(time.RFC3339Nano))
+		rec.Headers.Set(WindowEndHeader, end.UTC().Format(time.RFC3339Nano))
+		out = append(out, rec)
+	}
+	return out, a.expire(ctx)
+}
+
+// windowState is what the store keeps for a window.
+type windowState struct {
+	Aggregate []byte `json:"aggregate"`
+}
+
+func (a *aggregation) get(ctx context.Context, key string) (windowState, error) {
+	var state windowState
+	raw, ok, err := a.store.Get(ctx, key)
+	if err != nil || !ok {
+		return state, errors.Wrapf(err, "failed to get window %s", key)
+	}
+	return state, errors.Wrapf(json.Unmarshal(raw, &state), "failed to decode window %s", key)
+}
+
+func (a *aggregation) put(ctx context.Context, key string, state windowState) error {
+	raw, err := json.Marshal(state)
+	if err != nil {
+		return errors.Wrapf(err, "failed to encode window %s", key)
+	}
+	return errors.Wrapf(a.store.Put(ctx, key, raw), "failed to put window %s", key)
+}
+
+// expire deletes the windows that closed. Callers must hold mtx.
+func (a *aggregation) expire(ctx context.Context) error {
+	for end, keys := range a.open {
+		if end.Add(a.windows.grace).After(a.now) {
+			continue
+		}
+		for key := range keys {
+			if err := a.store.Delete(ctx, key); err != nil {
+				return errors.Wrapf(err, "failed to delete window %s", key)
+			}
+			delete(a.applied, key)
+		}
+		delete(a.open, end)
+	}
+	return nil
+}
+
+var _ Store = (*MemoryStore)(nil)
+
+// MemoryStore keeps window aggregates in memory. They are lost when the process stops.
+type MemoryStore struct {
+	mtx sync.Mutex
+	m   map[string][]byte
+}
+
+// NewMemoryStore creates an empty MemoryStore.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{m: make(map[string][]byte)}
+}
+
+func (s *MemoryStore) Get(_ context.Context, key string) ([]byte, bool, error) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	v, ok := s.m[key]
+	return v, ok, nil
+}
+
+func (s *MemoryStore) Put(_ context.Context, key string, value []byte) error {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	s.m[key] = value
+	return nil
+}
+
+func (s *MemoryStore) Delete(_ context.Context, key string) error {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	delete(s.m, key)
+	return nil
+}
+
+// Len returns how many aggregates the store holds.
+func (s *MemoryStore) Len() int {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	return len(s.m)
+}
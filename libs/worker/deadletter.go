@@ -0,0 +1,104 @@
+package worker
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/zillow/howwegoatzillow/libs/kafka"
+)
+
+// Headers added to messages sent to the dead letter topic, next to the headers the message already had.
+const (
+	DeadLetterHeaderPrefix    = "dlq-"
+	DeadLetterErrorHeader     = DeadLetterHeaderPrefix + "error"
+	DeadLetterStackHeader     = DeadLetterHeaderPrefix + "stack"
+	DeadLetterAttemptsHeader  = DeadLetterHeaderPrefix + "attempts"
+	DeadLetterTopicHeader     = DeadLetterHeaderPrefix + "source-topic"
+	DeadLetterPartitionHeader = DeadLetterHeaderPrefix + "source-partition"
+	DeadLetterOffsetHeader    = DeadLetterHeaderPrefix + "source-offset"
+	DeadLetterTimeHeader      = DeadLetterHeaderPrefix + "timestamp"
+)
+
+// DeadLetter describes why and where from a message was sent to the dead letter topic.
+// Stack is the stack trace of a panic, or of an error created with github.com/pkg/errors, and empty otherwise.
+type DeadLetter struct {
+	Error           string
+	Stack           string
+	Attempts        int
+	SourceTopic     string
+	SourcePartition int32
+	SourceOffset    int64
+	Time            time.Time
+}
+
+// ParseDeadLetter reads the dead letter headers of msg. It returns false if msg didn't come from a dead letter topic.
+func ParseDeadLetter(msg *kafka.Message) (DeadLetter, bool) {
+	topic, ok := msg.Headers.Lookup(DeadLetterTopicHeader)
+	if !ok {
+		return DeadLetter{}, false
+	}
+
+	dl := DeadLetter{
+		Error:       msg.Headers.Get(DeadLetterErrorHeader),
+		Stack:       msg.Headers.Get(DeadLetterStackHeader),
+		SourceTopic: string(topic),
+	}
+	dl.Attempts, _ = strconv.Atoi(msg.Headers.Get(DeadLetterAttemptsHeader))
+	if p, err := strconv.ParseInt(msg.Headers.Get(DeadLetterPartitionHeader), 10, 32); err == nil {
+		dl.SourcePartition = int32(p)
+	}
+	dl.SourceOffset, _ = strconv.ParseInt(msg.Headers.Get(DeadLetterOffsetHeader), 10, 64)
+	dl.Time, _ = time.Parse(time.RFC3339Nano, msg.Headers.Get(DeadLetterTimeHeader))
+	return dl, true
+}
+
+// deadLetter writes msg to the dead letter topic with the original headers and why it failed.
+func (w *work) deadLetter(ctx context.Context, msg *kafka.Message, cause error, attempts int) error {
+	topic, partition, offset := source(msg)
+
+	// In a transactional run the dead letter is written in the message's transaction.
+	writer, err := w.writer(ctx, w.dlqTopic)
+	if err != nil {
+		return errors.Wrap(err, "failed to get dead letter writer")
+	}
+
+	options := []kafka.WriteOption{
+		kafka.WithHeaders(msg.Headers...),
+		kafka.WithHeader(DeadLetterErrorHeader, cause.Error()),
+		kafka.WithHeader(DeadLetterAttemptsHeader, strconv.Itoa(attempts)),
+		kafka.WithHeader(DeadLetterTopicHeader, topic),
+		kafka.WithHeader(DeadLetterPartitionHeader, strconv.FormatInt(int64(partition), 10)),
+		kafka.WithHeader(DeadLetterOffsetHeader, strconv.FormatInt(offset, 10)),
+		kafka.WithHeader(DeadLetterTimeHeader, time.Now().UTC().Format(time.RFC3339Nano)),
+	}
+	if stack := stackOf(cause); stack != "" {
+		options = append(options, kafka.WithHeader(DeadLetterStackHeader, stack))
+	}
+	_, err = writer.Write(ctx, msg.Key, msg.Value(), options...)
+	return errors.Wrapf(err, "failed to write to dead letter topic %s", w.dlqTopic)
+}
+
+// Replay writes a dead lettered message back to the topic it came from, without the dead letter and retry headers.
+func Replay(ctx context.Context, client kafka.Client, msg *kafka.Message) (kafka.Response, error) {
+	dl, ok := ParseDeadLetter(msg)
+	if !ok {
+		return kafka.Response{}, errors.Errorf("message at %s/%d/%d has no %s header",
+			msg.Topic, msg.Partition, msg.Offset, DeadLetterTopicHeader)
+	}
+
+	headers := make(kafka.Headers, 0, len(msg.Headers))
+	for _, h := range msg.Headers {
+		if !strings.HasPrefix(h.Key, DeadLetterHeaderPrefix) && !strings.HasPrefix(h.Key, RetryHeaderPrefix) {
+			headers = append(headers, h)
+		}
+	}
+
+	writer, err := client.Writer(ctx, kafka.Config{Topic: dl.SourceTopic})
+	if err != nil {
+		return kafka.Response{}, errors.Wrapf(err, "failed to get writer for %s", dl.SourceTopic)
+	}
+	return writer.Write(ctx, msg.Key, msg.Value(), kafka.WithHeaders(headers...))
+}
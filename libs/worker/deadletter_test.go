@@ -0,0 +1,167 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/zillow/howwegoatzillow/libs/kafka"
+)
+
+func Test_Worker_DeadLettersAfterRetries(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	client := kafka.NewMemoryClient()
+	w, _ := client.Writer(ctx, kafka.Config{Topic: "listings"})
+	_, _ = w.Write(ctx, "a", []byte("a"), kafka.WithHeader("tenant", "zillow"))
+
+	var calls int32
+	worker := NewFactory(client).Create(kafka.Config{Topic: "listings", GroupID: "g"})
+	go worker.Run(ctx, func(ctx context.Context, msg *kafka.Message) error {
+		atomic.AddInt32(&calls, 1)
+		return errors.New("boom")
+	}, WithRetries(2, time.Millisecond), WithDeadLetterTopic("listings.dlq"))
+
+	if err := client.WaitFor(ctx, "listings.dlq", 1); err != nil {
+		t.Fatal(err)
+	}
+	if got := atomic.LoadInt32(&calls); got != 3 {
+		t.Errorf("expected 3 attempts, got %d", got)
+	}
+
+	msg := client.Messages("listings.dlq")[0]
+	dl, ok := ParseDeadLetter(msg)
+	if !ok {
+		t.Fatal("expected dead letter headers")
+	}
+	if dl.Error != "boom" || dl.Attempts != 3 || dl.SourceTopic != "listings" || dl.SourceOffset != 0 {
+		t.Errorf("unexpected dead letter %+v", dl)
+	}
+	if dl.Stack != "" {
+		t.Errorf("expected no stack for an error without one, got %s", dl.Stack)
+	}
+	if msg.Headers.Get("tenant") != "zillow" {
+		t.Error("expected the original headers to be kept")
+	}
+
+	for ctx.Err() == nil && client.Committed("g", "listings")[0] != 1 {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if ctx.Err() != nil {
+		t.Error("expected the dead lettered message to be committed")
+	}
+
+	if _, err := Replay(ctx, client, msg); err != nil {
+		t.Fatal(err)
+	}
+	replayed := client.Messages("listings")[1]
+	if _, ok := replayed.Headers.Lookup(DeadLetterErrorHeader); ok {
+		t.Error("expected dead letter headers to be stripped on replay")
+	}
+	if replayed.Headers.Get("tenant") != "zillow" {
+		t.Error("expected the original headers to be replayed")
+	}
+}
+
+func Test_Worker_DeadLettersPanicWithStack(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	client := kafka.NewMemoryClient()
+	w, _ := client.Writer(ctx, kafka.Config{Topic: "listings"})
+	_, _ = w.Write(ctx, "a", []byte("a"))
+
+	worker := NewFactory(client).Create(kafka.Config{Topic: "listings", GroupID: "g"})
+	go worker.Run(ctx, func(ctx context.Context, msg *kafka.Message) error {
+		panic("nil listing")
+	}, WithDeadLetterTopic("listings.dlq"))
+
+	if err := client.WaitFor(ctx, "listings.dlq", 1); err != nil {
+		t.Fatal(err)
+	}
+	dl, _ := ParseDeadLetter(client.Messages("listings.dlq")[0])
+	if !strings.Contains(dl.Error, "nil listing") {
+		t.Errorf("expected the panic value in the error, got %s", dl.Error)
+	}
+	if !strings.Contains(dl.Stack, "panic: nil listing") || !strings.Contains(dl.Stack, "Test_Worker_DeadLettersPanicWithStack") {
+		t.Errorf("expected the panic's stack, got %s", dl.Stack)
+	}
+}
+
+func Test_Worker_DeadLettersMissingClaimCheck(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	mem := kafka.NewMemoryClient()
+	store, _ := kafka.NewFileBlobStore(t.TempDir())
+	client := kafka.NewClaimCheckClient(mem, store, 4)
+	w, _ := mem.Writer(ctx, kafka.Config{Topic: "listings"})
+	_, _ = w.Write(ctx, "a", nil, kafka.WithHeader(kafka.ClaimCheckHeader, "listings/gone"))
+
+	var calls int32
+	worker := NewFactory(client).Create(kafka.Config{Topic: "listings", GroupID: "g"})
+	go worker.Run(ctx, func(ctx context.Context, msg *kafka.Message) error {
+		atomic.AddInt32(&calls, 1)
+		return nil
+	}, WithRetries(2, time.Millisecond), WithDeadLetterTopic("listings.dlq"))
+
+	if err := mem.WaitFor(ctx, "listings.dlq", 1); err != nil {
+		t.Fatal(err)
+	}
+	if got := atomic.LoadInt32(&calls); got != 0 {
+		t.Errorf("expected the processor not to be called, got %d calls", got)
+	}
+	if dl, _ := ParseDeadLetter(mem.Messages("listings.dlq")[0]); dl.Attempts != 1 {
+		t.Errorf("expected no retries for a missing payload, got %+v", dl)
+	}
+}
+
+// flakyBlobStore fails the first Get.
+type flakyBlobStore struct {
+	kafka.BlobStore
+	failed int32
+}
+
+func (s *flakyBlobStore) Get(ctx context.Context, key string) ([]byte, error) {
+	if atomic.CompareAndSwapInt32(&s.failed, 0, 1) {
+		return nil, errors.New("blob store unavailable")
+	}
+	return s.BlobStore.Get(ctx, key)
+}
+
+func Test_Worker_RetryFetchesClaimCheckAgain(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	mem := kafka.NewMemoryClient()
+	files, _ := kafka.NewFileBlobStore(t.TempDir())
+	store := &flakyBlobStore{BlobStore: files}
+	client := kafka.NewClaimCheckClient(mem, store, 4)
+	w, _ := client.Writer(ctx, kafka.Config{Topic: "listings"})
+	if _, err := w.Write(ctx, "a", []byte("large payload")); err != nil {
+		t.Fatal(err)
+	}
+
+	processed := make(chan string, 1)
+	worker := NewFactory(client).Create(kafka.Config{Topic: "listings", GroupID: "g"})
+	go worker.Run(ctx, func(ctx context.Context, msg *kafka.Message) error {
+		processed <- string(msg.Value())
+		return nil
+	}, WithRetries(2, time.Millisecond), WithDeadLetterTopic("listings.dlq"))
+
+	select {
+	case v := <-processed:
+		if v != "large payload" {
+			t.Errorf("expected the fetched payload, got %q", v)
+		}
+	case <-ctx.Done():
+		t.Fatal("expected the retry to fetch the payload again")
+	}
+	if n := len(mem.Messages("listings.dlq")); n != 0 {
+		t.Errorf("expected nothing dead lettered, got %d", n)
+	}
+}
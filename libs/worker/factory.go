@@ -3,20 +3,23 @@ package worker
 import (
 	"github.com/opentracing/opentracing-go"
 	"github.com/zillow/howwegoatzillow/libs/kafka"
+	"github.com/zillow/howwegoatzillow/libs/metrics"
 )
 
 type Factory struct {
-	client kafka.Client
-	logger Logger
-	tracer opentracing.Tracer
+	client  kafka.Client
+	logger  Logger
+	tracer  opentracing.Tracer
+	metrics metrics.Metrics
 }
 
 // NewFactory initializes a new worker factory applying all the provided options.
 func NewFactory(client kafka.Client, options ...FactoryOption) Factory {
 	wf := &Factory{
-		client: client,
-		logger: NoopLogger{},
-		tracer: opentracing.NoopTracer{},
+		client:  client,
+		logger:  NoopLogger{},
+		tracer:  opentracing.NoopTracer{},
+		metrics: metrics.Noop{},
 	}
 
 	for _, option := range options {
@@ -31,10 +34,11 @@ func NewFactory(client kafka.Client, options ...FactoryOption) Factory {
 // Create creates a new Worker which when run will `DO` the provided work.
 func (wf Factory) Create(config kafka.Config, options ...WorkerOption) *Worker {
 	w := &Worker{
-		client: wf.client,
-		config: config,
-		logger: wf.logger,
-		tracer: wf.tracer,
+		client:  wf.client,
+		config:  config,
+		logger:  wf.logger,
+		tracer:  wf.tracer,
+		metrics: wf.metrics,
 	}
 
 	for _, option := range options {
@@ -44,3 +48,6 @@ func (wf Factory) Create(config kafka.Config, options ...WorkerOption) *Worker {
 	}
 	return w
 }
+
+// Client returns the kafka client the factory's workers read from.
+func (wf Factory) Client() kafka.Client { return wf.client }
@@ -0,0 +1,173 @@
+package worker
+
+import (
+	"container/list"
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/pkg/errors"
+	"github.com/zillow/howwegoatzillow/libs/kafka"
+)
+
+// IdempotencyStore remembers which messages were processed.
+type IdempotencyStore interface {
+	// Process runs fn unless the message with id was already processed on topic, and remembers it
+	// as processed once fn succeeds. duplicate reports whether fn was skipped.
+	Process(ctx context.Context, topic, id string, fn func(ctx context.Context) error) (duplicate bool, err error)
+}
+
+// Idempotent drops messages that were already processed, as identified by their CloudEvents id,
+// or the guid header for messages written before writers set one.
+// Kafka delivers at least once, so a message can come back after a rebalance or a failed commit.
+// Messages without an id are always processed.
+func Idempotent(store IdempotencyStore) Middleware {
+	return func(next Processor) Processor {
+		return func(ctx context.Context, msg *kafka.Message) error {
+			id := msg.EventID()
+			if id == "" {
+				return next(ctx, msg)
+			}
+			_, err := store.Process(ctx, msg.Topic, id, func(ctx context.Context) error {
+				return next(ctx, msg)
+			})
+			return err
+		}
+	}
+}
+
+// MemoryIdempotencyStore remembers the most recently processed messages in memory.
+// It only catches duplicates delivered to the same instance, use PostgresIdempotencyStore across instances.
+type MemoryIdempotencyStore struct {
+	size int
+	ttl  time.Duration
+
+	mtx     sync.Mutex
+	entries map[string]*list.Element
+	order   *list.List
+}
+
+type memoryEntry struct {
+	key     string
+	expires time.Time
+}
+
+// NewMemoryIdempotencyStore remembers up to size messages, each for ttl. A zero ttl never expires them.
+func NewMemoryIdempotencyStore(size int, ttl time.Duration) *MemoryIdempotencyStore {
+	return &MemoryIdempotencyStore{
+		size:    size,
+		ttl:     ttl,
+		entries: make(map[string]*list.Element),
+		order:   list.New(),
+	}
+}
+
+// Process runs fn unless the message is remembered. A message is only remembered once fn succeeded, so a
+// duplicate processed at the same time isn't detected. With Speedup that includes duplicates on the same
+// partition, which the worker processes concurrently too; redeliveries after a rebalance come once the
+// first delivery finished and are caught.
+func (s *MemoryIdempotencyStore) Process(ctx context.Context, topic, id string, fn func(ctx context.Context) error) (bool, error) {
+	key := topic + "/" + id
+	if s.seen(key) {
+		return true, nil
+	}
+	if err := fn(ctx); err != nil {
+		return false, err
+	}
+	s.mark(key)
+	return false, nil
+}
+
+func (s *MemoryIdempotencyStore) seen(key string) bool {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	e, ok := s.entries[key]
+	if !ok {
+		return false
+	}
+	if s.ttl > 0 && time.Now().After(e.Value.(*memoryEntry).expires) {
+		s.order.Remove(e)
+		delete(s.entries, key)
+		return false
+	}
+	s.order.MoveToFront(e)
+	return true
+}
+
+func (s *MemoryIdempotencyStore) mark(key string) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	entry := &memoryEntry{key: key, expires: time.Now().Add(s.ttl)}
+	if e, ok := s.entries[key]; ok {
+		e.Value = entry
+		s.order.MoveToFront(e)
+		return
+	}
+	s.entries[key] = s.order.PushFront(entry)
+	for s.size > 0 && s.order.Len() > s.size {
+		oldest := s.order.Back()
+		s.order.Remove(oldest)
+		delete(s.entries, oldest.Value.(*memoryEntry).key)
+	}
+}
+
+// PostgresIdempotencyStore remembers processed messages in a table keyed by guid and topic.
+// The mark is written in a transaction the processor can join through TxFromContext, so the
+// processor's own writes and the mark commit or roll back together.
+type PostgresIdempotencyStore struct {
+	db    *sqlx.DB
+	table string
+}
+
+// NewPostgresIdempotencyStore uses table, see IdempotencySchema.
+func NewPostgresIdempotencyStore(db *sqlx.DB, table string) *PostgresIdempotencyStore {
+	return &PostgresIdempotencyStore{db: db, table: table}
+}
+
+// IdempotencySchema returns the DDL creating the table for PostgresIdempotencyStore.
+// Rows can be deleted once redelivery is no longer possible, e.g. after the topic's retention.
+func IdempotencySchema(table string) string {
+	return fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %[1]s (
+	guid         TEXT NOT NULL,
+	topic        TEXT NOT NULL,
+	processed_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+	PRIMARY KEY (guid, topic)
+);`, table)
+}
+
+// Process inserts the mark first, so a concurrent duplicate waits on the row lock and then sees it.
+func (s *PostgresIdempotencyStore) Process(ctx context.Context, topic, id string, fn func(ctx context.Context) error) (bool, error) {
+	tx, err := s.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return false, errors.Wrap(err, "failed to begin idempotency transaction")
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	res, err := tx.ExecContext(ctx,
+		fmt.Sprintf("INSERT INTO %s (guid, topic) VALUES ($1, $2) ON CONFLICT DO NOTHING", s.table),
+		id, topic)
+	if err != nil {
+		return false, errors.Wrap(err, "failed to mark message processed")
+	}
+	if n, err := res.RowsAffected(); err != nil || n == 0 {
+		return true, errors.Wrap(err, "failed to mark message processed")
+	}
+
+	if err := fn(context.WithValue(ctx, txKey{}, tx)); err != nil {
+		return false, err
+	}
+	return false, errors.Wrap(tx.Commit(), "failed to commit idempotency transaction")
+}
+
+type txKey struct{}
+
+// TxFromContext returns the transaction a PostgresIdempotencyStore runs the processor in.
+// Work done in it is committed together with the mark that the message was processed.
+func TxFromContext(ctx context.Context) (*sqlx.Tx, bool) {
+	tx, ok := ctx.Value(txKey{}).(*sqlx.Tx)
+	return tx, ok
+}
@@ -0,0 +1,93 @@
+package worker
+
+import (
+	"context"
+	"regexp"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/jmoiron/sqlx"
+	"github.com/zillow/howwegoatzillow/libs/kafka"
+)
+
+func Test_Worker_IdempotentDropsDuplicates(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	client := kafka.NewMemoryClient()
+	w, _ := client.Writer(ctx, kafka.Config{Topic: "listings"})
+	_, _ = w.Write(ctx, "a", []byte("a"), kafka.WithHeader(kafka.IDHeader, "1"))
+	_, _ = w.Write(ctx, "a", []byte("a"), kafka.WithHeader(kafka.IDHeader, "1"))
+	_, _ = w.Write(ctx, "b", []byte("b"), kafka.WithHeader(kafka.IDHeader, "2"))
+
+	var calls int32
+	worker := NewFactory(client).Create(kafka.Config{Topic: "listings", GroupID: "g"})
+	go worker.Run(ctx, func(ctx context.Context, msg *kafka.Message) error {
+		atomic.AddInt32(&calls, 1)
+		return nil
+	}, WithMiddleware(Idempotent(NewMemoryIdempotencyStore(100, time.Minute))))
+
+	for ctx.Err() == nil && client.Committed("g", "listings")[0] != 3 {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if got := atomic.LoadInt32(&calls); got != 2 {
+		t.Errorf("expected the duplicate to be dropped, processor called %d times", got)
+	}
+}
+
+func Test_MemoryIdempotencyStore_EvictsOldest(t *testing.T) {
+	ctx := context.Background()
+	s := NewMemoryIdempotencyStore(2, 0)
+	noop := func(context.Context) error { return nil }
+
+	for _, id := range []string{"1", "2", "3"} {
+		_, _ = s.Process(ctx, "t", id, noop)
+	}
+	if dup, _ := s.Process(ctx, "t", "3", noop); !dup {
+		t.Error("expected 3 to be remembered")
+	}
+	if dup, _ := s.Process(ctx, "t", "1", noop); dup {
+		t.Error("expected 1 to be evicted")
+	}
+}
+
+func Test_PostgresIdempotencyStore(t *testing.T) {
+	ctx := context.Background()
+	db, mock, _ := sqlmock.New()
+	defer db.Close()
+	s := NewPostgresIdempotencyStore(sqlx.NewDb(db, "sqlmock"), "processed")
+
+	insert := regexp.QuoteMeta("INSERT INTO processed (guid, topic) VALUES ($1, $2) ON CONFLICT DO NOTHING")
+	mock.ExpectBegin()
+	mock.ExpectExec(insert).WithArgs("1", "listings").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE listings")).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+	mock.ExpectBegin()
+	mock.ExpectExec(insert).WithArgs("1", "listings").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectRollback()
+
+	dup, err := s.Process(ctx, "listings", "1", func(ctx context.Context) error {
+		tx, ok := TxFromContext(ctx)
+		if !ok {
+			t.Fatal("expected the processor to get the transaction")
+		}
+		_, err := tx.ExecContext(ctx, "UPDATE listings SET price = 1")
+		return err
+	})
+	if dup || err != nil {
+		t.Fatalf("expected first delivery to be processed, got %v %v", dup, err)
+	}
+
+	dup, err = s.Process(ctx, "listings", "1", func(ctx context.Context) error {
+		t.Error("duplicate should not be processed")
+		return nil
+	})
+	if !dup || err != nil {
+		t.Errorf("expected a duplicate, got %v %v", dup, err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,193 @@
+package worker
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/zillow/howwegoatzillow/libs/kafka"
+)
+
+// revokeTimeout bounds how long a revocation waits for the partitions' in flight messages.
+const revokeTimeout = 30 * time.Second
+
+// inflight counts the messages being processed per partition, and pauses the reader on partitions that are
+// at their limit or whose commit is stalled.
+type inflight struct {
+	mtx    sync.Mutex
+	reader kafka.Reader
+	// limit is how many messages of a partition are processed at once before it is paused, 0 for no limit.
+	limit  int
+	counts map[int32]int
+	// stalled holds, by partition, the offsets of the messages that failed without being marked done.
+	stalled map[int32]map[int64]struct{}
+	changed chan struct{}
+}
+
+func newInflight(limit int) *inflight {
+	return &inflight{
+		limit:   limit,
+		counts:  make(map[int32]int),
+		stalled: make(map[int32]map[int64]struct{}),
+		changed: make(chan struct{}),
+	}
+}
+
+// setReader sets the reader to pause and resume partitions on.
+func (f *inflight) setReader(r kafka.Reader) {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+	f.reader = r
+}
+
+// add counts a message of the partition, pausing the partition when it reaches the limit.
+func (f *inflight) add(partition int32) {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+
+	f.counts[partition]++
+	if f.limit > 0 && f.counts[partition] == f.limit {
+		f.pause(partition)
+	}
+}
+
+// done uncounts a message of the partition, resuming the partition when it drops below the limit.
+func (f *inflight) done(partition int32) {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+
+	f.counts[partition]--
+	if _, stalled := f.stalled[partition]; f.limit > 0 && f.counts[partition] == f.limit-1 && !stalled {
+		f.resume(partition)
+	}
+	if f.counts[partition] == 0 {
+		delete(f.counts, partition)
+	}
+	close(f.changed)
+	f.changed = make(chan struct{})
+}
+
+// stall pauses the partition because the message at offset failed and isn't marked done. Nothing after it
+// can be committed until it is processed again, so reading on would only pile up work to redo.
+// It returns false if the partition was already stalled on the offset.
+func (f *inflight) stall(partition int32, offset int64) bool {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+
+	offsets, ok := f.stalled[partition]
+	if !ok {
+		offsets = make(map[int64]struct{})
+		f.stalled[partition] = offsets
+		f.pause(partition)
+	}
+	if _, ok := offsets[offset]; ok {
+		return false
+	}
+	offsets[offset] = struct{}{}
+	return true
+}
+
+// redeliver counts the message at offset of the partition for processing it again, and returns false if the
+// partition is no longer stalled on it, because it was revoked or rewound. The message comes again then.
+func (f *inflight) redeliver(partition int32, offset int64) bool {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+
+	if _, ok := f.stalled[partition][offset]; !ok {
+		return false
+	}
+	f.counts[partition]++
+	return true
+}
+
+// unstall drops the message at offset, which is done now, and resumes the partition if it was the last one
+// the partition stalled on.
+func (f *inflight) unstall(partition int32, offset int64) {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+
+	offsets, ok := f.stalled[partition]
+	if !ok {
+		return
+	}
+	delete(offsets, offset)
+	if len(offsets) == 0 {
+		delete(f.stalled, partition)
+		f.resumeBelowLimit(partition)
+	}
+}
+
+// stalledCount returns how many partitions are stalled.
+func (f *inflight) stalledCount() int {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+	return len(f.stalled)
+}
+
+// revoke resumes the stalled partitions among partitions, they start over from the committed offset when
+// they are assigned again.
+func (f *inflight) revoke(partitions []int32) {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+
+	for _, p := range partitions {
+		if _, ok := f.stalled[p]; ok {
+			delete(f.stalled, p)
+			f.resumeBelowLimit(p)
+		}
+	}
+}
+
+// revokeAll resumes every stalled partition, e.g. after a seek that reads them from the seek offsets again.
+func (f *inflight) revokeAll() {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+
+	for p := range f.stalled {
+		delete(f.stalled, p)
+		f.resumeBelowLimit(p)
+	}
+}
+
+// pause and resume must be called holding mtx.
+func (f *inflight) pause(partition int32) {
+	if f.reader != nil {
+		f.reader.Pause(partition)
+	}
+}
+
+func (f *inflight) resume(partition int32) {
+	if f.reader != nil {
+		f.reader.Resume(partition)
+	}
+}
+
+// resumeBelowLimit resumes the partition unless it is at the limit, done resumes it then.
+func (f *inflight) resumeBelowLimit(partition int32) {
+	if f.limit == 0 || f.counts[partition] < f.limit {
+		f.resume(partition)
+	}
+}
+
+// wait blocks until none of the partitions has messages in flight or ctx is done.
+func (f *inflight) wait(ctx context.Context, partitions []int32) error {
+	for {
+		f.mtx.Lock()
+		busy := false
+		for _, p := range partitions {
+			busy = busy || f.counts[p] > 0
+		}
+		changed := f.changed
+		f.mtx.Unlock()
+
+		if !busy {
+			return nil
+		}
+
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
@@ -0,0 +1,23 @@
+package worker
+
+import (
+	"context"
+
+	"github.com/zillow/howwegoatzillow/libs/kafka"
+)
+
+// Processor handles a single message. Returning an error leaves the message unprocessed.
+type Processor func(ctx context.Context, msg *kafka.Message) error
+
+// Middleware wraps a Processor with behavior that runs around it.
+type Middleware func(next Processor) Processor
+
+// Chain wraps p with middlewares. The first middleware is the outermost, it runs first.
+func Chain(p Processor, middlewares ...Middleware) Processor {
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		if middlewares[i] != nil {
+			p = middlewares[i](p)
+		}
+	}
+	return p
+}
@@ -4,6 +4,8 @@ import (
 	"time"
 
 	"github.com/opentracing/opentracing-go"
+	"github.com/zillow/howwegoatzillow/libs/kafka"
+	"github.com/zillow/howwegoatzillow/libs/metrics"
 )
 
 // RunOption interface to identify functional options that can control `worker.Run` behavior
@@ -45,10 +47,115 @@ func (c circuitBreakAfterOption) apply(w *runSettings) {
 	}
 }
 
+// WithRetries retries a failed message up to times more, waiting backoff between attempts. Default is no retries.
+// Messages that can't be decoded aren't retried, it won't help.
+func WithRetries(times uint32, backoff time.Duration) RunOption {
+	return retriesOption{times: times, backoff: backoff}
+}
+
+type retriesOption struct {
+	times   uint32
+	backoff time.Duration
+}
+
+func (r retriesOption) apply(s *runSettings) {
+	s.retries = r.times
+	s.retryBackoff = r.backoff
+}
+
+// WithDeadLetterTopic sends messages that still fail after all retries to topic, so they don't hold up
+// the rest of the partition. The failure is described in dlq-* headers, see DeadLetter.
+func WithDeadLetterTopic(topic string) RunOption { return deadLetterTopicOption{topic} }
+
+type deadLetterTopicOption struct{ topic string }
+
+func (d deadLetterTopicOption) apply(s *runSettings) { s.dlqTopic = d.topic }
+
+// WithMiddleware wraps the processor passed to Run, the first middleware outermost. See Idempotent.
+func WithMiddleware(middlewares ...Middleware) RunOption { return middlewareOption{middlewares} }
+
+type middlewareOption struct{ middlewares []Middleware }
+
+func (m middlewareOption) apply(s *runSettings) {
+	s.middlewares = append(s.middlewares, m.middlewares...)
+}
+
+// StartFrom provides option to start the partitions the consumer group has no committed offset for at the
+// position, e.g. kafka.Latest to skip a backlog. Retry topics always start from the earliest message.
+// It doesn't move a group that already committed, use Worker.Rewind or Admin.ResetGroupOffsets for that.
+// default is kafka.Earliest
+func StartFrom(to kafka.Position) RunOption { return startFromOption{to} }
+
+type startFromOption struct{ to kafka.Position }
+
+func (s startFromOption) apply(rs *runSettings) { rs.startFrom = &s.to }
+
+// Transactional provides option to process messages exactly once: each batch of messages polled is processed
+// in a Kafka transaction that commits their offsets together with what the processor wrote through
+// TransactionalWriter, and with the dead letters. Messages are processed one at a time in order, and a
+// message that still fails after its retries aborts the transaction unless there is a dead letter topic.
+// Retry topics are not used. The client must be a kafka.TransactionalClient, and transactionalID unique to
+// the instance and the same across its restarts, e.g. the pod name of a stateful set.
+func Transactional(transactionalID string) RunOption { return transactionalOption{transactionalID} }
+
+type transactionalOption struct{ id string }
+
+func (t transactionalOption) apply(s *runSettings) { s.transactionalID = t.id }
+
+// WithMaxInflightPerPartition provides option to pause reading a partition while n of its messages are being
+// processed, so a partition whose messages are slow doesn't take all of Speedup's goroutines from the others.
+// It is resumed as soon as one of them finishes. default is no limit per partition
+func WithMaxInflightPerPartition(n int) RunOption { return maxInflightOption{n} }
+
+type maxInflightOption struct{ n int }
+
+func (m maxInflightOption) apply(s *runSettings) {
+	if m.n > 0 {
+		s.maxInflightPerPartition = m.n
+	}
+}
+
+// defaultStallBackoff is how long a stalled partition waits before its failed message is processed again.
+const defaultStallBackoff = 30 * time.Second
+
+// WithStallBackoff sets how long to wait before processing again a message that failed after its retries
+// without a retry or dead letter topic to send it to. Its partition is paused meanwhile, since nothing after
+// the message can be committed, and resumed once the message is done or the partition is reassigned, see
+// MetricStalledPartitions. default is 30s
+func WithStallBackoff(d time.Duration) RunOption { return stallBackoffOption{d} }
+
+type stallBackoffOption struct{ d time.Duration }
+
+func (o stallBackoffOption) apply(s *runSettings) {
+	if o.d > 0 {
+		s.stallBackoff = o.d
+	}
+}
+
 type WorkerOption interface {
 	apply(w *Worker)
 }
 
+// WithRetryTopics sends failed messages through a retry topic per delay, e.g. 5s, 1m and 10m give
+// topic.retry.5s, topic.retry.1m and topic.retry.10m. Each tier is read by its own worker that waits until
+// the message is due and calls the same processor, so failures don't hold up the partition they came from.
+// Messages failing the last tier go to the dead letter topic, if one is set with WithDeadLetterTopic.
+// Run creates the retry topics that don't exist yet through WithAdmin's admin, or the client if it is a
+// kafka.Admin, like the memory client; otherwise they must be created beforehand. It then starts the workers
+// for every tier, each in its own consumer group, see RetryGroup.
+func WithRetryTopics(delays ...time.Duration) WorkerOption { return retryTopicsOption{delays} }
+
+type retryTopicsOption struct{ delays []time.Duration }
+
+func (r retryTopicsOption) apply(w *Worker) { w.retryDelays = r.delays }
+
+// WithAdmin provides option to create the retry topics of WithRetryTopics with admin.
+func WithAdmin(admin kafka.Admin) WorkerOption { return adminOption{admin} }
+
+type adminOption struct{ admin kafka.Admin }
+
+func (a adminOption) apply(w *Worker) { w.admin = a.admin }
+
 func WithWorkerLogger(l Logger) WorkerOption { return workerLoggerOption{l} }
 
 type workerLoggerOption struct{ l Logger }
@@ -87,3 +194,16 @@ func (s tracerOption) apply(wf *Factory) {
 		wf.tracer = s.t
 	}
 }
+
+// WithMetrics provides option to report processing, circuit breaker and in-flight metrics. default is none
+func WithMetrics(m metrics.Metrics) FactoryOption {
+	return metricsOption{m}
+}
+
+type metricsOption struct{ m metrics.Metrics }
+
+func (s metricsOption) apply(wf *Factory) {
+	if s.m != nil {
+		wf.metrics = s.m
+	}
+}
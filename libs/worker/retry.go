@@ -0,0 +1,144 @@
+package worker
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/zillow/howwegoatzillow/libs/kafka"
+)
+
+// Headers added to messages sent to a retry topic. The source headers keep pointing at the message
+// as it was first read, however many tiers it goes through.
+const (
+	RetryHeaderPrefix    = "retry-"
+	RetryDueHeader       = RetryHeaderPrefix + "due"
+	RetryTierHeader      = RetryHeaderPrefix + "tier"
+	RetryTopicHeader     = RetryHeaderPrefix + "source-topic"
+	RetryPartitionHeader = RetryHeaderPrefix + "source-partition"
+	RetryOffsetHeader    = RetryHeaderPrefix + "source-offset"
+)
+
+// RetryTopic names the retry topic for topic and delay, e.g. orders.retry.5s or orders.retry.10m.
+func RetryTopic(topic string, delay time.Duration) string {
+	var d string
+	switch {
+	case delay%time.Hour == 0:
+		d = fmt.Sprintf("%dh", delay/time.Hour)
+	case delay%time.Minute == 0:
+		d = fmt.Sprintf("%dm", delay/time.Minute)
+	case delay%time.Second == 0:
+		d = fmt.Sprintf("%ds", delay/time.Second)
+	default:
+		d = fmt.Sprintf("%dms", delay/time.Millisecond)
+	}
+	return topic + ".retry." + d
+}
+
+// RetryGroup names the consumer group reading the retry topic for delay, e.g. billing.retry.5s. Tiers don't
+// share the main group, so starting or stopping one doesn't rebalance the consumers of the main topic.
+func RetryGroup(group string, delay time.Duration) string {
+	return RetryTopic(group, delay)
+}
+
+// retryWorker creates the worker for the given retry tier, counting from 1.
+func (w *Worker) retryWorker(tier int) *Worker {
+	delay := w.retryDelays[tier-1]
+	config := w.config
+	config.Topic = RetryTopic(w.config.Topic, delay)
+	if config.GroupID != "" {
+		config.GroupID = RetryGroup(w.config.GroupID, delay)
+	}
+	return &Worker{
+		client:      w.client,
+		admin:       w.admin,
+		config:      config,
+		logger:      w.logger,
+		tracer:      w.tracer,
+		metrics:     w.metrics,
+		retryDelays: w.retryDelays,
+		sourceTopic: w.config.Topic,
+		tier:        tier,
+	}
+}
+
+// ensureRetryTopics creates the retry topics that don't exist yet, with the partitions and replication of
+// the topic. Without an admin it leaves them to exist already.
+func (w *Worker) ensureRetryTopics(ctx context.Context) error {
+	admin := w.admin
+	if admin == nil {
+		a, ok := w.client.(kafka.Admin)
+		if !ok {
+			return nil
+		}
+		admin = a
+	}
+
+	desc, err := admin.DescribeTopic(ctx, w.config.Topic)
+	if err != nil {
+		return err
+	}
+	specs := make([]kafka.TopicSpec, len(w.retryDelays))
+	for i, delay := range w.retryDelays {
+		specs[i] = kafka.TopicSpec{
+			Topic:             RetryTopic(w.config.Topic, delay),
+			Partitions:        desc.Partitions,
+			ReplicationFactor: desc.ReplicationFactor,
+		}
+	}
+	return admin.EnsureTopics(ctx, specs...)
+}
+
+// retry writes msg to the next retry tier, due once the tier's delay has passed.
+func (w *work) retry(ctx context.Context, msg *kafka.Message) error {
+	topic, partition, offset := source(msg)
+
+	writer, err := w.kclient.Writer(ctx, kafka.Config{Topic: w.retryTopic})
+	if err != nil {
+		return errors.Wrap(err, "failed to get retry writer")
+	}
+
+	_, err = writer.Write(ctx, msg.Key, msg.Value(),
+		kafka.WithHeaders(msg.Headers...),
+		kafka.WithHeader(RetryDueHeader, time.Now().Add(w.retryDelay).UTC().Format(time.RFC3339Nano)),
+		kafka.WithHeader(RetryTierHeader, strconv.Itoa(w.tier+1)),
+		kafka.WithHeader(RetryTopicHeader, topic),
+		kafka.WithHeader(RetryPartitionHeader, strconv.FormatInt(int64(partition), 10)),
+		kafka.WithHeader(RetryOffsetHeader, strconv.FormatInt(offset, 10)),
+	)
+	return errors.Wrapf(err, "failed to write to retry topic %s", w.retryTopic)
+}
+
+// waitUntilDue blocks until a message from a retry topic is due.
+func waitUntilDue(ctx context.Context, msg *kafka.Message) error {
+	due, err := time.Parse(time.RFC3339Nano, msg.Headers.Get(RetryDueHeader))
+	if err != nil {
+		return nil
+	}
+
+	wait := time.Until(due)
+	if wait <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// source returns where msg was first read from, before it went through any retry topics.
+func source(msg *kafka.Message) (string, int32, int64) {
+	topic, ok := msg.Headers.Lookup(RetryTopicHeader)
+	if !ok {
+		return msg.Topic, msg.Partition, msg.Offset
+	}
+	partition, _ := strconv.ParseInt(msg.Headers.Get(RetryPartitionHeader), 10, 32)
+	offset, _ := strconv.ParseInt(msg.Headers.Get(RetryOffsetHeader), 10, 64)
+	return string(topic), int32(partition), offset
+}
@@ -0,0 +1,161 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/zillow/howwegoatzillow/libs/kafka"
+)
+
+func Test_RetryTopic(t *testing.T) {
+	for delay, want := range map[time.Duration]string{
+		5 * time.Second:        "orders.retry.5s",
+		time.Minute:            "orders.retry.1m",
+		10 * time.Minute:       "orders.retry.10m",
+		2 * time.Hour:          "orders.retry.2h",
+		250 * time.Millisecond: "orders.retry.250ms",
+	} {
+		if got := RetryTopic("orders", delay); got != want {
+			t.Errorf("expected %s, got %s", want, got)
+		}
+	}
+}
+
+func Test_Worker_RetriesThroughTiersThenDeadLetters(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	client := kafka.NewMemoryClient()
+	w, _ := client.Writer(ctx, kafka.Config{Topic: "orders"})
+	_, _ = w.Write(ctx, "a", []byte("a"))
+
+	var mtx sync.Mutex
+	var topics []string
+	var times []time.Time
+
+	worker := NewFactory(client).Create(kafka.Config{Topic: "orders", GroupID: "g"},
+		WithRetryTopics(20*time.Millisecond, 50*time.Millisecond))
+	go worker.Run(ctx, func(ctx context.Context, msg *kafka.Message) error {
+		mtx.Lock()
+		defer mtx.Unlock()
+		topics = append(topics, msg.Topic)
+		times = append(times, time.Now())
+		return errors.New("boom")
+	}, WithDeadLetterTopic("orders.dlq"))
+
+	if err := client.WaitFor(ctx, "orders.dlq", 1); err != nil {
+		t.Fatal(err)
+	}
+
+	mtx.Lock()
+	defer mtx.Unlock()
+	want := []string{"orders", "orders.retry.20ms", "orders.retry.50ms"}
+	if len(topics) != len(want) {
+		t.Fatalf("expected attempts on %v, got %v", want, topics)
+	}
+	for i := range want {
+		if topics[i] != want[i] {
+			t.Errorf("expected attempt %d on %s, got %s", i, want[i], topics[i])
+		}
+	}
+	if gap := times[2].Sub(times[1]); gap < 50*time.Millisecond {
+		t.Errorf("expected the last tier to wait 50ms, waited %s", gap)
+	}
+
+	dl, _ := ParseDeadLetter(client.Messages("orders.dlq")[0])
+	if dl.SourceTopic != "orders" || dl.SourceOffset != 0 {
+		t.Errorf("expected the dead letter to point at the original message, got %+v", dl)
+	}
+
+	for ctx.Err() == nil && client.Committed("g.retry.50ms", "orders.retry.50ms")[0] != 1 {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if ctx.Err() != nil {
+		t.Error("expected the last tier to commit in its own group")
+	}
+	if committed := client.Committed("g", "orders.retry.20ms"); len(committed) != 0 {
+		t.Errorf("expected the main group not to read the retry topics, got %v", committed)
+	}
+}
+
+func Test_Worker_CreatesRetryTopics(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	client := kafka.NewMemoryClient(kafka.WithPartitions(3))
+	_ = client.CreateTopic(ctx, kafka.TopicSpec{Topic: "orders"})
+
+	worker := NewFactory(client).Create(kafka.Config{Topic: "orders", GroupID: "g"}, WithRetryTopics(time.Second))
+	go worker.Run(ctx, func(ctx context.Context, msg *kafka.Message) error { return nil })
+
+	for ctx.Err() == nil {
+		if desc, err := client.DescribeTopic(ctx, "orders.retry.1s"); err == nil {
+			if desc.Partitions != 3 {
+				t.Errorf("expected the retry topic to have the topic's 3 partitions, got %d", desc.Partitions)
+			}
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Error("expected the retry topic to be created")
+}
+
+// slowStopLogger takes a while to log a failure of a message on topic, as a worker stopping slowly would.
+type slowStopLogger struct {
+	NoopLogger
+	topic  string
+	logged int32
+}
+
+func (l *slowStopLogger) Error(_ context.Context, _ string, keysAndValues ...interface{}) {
+	for _, v := range keysAndValues {
+		if msg, ok := v.(*kafka.Message); ok && msg.Topic == l.topic {
+			time.Sleep(50 * time.Millisecond)
+			atomic.StoreInt32(&l.logged, 1)
+		}
+	}
+}
+
+func Test_Worker_RunWaitsForRetryTiers(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	client := kafka.NewMemoryClient()
+	w, _ := client.Writer(ctx, kafka.Config{Topic: "orders"})
+	_, _ = w.Write(ctx, "a", []byte("a"))
+
+	logger := &slowStopLogger{topic: "orders.retry.10ms"}
+	retrying := make(chan struct{})
+	var once sync.Once
+	runCtx, stop := context.WithCancel(ctx)
+	done := make(chan struct{})
+	worker := NewFactory(client, WithLogger(logger)).Create(kafka.Config{Topic: "orders", GroupID: "g"},
+		WithRetryTopics(10*time.Millisecond))
+	go func() {
+		defer close(done)
+		worker.Run(runCtx, func(ctx context.Context, msg *kafka.Message) error {
+			if msg.Topic == "orders" {
+				return errors.New("boom")
+			}
+			// The retry tier is still busy with the message when the worker is stopped.
+			once.Do(func() { close(retrying) })
+			<-ctx.Done()
+			return ctx.Err()
+		})
+	}()
+
+	select {
+	case <-retrying:
+	case <-ctx.Done():
+		t.Fatal("expected the message to reach the retry tier")
+	}
+	stop()
+	<-done
+	if atomic.LoadInt32(&logger.logged) != 1 {
+		t.Error("expected Run to return after the retry tier's worker")
+	}
+}
@@ -0,0 +1,107 @@
+package worker
+
+import (
+	"context"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/zillow/howwegoatzillow/libs/kafka"
+)
+
+// transactorBackoff is how long a transactional run waits after an aborted transaction or a failed transactor.
+const transactorBackoff = time.Second
+
+type transactorKey struct{}
+
+// TransactionalWriter returns a writer for topic writing in the transaction of the message being processed,
+// so what it writes is committed together with the message's offset. It fails outside of processors run
+// with Transactional. Writes should be waited for, with Write or WriteBatch, before the processor returns.
+func TransactionalWriter(ctx context.Context, topic string) (kafka.Writer, error) {
+	tx, ok := ctx.Value(transactorKey{}).(kafka.Transactor)
+	if !ok {
+		return nil, errors.New("not processing a message of a transactional run")
+	}
+	return tx.Writer(topic), nil
+}
+
+// writer returns a writer for topic, writing in the message's transaction if there is one.
+func (w *work) writer(ctx context.Context, topic string) (kafka.Writer, error) {
+	if tx, ok := ctx.Value(transactorKey{}).(kafka.Transactor); ok {
+		return tx.Writer(topic), nil
+	}
+	return w.kclient.Writer(ctx, kafka.Config{Topic: topic})
+}
+
+// runTransactional processes messages in transactions until ctx is done or the worker wraps up.
+// A transactor that fails is closed and replaced, its transaction is aborted.
+func (w *Worker) runTransactional(ctx context.Context, work *work, transactionalID string) {
+	client, ok := w.client.(kafka.TransactionalClient)
+	if !ok {
+		w.logger.Error(ctx, "kafka client doesn't support transactions", "cfg", w.config)
+		return
+	}
+
+	for ctx.Err() == nil && !w.isWrappingUp() {
+		tx, err := client.Transactor(ctx, work.kconfig, transactionalID)
+		if err == nil {
+			err = work.transact(ctx, tx, w.isWrappingUp)
+			if closeErr := tx.Close(); closeErr != nil && err == nil {
+				err = errors.Wrap(closeErr, "failed to close kafka transactor")
+			}
+		}
+		if err != nil && ctx.Err() == nil {
+			w.logger.Error(ctx, "kafka transactional processing failed",
+				"error", err,
+				"cfg", work.kconfig)
+			sleep(ctx, transactorBackoff)
+		}
+	}
+}
+
+// transact processes polled messages one at a time and commits them in one transaction, until wrappingUp.
+// A message that isn't done, because it failed without being dead lettered, aborts the transaction and
+// the messages come again.
+func (w *work) transact(ctx context.Context, tx kafka.Transactor, wrappingUp func() bool) error {
+	txCtx := context.WithValue(ctx, transactorKey{}, tx)
+	for !wrappingUp() {
+		msgs, err := tx.Poll(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return errors.Wrap(err, "failed to poll kafka topic")
+		}
+
+		failed := false
+		for _, msg := range msgs {
+			// Once a message fails the transaction aborts, processing the rest would be wasted.
+			if err := w.doSingle(txCtx, msg, nil); err != nil && w.dlqTopic == "" {
+				failed = true
+				break
+			}
+		}
+		if failed {
+			if err := tx.Abort(ctx); err != nil {
+				return errors.Wrap(err, "failed to abort kafka transaction")
+			}
+			sleep(ctx, transactorBackoff)
+			continue
+		}
+
+		committed, err := tx.Commit(ctx)
+		if err != nil {
+			return errors.Wrap(err, "failed to commit kafka transaction")
+		}
+		if !committed {
+			sleep(ctx, transactorBackoff)
+		}
+	}
+	return nil
+}
+
+func sleep(ctx context.Context, d time.Duration) {
+	select {
+	case <-time.After(d):
+	case <-ctx.Done():
+	}
+}
@@ -0,0 +1,96 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/zillow/howwegoatzillow/libs/kafka"
+)
+
+func Test_Worker_TransactionalWritesOutputOnce(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	client := kafka.NewMemoryClient()
+	w, _ := client.Writer(ctx, kafka.Config{Topic: "payments"})
+	for _, key := range []string{"a", "b", "c"} {
+		_, _ = w.Write(ctx, key, []byte(key))
+	}
+
+	var failures int32
+	worker := NewFactory(client).Create(kafka.Config{Topic: "payments", GroupID: "billing"})
+	go worker.Run(ctx, func(ctx context.Context, msg *kafka.Message) error {
+		out, err := TransactionalWriter(ctx, "invoices")
+		if err != nil {
+			return err
+		}
+		if _, err := out.Write(ctx, msg.Key, msg.Value()); err != nil {
+			return err
+		}
+		// c fails once, after a and b were written: the whole transaction is aborted and redone.
+		if msg.Key == "c" && atomic.AddInt32(&failures, 1) == 1 {
+			return errors.New("boom")
+		}
+		return nil
+	}, Transactional("billing-0"))
+
+	if err := client.WaitFor(ctx, "invoices", 3); err != nil {
+		t.Fatal(err)
+	}
+	for ctx.Err() == nil && client.Committed("billing", "payments")[0] != 3 {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if ctx.Err() != nil {
+		t.Fatal("expected the payments to be committed")
+	}
+	if n := len(client.Messages("invoices")); n != 3 {
+		t.Errorf("expected each invoice once, got %d", n)
+	}
+	if atomic.LoadInt32(&failures) < 2 {
+		t.Error("expected c to be processed again after the abort")
+	}
+
+	if _, err := TransactionalWriter(ctx, "invoices"); err == nil {
+		t.Error("expected an error outside of a transactional run")
+	}
+}
+
+func Test_Work_TransactionalFailureAbortsWithoutStalling(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	client := kafka.NewMemoryClient()
+	w, _ := client.Writer(ctx, kafka.Config{Topic: "payments"})
+	for _, key := range []string{"a", "b"} {
+		_, _ = w.Write(ctx, key, []byte(key))
+	}
+
+	var failures int32
+	worker := NewFactory(client).Create(kafka.Config{Topic: "payments", GroupID: "billing"})
+	work := makeWork(worker, &runSettings{}, func(ctx context.Context, msg *kafka.Message) error {
+		if msg.Key == "b" && atomic.AddInt32(&failures, 1) == 1 {
+			return errors.New("boom")
+		}
+		return nil
+	})
+	tx, err := client.Transactor(ctx, work.kconfig, "billing-0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tx.Close()
+
+	committed := func() bool { return client.Committed("billing", "payments")[0] == 2 }
+	go func() { _ = work.transact(ctx, tx, committed) }()
+	for ctx.Err() == nil && !committed() {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if ctx.Err() != nil {
+		t.Fatal("expected the payments to be committed after the abort")
+	}
+	if n := work.inflight.stalledCount(); n != 0 {
+		t.Errorf("expected no stalled partitions in a transactional run, got %d", n)
+	}
+}
@@ -3,6 +3,7 @@ package worker
 import (
 	"context"
 	"fmt"
+	"runtime/debug"
 	"sync"
 	"time"
 
@@ -10,6 +11,7 @@ import (
 	"github.com/pkg/errors"
 	"github.com/sony/gobreaker"
 	"github.com/zillow/howwegoatzillow/libs/kafka"
+	"github.com/zillow/howwegoatzillow/libs/metrics"
 )
 
 type work struct {
@@ -18,11 +20,20 @@ type work struct {
 	processor      func(context.Context, *kafka.Message) error
 	logger         Logger
 	tracer         opentracing.Tracer
+	metrics        metrics.Metrics
 	rdrMtx         sync.RWMutex
 	reader         kafka.Reader
 	goroutinePool  chan struct{}
 	cb             *gobreaker.TwoStepCircuitBreaker
 	processTimeout time.Duration
+	retries        uint32
+	retryBackoff   time.Duration
+	dlqTopic       string
+	tier           int
+	retryTopic     string
+	retryDelay     time.Duration
+	stallBackoff   time.Duration
+	inflight       *inflight
 }
 
 func (w *work) Do(ctx context.Context) {
@@ -61,16 +72,21 @@ loop:
 		case w.goroutinePool <- struct{}{}:
 
 			msg, err := w.reader.Read(ctx)
-			if err != nil {
+			// A message returned with an error, e.g. a claim check that can't be fetched, fails without being processed.
+			if err != nil && msg == nil {
 				successFunc(false)
 				<-w.goroutinePool
 				return errors.Wrap(err, "failed to read from kafka topic")
 			}
-			go func(i *kafka.Message) {
-				err = w.doSingle(ctx, i)
+			w.metrics.Gauge(MetricInflight, float64(len(w.goroutinePool)), w.topicTag())
+			w.inflight.add(msg.Partition)
+			go func(i *kafka.Message, readErr error) {
+				err = w.doSingle(ctx, i, readErr)
 				successFunc(err == nil)
+				w.inflight.done(i.Partition)
 				<-w.goroutinePool
-			}(msg)
+				w.metrics.Gauge(MetricInflight, float64(len(w.goroutinePool)), w.topicTag())
+			}(msg, err)
 		default:
 			break loop
 		}
@@ -78,72 +94,165 @@ loop:
 	return nil
 }
 
-func (w *work) doSingle(ctx context.Context, msg *kafka.Message) (err error) {
+func (w *work) doSingle(ctx context.Context, msg *kafka.Message, readErr error) (err error) {
+	start := time.Now()
+	defer func() {
+		status := "ok"
+		if err != nil {
+			status = "error"
+		}
+		w.metrics.Count(MetricProcessed, 1, w.topicTag(), metrics.T("status", status))
+		w.metrics.Timing(MetricProcessLatency, time.Since(start), w.topicTag(), metrics.T("status", status))
+	}()
 	defer func() {
 		if r := recover(); r != nil {
 			//Panic for one message should not bring down the worker. Log and continue
+			err = newPanicError(r)
 			w.logger.Error(ctx, "kafka topic single message processing panicked",
 				"recover", r,
 				"msg", msg,
+				"stack", string(err.(*panicError).stack),
 			)
-			switch x := r.(type) {
-			case error:
-				err = x
-			default:
-				err = errors.New("kafka topic single message processing panicked")
-			}
 		}
 	}()
 
-	// send the done signal. Always do this.
-	// otherwise the message won't be committed
-	defer func() {
-		msg.Done()
-	}()
-
 	operationName := fmt.Sprintf("kafka.work.process.message.%s", w.kconfig.Topic)
 
 	sc, _ := w.tracer.Extract(opentracing.TextMap, &ReadAttributeCarrier{Message: msg})
 	span, ctxNew := opentracing.StartSpanFromContext(ctx, operationName, opentracing.ChildOf(sc))
-	ctxNew, cancel := context.WithTimeout(ctxNew, w.processTimeout)
-	defer cancel()
+	defer span.Finish()
+	if tc, ok := msg.TraceContext(); ok {
+		ctxNew = kafka.ContextWithTraceContext(ctxNew, tc)
+	}
 
-	err = func() error {
-		defer span.Finish()
-		errorCh := make(chan error, 1)
-		go func() {
-			defer func() {
-				if r := recover(); r != nil {
-					switch x := r.(type) {
-					case error:
-						errorCh <- x
-					default:
-						errorCh <- errors.New("kafka topic single message processing panicked")
-					}
-				}
-			}()
-			errorCh <- w.processor(ctxNew, msg)
-		}()
+	if w.tier > 0 {
+		if err := waitUntilDue(ctx, msg); err != nil {
+			return err
+		}
+	}
+
+	attempts := 0
+	for {
+		attempts++
+		// A message read with an error, e.g. a claim check the blob store failed to return, is fetched again.
+		if readErr != nil && attempts > 1 {
+			readErr = msg.Fetch(ctx)
+		}
+		if err = readErr; err == nil {
+			err = w.process(ctx, ctxNew, msg)
+		}
+		if err == nil {
+			// Only processed messages are marked done, the reader won't commit past one that failed.
+			msg.Done()
+			return
+		}
+
+		var decodeErr *kafka.DecodeError
+		if attempts > int(w.retries) || errors.As(err, &decodeErr) {
+			break
+		}
 		select {
-		case err2 := <-errorCh:
-			return err2
+		case <-time.After(w.retryBackoff):
 		case <-ctx.Done():
-			return errors.New("timeout occurred during kafka process")
+			return err
 		}
-	}()
-
-	if err == nil {
-		return
 	}
 
-	// In case of error, we don't mark it done. It will come back or eventually go to the dead letter queue
 	w.logger.Error(ctx, "kafka topic single message processing failed",
 		"error", err,
+		"attempts", attempts,
 		"msg", msg,
 	)
+
+	var forwardErr error
+	switch {
+	case w.retryTopic != "":
+		forwardErr = w.retry(ctxNew, msg)
+	case w.dlqTopic != "":
+		forwardErr = w.deadLetter(ctxNew, msg, err, attempts)
+	default:
+		// Without retry or dead letter topics we don't mark it done. A transactional run aborts and polls it
+		// again, otherwise it is processed again after the stall backoff.
+		if _, transactional := ctx.Value(transactorKey{}).(kafka.Transactor); !transactional {
+			w.stall(ctx, msg, readErr)
+		}
+		return err
+	}
+	if forwardErr != nil {
+		w.logger.Error(ctx, "kafka topic single message forwarding failed",
+			"error", forwardErr,
+			"msg", msg,
+		)
+		return err
+	}
+	msg.Done()
 	return err
 }
 
+// stall stops reading the partition of msg, which failed and wasn't marked done, and processes msg again
+// every stall backoff until it is done. A message that fails again is already being redelivered.
+func (w *work) stall(ctx context.Context, msg *kafka.Message, readErr error) {
+	if !w.inflight.stall(msg.Partition, msg.Offset) {
+		return
+	}
+	w.metrics.Gauge(MetricStalledPartitions, float64(w.inflight.stalledCount()), w.topicTag())
+	w.logger.Error(ctx, "kafka partition commit stalled, pausing the partition until the message is processed",
+		"topic", msg.Topic,
+		"partition", msg.Partition,
+		"offset", msg.Offset,
+		"retryIn", w.stallBackoff,
+	)
+	go w.redeliver(ctx, msg, readErr)
+}
+
+// redeliver processes msg again every stall backoff, resuming its partition once it is done. It stops when the
+// partition no longer waits for msg, it is read again from the committed offset after a rebalance or rewind.
+func (w *work) redeliver(ctx context.Context, msg *kafka.Message, readErr error) {
+	for {
+		sleep(ctx, w.stallBackoff)
+		if ctx.Err() != nil || !w.inflight.redeliver(msg.Partition, msg.Offset) {
+			return
+		}
+		// A message read with an error has to be fetched again first, see doSingle.
+		if readErr != nil {
+			readErr = msg.Fetch(ctx)
+		}
+		err := w.doSingle(ctx, msg, readErr)
+		if err == nil {
+			w.inflight.unstall(msg.Partition, msg.Offset)
+			w.metrics.Gauge(MetricStalledPartitions, float64(w.inflight.stalledCount()), w.topicTag())
+		}
+		w.inflight.done(msg.Partition)
+		if err == nil {
+			return
+		}
+	}
+}
+
+func (w *work) topicTag() metrics.Tag { return metrics.T("topic", w.kconfig.Topic) }
+
+// process runs the processor once, bounded by processTimeout.
+func (w *work) process(ctx, ctxNew context.Context, msg *kafka.Message) error {
+	ctxNew, cancel := context.WithTimeout(ctxNew, w.processTimeout)
+	defer cancel()
+
+	errorCh := make(chan error, 1)
+	go func() {
+		defer func() {
+			if r := recover(); r != nil {
+				errorCh <- newPanicError(r)
+			}
+		}()
+		errorCh <- w.processor(ctxNew, msg)
+	}()
+	select {
+	case err := <-errorCh:
+		return err
+	case <-ctx.Done():
+		return errors.New("timeout occurred during kafka process")
+	}
+}
+
 func (w *work) ensureReader(ctx context.Context) error {
 
 	w.rdrMtx.RLock()
@@ -156,7 +265,24 @@ func (w *work) ensureReader(ctx context.Context) error {
 	w.rdrMtx.Lock()
 	defer w.rdrMtx.Unlock()
 
-	rdr, err := w.kclient.Reader(ctx, w.kconfig)
+	// Before the partitions go to another consumer, finish what is in flight so it gets committed.
+	cfg := w.kconfig
+	cfg.OnPartitionsRevoked = func(ctx context.Context, partitions []int32) {
+		waitCtx, cancel := context.WithTimeout(ctx, revokeTimeout)
+		defer cancel()
+		if err := w.inflight.wait(waitCtx, partitions); err != nil {
+			w.logger.Error(ctx, "kafka partitions revoked with messages in flight",
+				"error", err,
+				"partitions", partitions)
+		}
+		w.inflight.revoke(partitions)
+		w.metrics.Gauge(MetricStalledPartitions, float64(w.inflight.stalledCount()), w.topicTag())
+		if fn := w.kconfig.OnPartitionsRevoked; fn != nil {
+			fn(ctx, partitions)
+		}
+	}
+
+	rdr, err := w.kclient.Reader(ctx, cfg)
 	if err != nil {
 		return err
 	}
@@ -166,17 +292,109 @@ func (w *work) ensureReader(ctx context.Context) error {
 	}
 
 	w.reader = rdr
+	w.inflight.setReader(rdr)
+
+	return nil
+}
 
+// rewind seeks the reader.
+func (w *work) rewind(ctx context.Context, to kafka.Position) error {
+	w.rdrMtx.RLock()
+	defer w.rdrMtx.RUnlock()
+	if w.reader == nil {
+		return errors.New("worker has no kafka reader yet")
+	}
+	if err := w.reader.Seek(ctx, to); err != nil {
+		return err
+	}
+	// The messages partitions stalled on are read again.
+	w.inflight.revokeAll()
 	return nil
 }
 
+// Close waits for in flight messages and releases the reader, committing what has been processed so far.
+func (w *work) Close(ctx context.Context) {
+	for i := 0; i < cap(w.goroutinePool); i++ {
+		w.goroutinePool <- struct{}{}
+	}
+	defer func() {
+		for i := 0; i < cap(w.goroutinePool); i++ {
+			<-w.goroutinePool
+		}
+	}()
+
+	w.rdrMtx.Lock()
+	defer w.rdrMtx.Unlock()
+
+	if w.reader == nil {
+		return
+	}
+
+	if err := w.reader.Close(); err != nil {
+		w.logger.Error(ctx, "failed to close kafka reader",
+			"error", err,
+			"cfg", w.kconfig)
+	}
+	w.reader = nil
+}
+
+// panicError is a processor panic, with the recovered value and the stack it panicked on.
+type panicError struct {
+	value interface{}
+	stack []byte
+}
+
+// newPanicError must be called in the deferred function that recovered, for the stack to be the panic's.
+func newPanicError(value interface{}) error {
+	return &panicError{value: value, stack: debug.Stack()}
+}
+
+func (e *panicError) Error() string {
+	return fmt.Sprintf("kafka topic single message processing panicked: %v", e.value)
+}
+
+// Unwrap returns the recovered value if it is an error.
+func (e *panicError) Unwrap() error {
+	err, _ := e.value.(error)
+	return err
+}
+
+// stackOf returns the stack trace err was raised on: a panic's stack, or the stack github.com/pkg/errors
+// recorded. It returns "" for errors that carry no stack.
+func stackOf(err error) string {
+	var p *panicError
+	if errors.As(err, &p) {
+		return fmt.Sprintf("panic: %v\n\n%s", p.value, p.stack)
+	}
+	var st interface{ StackTrace() errors.StackTrace }
+	if errors.As(err, &st) {
+		return fmt.Sprintf("%+v", err)
+	}
+	return ""
+}
+
 type ReadAttributeCarrier struct{ Message *kafka.Message }
 
 // ForeachKey conforms to the opentracing TextMapReader interface.
+// Messages from producers that only speak W3C trace context also get the trace in the formats
+// opentracing tracers extract, so the trace continues instead of a new one starting.
 func (c *ReadAttributeCarrier) ForeachKey(handler func(key, val string) error) error {
-	for k, v := range c.Message.Headers {
-		val := str(v)
-		if err := handler(k, val); err != nil {
+	for _, h := range c.Message.Headers {
+		val := str(h.Value)
+		if err := handler(h.Key, val); err != nil {
+			return err
+		}
+	}
+
+	tc, ok := c.Message.TraceContext()
+	if !ok {
+		return nil
+	}
+	for k, v := range tc.CompatHeaders() {
+		if _, exists := c.Message.Headers.Lookup(k); exists {
+			continue
+		}
+		if err := handler(k, v); err != nil {
 			return err
 		}
 	}
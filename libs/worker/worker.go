@@ -2,6 +2,7 @@ package worker
 
 import (
 	"context"
+	"net/http"
 	"os"
 	"os/signal"
 	"sync"
@@ -9,18 +10,40 @@ import (
 	"time"
 
 	"github.com/opentracing/opentracing-go"
+	"github.com/pkg/errors"
 	"github.com/sony/gobreaker"
 	"github.com/zillow/howwegoatzillow/libs/kafka"
+	"github.com/zillow/howwegoatzillow/libs/metrics"
+)
+
+// Metrics reported through WithMetrics.
+const (
+	MetricProcessed           = "worker.messages.processed"
+	MetricProcessLatency      = "worker.process.latency"
+	MetricInflight            = "worker.inflight"
+	MetricCircuitBreakerState = "worker.circuit_breaker.state" // 0 closed, 1 half open, 2 open
+	// MetricStalledPartitions counts partitions paused because a message failed without a retry or dead
+	// letter topic to send it to, so their offsets can't be committed past it. The message is processed
+	// again every WithStallBackoff, a partition that stays stalled needs its message fixed or skipped.
+	MetricStalledPartitions = "worker.commit.stalled_partitions"
 )
 
 type Worker struct {
 	client    kafka.Client
+	admin     kafka.Admin
 	config    kafka.Config
 	logger    Logger
 	tracer    opentracing.Tracer
+	metrics   metrics.Metrics
 	wrapup    bool
 	wrapupMtx sync.RWMutex
+	workMtx   sync.RWMutex
 	work      *work
+
+	retryDelays []time.Duration
+	// sourceTopic and tier are set on the workers of retry topics, tier counting from 1.
+	sourceTopic string
+	tier        int
 }
 
 func (w *Worker) Run(ctx context.Context, processor func(context.Context, *kafka.Message) error, options ...RunOption) {
@@ -39,12 +62,14 @@ func (w *Worker) Run(ctx context.Context, processor func(context.Context, *kafka
 	if w.logger == nil {
 		w.logger = NoopLogger{}
 	}
+	w.metrics = metrics.OrNoop(w.metrics)
 
 	settings := &runSettings{
 		wrapupDuration:    1 * time.Second,
 		cbAfter:           5,
 		cbFor:             10 * time.Second,
 		concurrencyFactor: 1,
+		stallBackoff:      defaultStallBackoff,
 	}
 
 	for _, option := range options {
@@ -53,6 +78,10 @@ func (w *Worker) Run(ctx context.Context, processor func(context.Context, *kafka
 		}
 	}
 
+	// The retry topics' workers stop with ctx, Run returns once they did. Deferred before cancel, it runs after.
+	var retryWorkers sync.WaitGroup
+	defer retryWorkers.Wait()
+
 	ctx, cancel := context.WithCancel(ctx)
 	defer cancel()
 	stopCh := make(chan os.Signal, 1)
@@ -67,7 +96,31 @@ func (w *Worker) Run(ctx context.Context, processor func(context.Context, *kafka
 		cancel()
 	}()
 
-	w.work = makeWork(w, settings, processor)
+	work := makeWork(w, settings, processor)
+	w.setWork(work)
+	defer w.setWork(nil)
+	defer work.Close(ctx)
+
+	if settings.transactionalID != "" {
+		w.runTransactional(ctx, work, settings.transactionalID)
+		return
+	}
+
+	if w.tier == 0 && len(w.retryDelays) > 0 {
+		if err := w.ensureRetryTopics(ctx); err != nil {
+			w.logger.Error(ctx, "failed to create kafka retry topics",
+				"error", err,
+				"cfg", w.config)
+			return
+		}
+		for tier := 1; tier <= len(w.retryDelays); tier++ {
+			retryWorkers.Add(1)
+			go func(tier int) {
+				defer retryWorkers.Done()
+				w.retryWorker(tier).Run(ctx, processor, options...)
+			}(tier)
+		}
+	}
 
 	for {
 		select {
@@ -91,21 +144,49 @@ func makeWork(w *Worker, settings *runSettings, processor func(context.Context,
 	if settings.cbAfter > 0 {
 		cbSetting.ReadyToTrip = func(c gobreaker.Counts) bool { return c.ConsecutiveFailures >= settings.cbAfter }
 	}
+	cbSetting.OnStateChange = func(_ string, _, to gobreaker.State) {
+		w.metrics.Gauge(MetricCircuitBreakerState, float64(to), metrics.T("topic", w.config.Topic))
+	}
 
 	poolSize := 1
 	if settings.concurrencyFactor > 0 {
 		poolSize = int(settings.concurrencyFactor)
 	}
 
+	var retryTopic string
+	var retryDelay time.Duration
+	if w.tier < len(w.retryDelays) && settings.transactionalID == "" {
+		topic := w.config.Topic
+		if w.sourceTopic != "" {
+			topic = w.sourceTopic
+		}
+		retryDelay = w.retryDelays[w.tier]
+		retryTopic = RetryTopic(topic, retryDelay)
+	}
+
+	kconfig := w.config
+	if w.tier == 0 && settings.startFrom != nil {
+		kconfig.StartFrom = settings.startFrom
+	}
+
 	return &work{
-		kconfig:        w.config,
+		kconfig:        kconfig,
 		kclient:        w.client,
 		logger:         w.logger,
 		tracer:         w.tracer,
-		processor:      processor,
+		metrics:        w.metrics,
+		processor:      Chain(processor, settings.middlewares...),
 		processTimeout: 1 * time.Minute,
+		retries:        settings.retries,
+		retryBackoff:   settings.retryBackoff,
+		dlqTopic:       settings.dlqTopic,
+		tier:           w.tier,
+		retryTopic:     retryTopic,
+		retryDelay:     retryDelay,
+		stallBackoff:   settings.stallBackoff,
 		cb:             gobreaker.NewTwoStepCircuitBreaker(cbSetting),
 		goroutinePool:  make(chan struct{}, poolSize),
+		inflight:       newInflight(settings.maxInflightPerPartition),
 	}
 }
 
@@ -124,6 +205,48 @@ func (w *Worker) runSingle(ctx context.Context) {
 
 }
 
+// Rewind moves the running worker to the position on the partitions it is assigned and commits it,
+// e.g. kafka.AtTime to reprocess the last hours after a bad deploy. Each instance of a consumer group
+// only rewinds its own partitions, so rewind every instance, e.g. with kafkactl groups rewind calling
+// each member's RewindHandler, or stop the group and use Admin.ResetGroupOffsets. Retry topics are not rewound.
+func (w *Worker) Rewind(ctx context.Context, to kafka.Position) error {
+	w.workMtx.RLock()
+	work := w.work
+	w.workMtx.RUnlock()
+	if work == nil {
+		return errors.New("worker is not running")
+	}
+	return work.rewind(ctx, to)
+}
+
+// RewindHandler serves POST requests rewinding the worker to the position in the "to" query parameter,
+// anything kafka.ParsePosition accepts, e.g. POST /admin/rewind?to=6h. Mount it on an admin route.
+func (w *Worker) RewindHandler() http.HandlerFunc {
+	return func(rw http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(rw, "rewind must be a POST", http.StatusMethodNotAllowed)
+			return
+		}
+		to, err := kafka.ParsePosition(r.URL.Query().Get("to"))
+		if err != nil {
+			http.Error(rw, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err := w.Rewind(r.Context(), to); err != nil {
+			w.logger.Error(r.Context(), "failed to rewind worker", "error", err, "topic", w.config.Topic)
+			http.Error(rw, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		rw.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func (w *Worker) setWork(work *work) {
+	w.workMtx.Lock()
+	defer w.workMtx.Unlock()
+	w.work = work
+}
+
 func (w *Worker) setWrappingUp() {
 	w.wrapupMtx.Lock()
 	defer w.wrapupMtx.Unlock()
@@ -143,4 +266,16 @@ type runSettings struct {
 	cbAfter           uint32
 	cbFor             time.Duration
 	concurrencyFactor byte
+
+	retries      uint32
+	retryBackoff time.Duration
+	dlqTopic     string
+
+	middlewares []Middleware
+	startFrom   *kafka.Position
+
+	maxInflightPerPartition int
+	stallBackoff            time.Duration
+
+	transactionalID string
 }
@@ -0,0 +1,301 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/zillow/howwegoatzillow/libs/kafka"
+)
+
+func Test_Worker_ProcessesAndCommitsWithMemoryClient(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	client := kafka.NewMemoryClient(kafka.WithPartitions(2))
+	w, _ := client.Writer(ctx, kafka.Config{Topic: "listings"})
+	for _, key := range []string{"a", "b", "c"} {
+		_, _ = w.Write(ctx, key, []byte(key))
+	}
+
+	var mtx sync.Mutex
+	seen := map[string]bool{}
+	done := make(chan struct{})
+
+	worker := NewFactory(client).Create(kafka.Config{Topic: "listings", GroupID: "g"})
+	go worker.Run(ctx, func(ctx context.Context, msg *kafka.Message) error {
+		mtx.Lock()
+		defer mtx.Unlock()
+		seen[msg.Key] = true
+		if len(seen) == 3 {
+			close(done)
+		}
+		return nil
+	}, Speedup(2))
+
+	select {
+	case <-done:
+	case <-ctx.Done():
+		t.Fatal("worker did not process all messages")
+	}
+
+	for ctx.Err() == nil {
+		committed := client.Committed("g", "listings")
+		if committed[0]+committed[1] == 3 {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Error("worker did not commit all messages")
+}
+
+func Test_Worker_FailedMessageHoldsCommit(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	client := kafka.NewMemoryClient()
+	w, _ := client.Writer(ctx, kafka.Config{Topic: "listings"})
+	for _, key := range []string{"a", "b", "c"} {
+		_, _ = w.Write(ctx, key, []byte(key))
+	}
+
+	var mtx sync.Mutex
+	seen := map[string]bool{}
+	done := make(chan struct{})
+
+	worker := NewFactory(client).Create(kafka.Config{Topic: "listings", GroupID: "g"})
+	go worker.Run(ctx, func(ctx context.Context, msg *kafka.Message) error {
+		mtx.Lock()
+		defer mtx.Unlock()
+		seen[msg.Key] = true
+		if len(seen) == 3 {
+			close(done)
+		}
+		if msg.Key == "b" {
+			return errors.New("failed")
+		}
+		return nil
+	}, Speedup(3))
+
+	select {
+	case <-done:
+	case <-ctx.Done():
+		t.Fatal("worker did not process all messages")
+	}
+
+	time.Sleep(50 * time.Millisecond)
+	if got := client.Committed("g", "listings")[0]; got != 1 {
+		t.Errorf("expected commit to stop before the failed message at 1, got %d", got)
+	}
+}
+
+func Test_Worker_StartFromAndRewind(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	client := kafka.NewMemoryClient()
+	w, _ := client.Writer(ctx, kafka.Config{Topic: "listings"})
+	_, _ = w.Write(ctx, "old", []byte("old"))
+
+	seen := make(chan string, 10)
+	worker := NewFactory(client).Create(kafka.Config{Topic: "listings", GroupID: "g"})
+	go worker.Run(ctx, func(ctx context.Context, msg *kafka.Message) error {
+		seen <- msg.Key
+		return nil
+	}, StartFrom(kafka.Latest))
+
+	// The reader is created on the first read, writes before that are skipped too.
+	for ctx.Err() == nil && worker.Rewind(ctx, kafka.Latest) != nil {
+		time.Sleep(10 * time.Millisecond)
+	}
+	_, _ = w.Write(ctx, "new", []byte("new"))
+	if got := <-seen; got != "new" {
+		t.Fatalf("expected to start from the latest message, got %s", got)
+	}
+
+	rec := httptest.NewRecorder()
+	worker.RewindHandler()(rec, httptest.NewRequest(http.MethodPost, "/admin/rewind?to=earliest", nil))
+	if rec.Code != http.StatusNoContent {
+		t.Fatalf("expected the rewind to succeed, got %d %s", rec.Code, rec.Body)
+	}
+	if got := <-seen; got != "old" {
+		t.Errorf("expected to reprocess from the earliest message, got %s", got)
+	}
+
+	rec = httptest.NewRecorder()
+	worker.RewindHandler()(rec, httptest.NewRequest(http.MethodPost, "/admin/rewind?to=someday", nil))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("expected a bad request for an unknown position, got %d", rec.Code)
+	}
+}
+
+func Test_ReadAttributeCarrier_TranslatesTraceparent(t *testing.T) {
+	msg := &kafka.Message{Headers: kafka.Headers{
+		{Key: kafka.TraceparentHeader, Value: []byte("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")},
+	}}
+
+	got := map[string]string{}
+	_ = (&ReadAttributeCarrier{Message: msg}).ForeachKey(func(k, v string) error {
+		got[k] = v
+		return nil
+	})
+
+	if got["x-b3-traceid"] != "4bf92f3577b34da6a3ce929d0e0e4736" {
+		t.Errorf("unexpected b3 trace id %q", got["x-b3-traceid"])
+	}
+	if got["x-datadog-parent-id"] != "67667974448284343" {
+		t.Errorf("unexpected datadog parent id %q", got["x-datadog-parent-id"])
+	}
+}
+
+func Test_Worker_StallsPartitionOnFailure(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	client := kafka.NewMemoryClient(kafka.WithPartitions(2))
+	w, _ := client.Writer(ctx, kafka.Config{Topic: "listings", CustomPartitioner: slowFirstPartitioner{}})
+	for _, key := range []string{"slow-1", "slow-2", "slow-3", "a", "b", "c"} {
+		_, _ = w.Write(ctx, key, []byte(key))
+	}
+
+	var mtx sync.Mutex
+	seen := map[string]bool{}
+
+	worker := NewFactory(client).Create(kafka.Config{Topic: "listings", GroupID: "g"})
+	go worker.Run(ctx, func(ctx context.Context, msg *kafka.Message) error {
+		mtx.Lock()
+		defer mtx.Unlock()
+		seen[msg.Key] = true
+		if msg.Partition == 0 {
+			return errors.New("failed")
+		}
+		return nil
+	})
+
+	for ctx.Err() == nil {
+		if client.Committed("g", "listings")[1] == 3 {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if ctx.Err() != nil {
+		t.Fatal("worker did not commit the healthy partition")
+	}
+
+	time.Sleep(50 * time.Millisecond)
+	mtx.Lock()
+	defer mtx.Unlock()
+	if !seen["slow-1"] || seen["slow-2"] || seen["slow-3"] {
+		t.Errorf("expected the failed partition to be paused after its first message, processed %v", seen)
+	}
+	if got := client.Committed("g", "listings")[0]; got != 0 {
+		t.Errorf("expected no commit on the failed partition, got %d", got)
+	}
+}
+
+func Test_Worker_RedeliversStalledMessage(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	client := kafka.NewMemoryClient()
+	w, _ := client.Writer(ctx, kafka.Config{Topic: "listings"})
+	for _, key := range []string{"a", "b", "c"} {
+		_, _ = w.Write(ctx, key, []byte(key))
+	}
+
+	var failures int32
+	worker := NewFactory(client).Create(kafka.Config{Topic: "listings", GroupID: "g"})
+	go worker.Run(ctx, func(ctx context.Context, msg *kafka.Message) error {
+		// a fails once, nothing rebalances the single member, the stall backoff has to bring it back.
+		if msg.Key == "a" && atomic.AddInt32(&failures, 1) == 1 {
+			return errors.New("failed")
+		}
+		return nil
+	}, WithStallBackoff(20*time.Millisecond))
+
+	for ctx.Err() == nil && client.Committed("g", "listings")[0] != 3 {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if ctx.Err() != nil {
+		t.Fatal("expected the stalled partition to resume and commit everything")
+	}
+	if got := atomic.LoadInt32(&failures); got != 2 {
+		t.Errorf("expected a to be processed twice, got %d", got)
+	}
+}
+
+// slowFirstPartitioner puts keys starting with slow on partition 0, the rest on partition 1.
+type slowFirstPartitioner struct{}
+
+func (slowFirstPartitioner) Partition(key []byte, _ int) int {
+	if strings.HasPrefix(string(key), "slow") {
+		return 0
+	}
+	return 1
+}
+
+func Test_Worker_MaxInflightPerPartition(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	client := kafka.NewMemoryClient(kafka.WithPartitions(2))
+	w, _ := client.Writer(ctx, kafka.Config{Topic: "listings", CustomPartitioner: slowFirstPartitioner{}})
+	for _, key := range []string{"slow-1", "slow-2", "slow-3", "a", "b", "c"} {
+		_, _ = w.Write(ctx, key, []byte(key))
+	}
+
+	var mtx sync.Mutex
+	slow, maxSlow, fast := 0, 0, 0
+	release := make(chan struct{})
+	fastDone := make(chan struct{})
+
+	worker := NewFactory(client).Create(kafka.Config{Topic: "listings", GroupID: "g"})
+	go worker.Run(ctx, func(ctx context.Context, msg *kafka.Message) error {
+		if msg.Partition == 1 {
+			mtx.Lock()
+			defer mtx.Unlock()
+			if fast++; fast == 3 {
+				close(fastDone)
+			}
+			return nil
+		}
+		mtx.Lock()
+		slow++
+		maxSlow = max(maxSlow, slow)
+		mtx.Unlock()
+		<-release
+		mtx.Lock()
+		slow--
+		mtx.Unlock()
+		return nil
+	}, Speedup(3), WithMaxInflightPerPartition(1))
+
+	// The slow partition holds one goroutine, the other two keep the fast partition going.
+	select {
+	case <-fastDone:
+	case <-ctx.Done():
+		t.Fatal("the slow partition held up the other partition")
+	}
+	close(release)
+
+	for ctx.Err() == nil {
+		if committed := client.Committed("g", "listings"); committed[0] == 3 && committed[1] == 3 {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if ctx.Err() != nil {
+		t.Fatal("worker did not commit all messages")
+	}
+	mtx.Lock()
+	defer mtx.Unlock()
+	if maxSlow != 1 {
+		t.Errorf("expected one slow message in flight at a time, got %d", maxSlow)
+	}
+}
@@ -88,6 +88,64 @@ func (m *MockReader) EXPECT() *MockReaderMockRecorder {
 	return m.recorder
 }
 
+// Assignment mocks base method.
+func (m *MockReader) Assignment() []int32 {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Assignment")
+	ret0, _ := ret[0].([]int32)
+	return ret0
+}
+
+// Assignment indicates an expected call of Assignment.
+func (mr *MockReaderMockRecorder) Assignment() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Assignment", reflect.TypeOf((*MockReader)(nil).Assignment))
+}
+
+// Close mocks base method.
+func (m *MockReader) Close() error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Close")
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Close indicates an expected call of Close.
+func (mr *MockReaderMockRecorder) Close() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Close", reflect.TypeOf((*MockReader)(nil).Close))
+}
+
+// Commit mocks base method.
+func (m *MockReader) Commit(ctx context.Context) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Commit", ctx)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Commit indicates an expected call of Commit.
+func (mr *MockReaderMockRecorder) Commit(ctx interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Commit", reflect.TypeOf((*MockReader)(nil).Commit), ctx)
+}
+
+// Pause mocks base method.
+func (m *MockReader) Pause(partitions ...int32) {
+	m.ctrl.T.Helper()
+	varargs := []interface{}{}
+	for _, a := range partitions {
+		varargs = append(varargs, a)
+	}
+	m.ctrl.Call(m, "Pause", varargs...)
+}
+
+// Pause indicates an expected call of Pause.
+func (mr *MockReaderMockRecorder) Pause(partitions ...interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Pause", reflect.TypeOf((*MockReader)(nil).Pause), partitions...)
+}
+
 // Read mocks base method.
 func (m *MockReader) Read(ctx context.Context) (*kafka.Message, error) {
 	m.ctrl.T.Helper()
@@ -103,6 +161,36 @@ func (mr *MockReaderMockRecorder) Read(ctx interface{}) *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Read", reflect.TypeOf((*MockReader)(nil).Read), ctx)
 }
 
+// Resume mocks base method.
+func (m *MockReader) Resume(partitions ...int32) {
+	m.ctrl.T.Helper()
+	varargs := []interface{}{}
+	for _, a := range partitions {
+		varargs = append(varargs, a)
+	}
+	m.ctrl.Call(m, "Resume", varargs...)
+}
+
+// Resume indicates an expected call of Resume.
+func (mr *MockReaderMockRecorder) Resume(partitions ...interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Resume", reflect.TypeOf((*MockReader)(nil).Resume), partitions...)
+}
+
+// Seek mocks base method.
+func (m *MockReader) Seek(ctx context.Context, to kafka.Position) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Seek", ctx, to)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Seek indicates an expected call of Seek.
+func (mr *MockReaderMockRecorder) Seek(ctx, to interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Seek", reflect.TypeOf((*MockReader)(nil).Seek), ctx, to)
+}
+
 // MockWriter is a mock of Writer interface.
 type MockWriter struct {
 	ctrl     *gomock.Controller
@@ -126,19 +214,415 @@ func (m *MockWriter) EXPECT() *MockWriterMockRecorder {
 	return m.recorder
 }
 
+// Flush mocks base method.
+func (m *MockWriter) Flush(ctx context.Context) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Flush", ctx)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Flush indicates an expected call of Flush.
+func (mr *MockWriterMockRecorder) Flush(ctx interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Flush", reflect.TypeOf((*MockWriter)(nil).Flush), ctx)
+}
+
 // Write mocks base method.
-func (m *MockWriter) Write(ctx context.Context, key string, value []byte) (kafka.Response, error) {
+func (m *MockWriter) Write(ctx context.Context, key string, value []byte, options ...kafka.WriteOption) (kafka.Response, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "Write", ctx, key, value)
+	varargs := []interface{}{ctx, key, value}
+	for _, a := range options {
+		varargs = append(varargs, a)
+	}
+	ret := m.ctrl.Call(m, "Write", varargs...)
 	ret0, _ := ret[0].(kafka.Response)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // Write indicates an expected call of Write.
-func (mr *MockWriterMockRecorder) Write(ctx, key, value interface{}) *gomock.Call {
+func (mr *MockWriterMockRecorder) Write(ctx, key, value interface{}, options ...interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	varargs := append([]interface{}{ctx, key, value}, options...)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Write", reflect.TypeOf((*MockWriter)(nil).Write), varargs...)
+}
+
+// WriteAsync mocks base method.
+func (m *MockWriter) WriteAsync(ctx context.Context, record kafka.Record, onDelivery func(kafka.Delivery)) {
+	m.ctrl.T.Helper()
+	m.ctrl.Call(m, "WriteAsync", ctx, record, onDelivery)
+}
+
+// WriteAsync indicates an expected call of WriteAsync.
+func (mr *MockWriterMockRecorder) WriteAsync(ctx, record, onDelivery interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "WriteAsync", reflect.TypeOf((*MockWriter)(nil).WriteAsync), ctx, record, onDelivery)
+}
+
+// WriteBatch mocks base method.
+func (m *MockWriter) WriteBatch(ctx context.Context, records []kafka.Record) ([]kafka.Response, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "WriteBatch", ctx, records)
+	ret0, _ := ret[0].([]kafka.Response)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// WriteBatch indicates an expected call of WriteBatch.
+func (mr *MockWriterMockRecorder) WriteBatch(ctx, records interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "WriteBatch", reflect.TypeOf((*MockWriter)(nil).WriteBatch), ctx, records)
+}
+
+// MockTransactionalClient is a mock of TransactionalClient interface.
+type MockTransactionalClient struct {
+	ctrl     *gomock.Controller
+	recorder *MockTransactionalClientMockRecorder
+}
+
+// MockTransactionalClientMockRecorder is the mock recorder for MockTransactionalClient.
+type MockTransactionalClientMockRecorder struct {
+	mock *MockTransactionalClient
+}
+
+// NewMockTransactionalClient creates a new mock instance.
+func NewMockTransactionalClient(ctrl *gomock.Controller) *MockTransactionalClient {
+	mock := &MockTransactionalClient{ctrl: ctrl}
+	mock.recorder = &MockTransactionalClientMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockTransactionalClient) EXPECT() *MockTransactionalClientMockRecorder {
+	return m.recorder
+}
+
+// Reader mocks base method.
+func (m *MockTransactionalClient) Reader(ctx context.Context, topicConfig kafka.Config) (kafka.Reader, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Reader", ctx, topicConfig)
+	ret0, _ := ret[0].(kafka.Reader)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Reader indicates an expected call of Reader.
+func (mr *MockTransactionalClientMockRecorder) Reader(ctx, topicConfig interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Reader", reflect.TypeOf((*MockTransactionalClient)(nil).Reader), ctx, topicConfig)
+}
+
+// Transactor mocks base method.
+func (m *MockTransactionalClient) Transactor(ctx context.Context, topicConfig kafka.Config, transactionalID string) (kafka.Transactor, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Transactor", ctx, topicConfig, transactionalID)
+	ret0, _ := ret[0].(kafka.Transactor)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Transactor indicates an expected call of Transactor.
+func (mr *MockTransactionalClientMockRecorder) Transactor(ctx, topicConfig, transactionalID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Transactor", reflect.TypeOf((*MockTransactionalClient)(nil).Transactor), ctx, topicConfig, transactionalID)
+}
+
+// Writer mocks base method.
+func (m *MockTransactionalClient) Writer(ctx context.Context, topicConfig kafka.Config) (kafka.Writer, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Writer", ctx, topicConfig)
+	ret0, _ := ret[0].(kafka.Writer)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Writer indicates an expected call of Writer.
+func (mr *MockTransactionalClientMockRecorder) Writer(ctx, topicConfig interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Writer", reflect.TypeOf((*MockTransactionalClient)(nil).Writer), ctx, topicConfig)
+}
+
+// MockTransactor is a mock of Transactor interface.
+type MockTransactor struct {
+	ctrl     *gomock.Controller
+	recorder *MockTransactorMockRecorder
+}
+
+// MockTransactorMockRecorder is the mock recorder for MockTransactor.
+type MockTransactorMockRecorder struct {
+	mock *MockTransactor
+}
+
+// NewMockTransactor creates a new mock instance.
+func NewMockTransactor(ctrl *gomock.Controller) *MockTransactor {
+	mock := &MockTransactor{ctrl: ctrl}
+	mock.recorder = &MockTransactorMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockTransactor) EXPECT() *MockTransactorMockRecorder {
+	return m.recorder
+}
+
+// Abort mocks base method.
+func (m *MockTransactor) Abort(ctx context.Context) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Abort", ctx)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Abort indicates an expected call of Abort.
+func (mr *MockTransactorMockRecorder) Abort(ctx interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Abort", reflect.TypeOf((*MockTransactor)(nil).Abort), ctx)
+}
+
+// Close mocks base method.
+func (m *MockTransactor) Close() error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Close")
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Close indicates an expected call of Close.
+func (mr *MockTransactorMockRecorder) Close() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Close", reflect.TypeOf((*MockTransactor)(nil).Close))
+}
+
+// Commit mocks base method.
+func (m *MockTransactor) Commit(ctx context.Context) (bool, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Commit", ctx)
+	ret0, _ := ret[0].(bool)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Commit indicates an expected call of Commit.
+func (mr *MockTransactorMockRecorder) Commit(ctx interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Commit", reflect.TypeOf((*MockTransactor)(nil).Commit), ctx)
+}
+
+// Poll mocks base method.
+func (m *MockTransactor) Poll(ctx context.Context) ([]*kafka.Message, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Poll", ctx)
+	ret0, _ := ret[0].([]*kafka.Message)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Poll indicates an expected call of Poll.
+func (mr *MockTransactorMockRecorder) Poll(ctx interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Poll", reflect.TypeOf((*MockTransactor)(nil).Poll), ctx)
+}
+
+// Writer mocks base method.
+func (m *MockTransactor) Writer(topic string) kafka.Writer {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Writer", topic)
+	ret0, _ := ret[0].(kafka.Writer)
+	return ret0
+}
+
+// Writer indicates an expected call of Writer.
+func (mr *MockTransactorMockRecorder) Writer(topic interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Writer", reflect.TypeOf((*MockTransactor)(nil).Writer), topic)
+}
+
+// MockAdmin is a mock of Admin interface.
+type MockAdmin struct {
+	ctrl     *gomock.Controller
+	recorder *MockAdminMockRecorder
+}
+
+// MockAdminMockRecorder is the mock recorder for MockAdmin.
+type MockAdminMockRecorder struct {
+	mock *MockAdmin
+}
+
+// NewMockAdmin creates a new mock instance.
+func NewMockAdmin(ctrl *gomock.Controller) *MockAdmin {
+	mock := &MockAdmin{ctrl: ctrl}
+	mock.recorder = &MockAdminMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockAdmin) EXPECT() *MockAdminMockRecorder {
+	return m.recorder
+}
+
+// AlterTopicConfig mocks base method.
+func (m *MockAdmin) AlterTopicConfig(ctx context.Context, topic string, configs map[string]string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "AlterTopicConfig", ctx, topic, configs)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// AlterTopicConfig indicates an expected call of AlterTopicConfig.
+func (mr *MockAdminMockRecorder) AlterTopicConfig(ctx, topic, configs interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AlterTopicConfig", reflect.TypeOf((*MockAdmin)(nil).AlterTopicConfig), ctx, topic, configs)
+}
+
+// CreateTopic mocks base method.
+func (m *MockAdmin) CreateTopic(ctx context.Context, spec kafka.TopicSpec) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CreateTopic", ctx, spec)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// CreateTopic indicates an expected call of CreateTopic.
+func (mr *MockAdminMockRecorder) CreateTopic(ctx, spec interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateTopic", reflect.TypeOf((*MockAdmin)(nil).CreateTopic), ctx, spec)
+}
+
+// DeleteGroup mocks base method.
+func (m *MockAdmin) DeleteGroup(ctx context.Context, group string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeleteGroup", ctx, group)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// DeleteGroup indicates an expected call of DeleteGroup.
+func (mr *MockAdminMockRecorder) DeleteGroup(ctx, group interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteGroup", reflect.TypeOf((*MockAdmin)(nil).DeleteGroup), ctx, group)
+}
+
+// DeleteTopic mocks base method.
+func (m *MockAdmin) DeleteTopic(ctx context.Context, topic string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeleteTopic", ctx, topic)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// DeleteTopic indicates an expected call of DeleteTopic.
+func (mr *MockAdminMockRecorder) DeleteTopic(ctx, topic interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteTopic", reflect.TypeOf((*MockAdmin)(nil).DeleteTopic), ctx, topic)
+}
+
+// DescribeGroup mocks base method.
+func (m *MockAdmin) DescribeGroup(ctx context.Context, group string) (kafka.GroupDescription, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DescribeGroup", ctx, group)
+	ret0, _ := ret[0].(kafka.GroupDescription)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// DescribeGroup indicates an expected call of DescribeGroup.
+func (mr *MockAdminMockRecorder) DescribeGroup(ctx, group interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DescribeGroup", reflect.TypeOf((*MockAdmin)(nil).DescribeGroup), ctx, group)
+}
+
+// DescribeTopic mocks base method.
+func (m *MockAdmin) DescribeTopic(ctx context.Context, topic string) (kafka.TopicDescription, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DescribeTopic", ctx, topic)
+	ret0, _ := ret[0].(kafka.TopicDescription)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// DescribeTopic indicates an expected call of DescribeTopic.
+func (mr *MockAdminMockRecorder) DescribeTopic(ctx, topic interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DescribeTopic", reflect.TypeOf((*MockAdmin)(nil).DescribeTopic), ctx, topic)
+}
+
+// EndOffsets mocks base method.
+func (m *MockAdmin) EndOffsets(ctx context.Context, topic string) (map[int32]int64, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "EndOffsets", ctx, topic)
+	ret0, _ := ret[0].(map[int32]int64)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// EndOffsets indicates an expected call of EndOffsets.
+func (mr *MockAdminMockRecorder) EndOffsets(ctx, topic interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "EndOffsets", reflect.TypeOf((*MockAdmin)(nil).EndOffsets), ctx, topic)
+}
+
+// EnsureTopics mocks base method.
+func (m *MockAdmin) EnsureTopics(ctx context.Context, specs ...kafka.TopicSpec) error {
+	m.ctrl.T.Helper()
+	varargs := []interface{}{ctx}
+	for _, a := range specs {
+		varargs = append(varargs, a)
+	}
+	ret := m.ctrl.Call(m, "EnsureTopics", varargs...)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// EnsureTopics indicates an expected call of EnsureTopics.
+func (mr *MockAdminMockRecorder) EnsureTopics(ctx interface{}, specs ...interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	varargs := append([]interface{}{ctx}, specs...)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "EnsureTopics", reflect.TypeOf((*MockAdmin)(nil).EnsureTopics), varargs...)
+}
+
+// ListGroups mocks base method.
+func (m *MockAdmin) ListGroups(ctx context.Context) ([]string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ListGroups", ctx)
+	ret0, _ := ret[0].([]string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ListGroups indicates an expected call of ListGroups.
+func (mr *MockAdminMockRecorder) ListGroups(ctx interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ListGroups", reflect.TypeOf((*MockAdmin)(nil).ListGroups), ctx)
+}
+
+// ListTopics mocks base method.
+func (m *MockAdmin) ListTopics(ctx context.Context) ([]string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ListTopics", ctx)
+	ret0, _ := ret[0].([]string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ListTopics indicates an expected call of ListTopics.
+func (mr *MockAdminMockRecorder) ListTopics(ctx interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ListTopics", reflect.TypeOf((*MockAdmin)(nil).ListTopics), ctx)
+}
+
+// ResetGroupOffsets mocks base method.
+func (m *MockAdmin) ResetGroupOffsets(ctx context.Context, group, topic string, to kafka.Position) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ResetGroupOffsets", ctx, group, topic, to)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// ResetGroupOffsets indicates an expected call of ResetGroupOffsets.
+func (mr *MockAdminMockRecorder) ResetGroupOffsets(ctx, group, topic, to interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Write", reflect.TypeOf((*MockWriter)(nil).Write), ctx, key, value)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ResetGroupOffsets", reflect.TypeOf((*MockAdmin)(nil).ResetGroupOffsets), ctx, group, topic, to)
 }
 
 // MockLogger is a mock of Logger interface.